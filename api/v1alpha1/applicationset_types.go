@@ -1,39 +1,269 @@
 package v1alpha1
 
 import (
+	"encoding/json"
+
 	"github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // ApplicationSet is a set of Application resources
 // +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Error",type="string",JSONPath=".status.conditions[?(@.type==\"ErrorOccurred\")].status"
+// +kubebuilder:printcolumn:name="Generated",type="string",JSONPath=".status.conditions[?(@.type==\"ParametersGenerated\")].status"
+// +kubebuilder:printcolumn:name="Up-To-Date",type="string",JSONPath=".status.conditions[?(@.type==\"ResourcesUpToDate\")].status"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 // +genclient
-// +genclient:noStatus
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 type ApplicationSet struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata"`
-	Spec              ApplicationSetSpec `json:"spec"`
+	Spec              ApplicationSetSpec   `json:"spec"`
+	Status            ApplicationSetStatus `json:"status,omitempty"`
 }
 
 // ApplicationSetSpec represents a class of application set state.
 type ApplicationSetSpec struct {
 	Generators []ApplicationSetGenerator `json:"generators"`
-	Template   ApplicationSetTemplate    `json:"template"`
-	SyncPolicy *ApplicationSetSyncPolicy `json:"syncPolicy,omitempty"`
+	// Template is the template of the generated Applications. When TemplateRef is set, the fields set in
+	// Template override those of the referenced template.
+	// +optional
+	Template ApplicationSetTemplate `json:"template,omitempty"`
+	// TemplateRef references a template shared by several ApplicationSets
+	TemplateRef *ApplicationSetTemplateRef `json:"templateRef,omitempty"`
+	SyncPolicy  *ApplicationSetSyncPolicy  `json:"syncPolicy,omitempty"`
+	// GoTemplate renders the template with Go text/template and the sprig functions, instead of
+	// replacing the '{{param}}' placeholders
+	GoTemplate bool `json:"goTemplate,omitempty"`
+	// GoTemplateOptions are the text/template options used when GoTemplate is set, e.g. 'missingkey=error'
+	GoTemplateOptions []string `json:"goTemplateOptions,omitempty"`
+	// StrictParams fails the generation of an Application whose template references params which don't exist,
+	// instead of leaving the placeholders as is. Defaults to the --strict-params flag of the controller.
+	StrictParams *bool `json:"strictParams,omitempty"`
+	// NormalizeNames converts the names of the generated Applications to valid DNS-1123 subdomains: they are
+	// lowercased, invalid characters are replaced with '-', and names longer than 253 characters are truncated
+	// with a hash suffix. The Applications of different names normalized to the same one are all refused, even
+	// when they are identical, as any other different Applications generated with the same name.
+	NormalizeNames bool `json:"normalizeNames,omitempty"`
+	// TemplatePatch is applied to each rendered Application, after its placeholders are rendered with the
+	// params of the Application. An Application whose patch fails is neither created nor updated, and is
+	// reported as failed in the status.
+	TemplatePatch *ApplicationSetTemplatePatch `json:"templatePatch,omitempty"`
+	// Jsonnet renders the generated Applications with a Jsonnet snippet, evaluated with the params of each
+	// Application as external variables
+	Jsonnet *ApplicationSetJsonnet `json:"jsonnet,omitempty"`
+	// IgnoreApplicationDifferences are fields of the generated Applications which the controller doesn't update,
+	// so that they can be modified by hand, e.g. to disable the automated sync of an Application during an incident
+	IgnoreApplicationDifferences []ApplicationSetIgnoreDifferences `json:"ignoreApplicationDifferences,omitempty"`
+	// Strategy is how the changes are rolled out to the generated Applications, all at once by default
+	Strategy *ApplicationSetStrategy `json:"strategy,omitempty"`
+}
+
+// ApplicationSetStrategy is how the changes are rolled out to the generated Applications
+type ApplicationSetStrategy struct {
+	// RollingSync rolls out the changes in steps, each step waiting for the Applications of the previous ones
+	// to be synced and healthy
+	RollingSync *ApplicationSetRollingSync `json:"rollingSync,omitempty"`
+}
+
+// ApplicationSetRollingSync are the ordered steps the Applications are created or updated in. The
+// Applications matching none of the steps are rolled out last.
+type ApplicationSetRollingSync struct {
+	Steps []ApplicationSetRolloutStep `json:"steps,omitempty"`
 }
 
+// ApplicationSetRolloutStep is a step of a rollingSync strategy. An Application belongs to the first step
+// whose expressions match its labels.
+type ApplicationSetRolloutStep struct {
+	// MatchExpressions select the Applications of the step by their labels
+	MatchExpressions []metav1.LabelSelectorRequirement `json:"matchExpressions,omitempty"`
+	// MaxUpdate is the maximum number of Applications of the step being rolled out at the same time, as a
+	// number or a percentage of the Applications of the step, e.g. '25%'. All of them by default.
+	MaxUpdate *intstr.IntOrString `json:"maxUpdate,omitempty"`
+}
+
+// ApplicationSetIgnoreDifferences are fields of the generated Applications whose live values are kept on update
+type ApplicationSetIgnoreDifferences struct {
+	// Name is the name of the Application the fields are ignored for, all the Applications when empty
+	Name string `json:"name,omitempty"`
+	// JSONPointers are RFC 6901 JSON pointers to the fields, e.g. '/spec/syncPolicy/automated'
+	JSONPointers []string `json:"jsonPointers,omitempty"`
+	// JQPathExpressions are JQ path expressions of the fields, e.g. '.spec.source.helm.parameters[] | select(.name == "replicas")'
+	JQPathExpressions []string `json:"jqPathExpressions,omitempty"`
+}
+
+// ApplicationSetJsonnet is a Jsonnet snippet rendering the generated Applications. Exactly one of Snippet and
+// Git must be set. The snippet runs in a sandbox: it can only import the files of the Libraries of its git
+// repository, and inline snippets can't import anything.
+type ApplicationSetJsonnet struct {
+	// Mode is what the snippet returns: application (the default), a whole Application replacing the template, or
+	// patch, a JSON merge patch of the Application rendered from the template
+	Mode JsonnetMode `json:"mode,omitempty"`
+	// Snippet is the Jsonnet code, e.g. 'std.extVar("cluster")' to get the value of the cluster param
+	Snippet string `json:"snippet,omitempty"`
+	// Git is a file of a git repository containing the snippet
+	Git *GitJsonnetSource `json:"git,omitempty"`
+}
+
+// JsonnetMode is what a Jsonnet snippet returns
+// +kubebuilder:validation:Enum=application;patch
+type JsonnetMode string
+
+const (
+	JsonnetModeApplication JsonnetMode = "application"
+	JsonnetModePatch       JsonnetMode = "patch"
+)
+
+// GitJsonnetSource is a file of a git repository containing a Jsonnet snippet
+type GitJsonnetSource struct {
+	RepoURL string `json:"repoURL"`
+	// Revision is the branch, tag or commit SHA the files are read from, HEAD by default
+	Revision string `json:"revision,omitempty"`
+	Path     string `json:"path"`
+	// Libraries are the only directories of the repository the snippet may import files from. Imports are
+	// resolved relative to the importing file first, then to each library.
+	Libraries []string `json:"libraries,omitempty"`
+}
+
+// ApplicationSetTemplateRef references a template, either a SharedApplicationSetTemplate or a file of a git
+// repository. Exactly one of Name and Git must be set.
+type ApplicationSetTemplateRef struct {
+	// Name is the name of a SharedApplicationSetTemplate in the namespace of the ApplicationSet
+	Name string `json:"name,omitempty"`
+	// Git is a file of a git repository containing the template, as YAML or JSON
+	Git *GitTemplateRef `json:"git,omitempty"`
+}
+
+// GitTemplateRef is a file of a git repository containing an Application template, with metadata and spec
+type GitTemplateRef struct {
+	RepoURL string `json:"repoURL"`
+	// Revision is the branch, tag or commit SHA the file is read from, HEAD by default
+	Revision string `json:"revision,omitempty"`
+	Path     string `json:"path"`
+}
+
+// ApplicationSetTemplatePatch is a patch of the generated Applications
+type ApplicationSetTemplatePatch struct {
+	// Type is the type of the patch: json (a RFC 6902 JSON Patch) or strategic (a strategic merge patch)
+	Type TemplatePatchType `json:"type"`
+	// Patch is the patch as YAML or JSON. It's rendered as a whole, so that with goTemplate the patch may
+	// depend on the params, e.g. only add a Helm parameter when a param exists. The values of the params are
+	// inserted once the patch is parsed, so they can't change its structure. A strategic merge patch replaces
+	// the lists of the Application, e.g. its Helm parameters, as they have no merge keys: use a JSON patch to
+	// add an element to a list.
+	Patch string `json:"patch"`
+}
+
+// TemplatePatchType is the type of a templatePatch
+// +kubebuilder:validation:Enum=json;strategic
+type TemplatePatchType string
+
+const (
+	TemplatePatchTypeJSON      TemplatePatchType = "json"
+	TemplatePatchTypeStrategic TemplatePatchType = "strategic"
+)
+
 // ApplicationSetSyncPolicy configures how generated Applications will relate to their
 // ApplicationSet.
 type ApplicationSetSyncPolicy struct {
 	// SkipPrune will disable the default behavior which will delete Applications that are no longer being generated for the ApplicationSet which created them, or the ApplicationSet itself is deleted. If SkipPrune is set to true, these Applications will be orphaned but continue to exist.
 	SkipPrune bool `json:"skipPrune,omitempty"`
+	// ResourcesFinalizer sets the finalizer of the generated Applications, which controls whether the resources of
+	// an Application are deleted along with it: cascade (the default), or none to leave them running.
+	ResourcesFinalizer ResourcesFinalizerPolicy `json:"resourcesFinalizer,omitempty"`
+	// ApplicationsSync selects the changes the controller makes to the generated Applications: sync (create, update
+	// and delete), create-update (no deletion) or create-only. It's capped by the --policy of the controller, which
+	// is also the default.
+	ApplicationsSync ApplicationsSyncPolicy `json:"applicationsSync,omitempty"`
+	// MaxDeletions is the maximum number of Applications deleted in a reconciliation, as a number or a percentage
+	// of the current Applications, e.g. '25%'. More deletions are blocked until the ApplicationSet is annotated
+	// with 'applicationset.argoproj.io/allow-deletions' set to the hash of the blocked deletions, given by the
+	// DeletionBlocked condition. Defaults to the --max-deletions of the controller.
+	MaxDeletions *intstr.IntOrString `json:"maxDeletions,omitempty"`
+	// AdoptionPolicy selects the existing Applications with a generated name the ApplicationSet takes over: never,
+	// ifUnowned (the default), those without a controller, or always, even those controlled by another owner.
+	AdoptionPolicy ApplicationSetAdoptionPolicy `json:"adoptionPolicy,omitempty"`
+	// AdoptFrom is the name of an ApplicationSet of the namespace whose Applications this ApplicationSet takes over,
+	// whatever its AdoptionPolicy, when it generates them too. The other ApplicationSet then releases the
+	// Applications it doesn't generate anymore, but this ApplicationSet reports in its status, instead of deleting
+	// them.
+	AdoptFrom string `json:"adoptFrom,omitempty"`
 }
 
+// ApplicationSetAdoptionPolicy selects the existing Applications an ApplicationSet takes over
+// +kubebuilder:validation:Enum=never;ifUnowned;always
+type ApplicationSetAdoptionPolicy string
+
+const (
+	ApplicationSetAdoptionPolicyNever     ApplicationSetAdoptionPolicy = "never"
+	ApplicationSetAdoptionPolicyIfUnowned ApplicationSetAdoptionPolicy = "ifUnowned"
+	ApplicationSetAdoptionPolicyAlways    ApplicationSetAdoptionPolicy = "always"
+)
+
+// ApplicationsSyncPolicy is the name of a policy of utils.Policies
+// +kubebuilder:validation:Enum=sync;create-update;create-only
+type ApplicationsSyncPolicy string
+
+const (
+	ApplicationsSyncPolicySync         ApplicationsSyncPolicy = "sync"
+	ApplicationsSyncPolicyCreateUpdate ApplicationsSyncPolicy = "create-update"
+	ApplicationsSyncPolicyCreateOnly   ApplicationsSyncPolicy = "create-only"
+)
+
+// ResourcesFinalizerPolicy is the deletion policy of the resources of the generated Applications
+// +kubebuilder:validation:Enum=cascade;none
+type ResourcesFinalizerPolicy string
+
+const (
+	// ResourcesFinalizerCascade deletes the resources of an Application with it
+	ResourcesFinalizerCascade ResourcesFinalizerPolicy = "cascade"
+	// ResourcesFinalizerNone leaves the resources of an Application running when it's deleted
+	ResourcesFinalizerNone ResourcesFinalizerPolicy = "none"
+)
+
 // ApplicationSetTemplate represents argocd ApplicationSpec
 type ApplicationSetTemplate struct {
+	// +optional
 	metav1.ObjectMeta `json:"metadata"`
-	Spec              v1alpha1.ApplicationSpec `json:"spec"`
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	Spec ApplicationTemplateSpec `json:"spec"`
+}
+
+// ApplicationTemplateSpec is the ApplicationSpec of the generated Applications. Any of its fields, whatever
+// its type, may be set to a '{{param}}' placeholder, which is replaced with the typed value of the param
+// when rendering. Such fields are left empty in ApplicationSpec, the template as written being kept in Raw.
+// As any field may hold a placeholder, the API server doesn't validate the template spec: the generated
+// Applications are validated once rendered instead.
+// +kubebuilder:validation:Type=object
+type ApplicationTemplateSpec struct {
+	v1alpha1.ApplicationSpec `json:"-"`
+	// Raw is the JSON of the template as written, used for rendering and marshalling when set.
+	// It must be reset when ApplicationSpec is modified.
+	Raw []byte `json:"-"`
+}
+
+func (s *ApplicationTemplateSpec) UnmarshalJSON(data []byte) error {
+	var spec v1alpha1.ApplicationSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		// Fields holding a placeholder for a non-string value can't be decoded, the others still are
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			return err
+		}
+	}
+	s.ApplicationSpec = spec
+	s.Raw = append([]byte{}, data...)
+	return nil
+}
+
+func (s ApplicationTemplateSpec) MarshalJSON() ([]byte, error) {
+	if s.Raw != nil {
+		return s.Raw, nil
+	}
+	return json.Marshal(s.ApplicationSpec)
 }
 
 // ApplicationSetGenerator include list item info
@@ -52,6 +282,8 @@ type ListGenerator struct {
 type ListGeneratorElement struct {
 	Cluster string `json:"cluster"`
 	Url     string `json:"url"`
+	// Values are additional params of any type, e.g. booleans or objects, available as '{{values.<key>}}'
+	Values map[string]apiextensionsv1.JSON `json:"values,omitempty"`
 }
 
 // ClusterGenerator defines a generator to match against clusters registered with ArgoCD.
@@ -63,16 +295,144 @@ type ClusterGenerator struct {
 }
 
 type GitGenerator struct {
-	RepoURL             string                      `json:"repoURL"`
-	Directories         []GitDirectoryGeneratorItem `json:"directories,omitempty"`
-	Revision            string                      `json:"revision"`
-	RequeueAfterSeconds int64                       `json:"requeueAfterSeconds,omitempty"`
+	RepoURL     string                      `json:"repoURL"`
+	Directories []GitDirectoryGeneratorItem `json:"directories,omitempty"`
+	// Branches, when set, generates one set of parameters per remote branch of RepoURL whose name
+	// matches any of the items, instead of looking up directories.
+	Branches            []GitBranchGeneratorItem `json:"branches,omitempty"`
+	Revision            string                   `json:"revision"`
+	RequeueAfterSeconds int64                    `json:"requeueAfterSeconds,omitempty"`
 }
 
 type GitDirectoryGeneratorItem struct {
 	Path string `json:"path"`
 }
 
+// GitBranchGeneratorItem selects the remote branches of a repository by name.
+type GitBranchGeneratorItem struct {
+	// Regex is a regular expression which must match the whole branch name (e.g. 'feature/.*').
+	Regex string `json:"regex"`
+}
+
+// ApplicationSetStatus is the state of an ApplicationSet, as observed by the controller
+type ApplicationSetStatus struct {
+	// ObservedGeneration is the generation of the spec the status was computed from
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions are the conditions of the last reconciliation of the ApplicationSet
+	Conditions []ApplicationSetCondition `json:"conditions,omitempty"`
+	// Applications are the Applications generated by the last reconciliation, sorted by name
+	Applications []ApplicationSetApplicationStatus `json:"applications,omitempty"`
+	// RollingSync is the progress of the rollingSync strategy
+	RollingSync *ApplicationSetRollingSyncStatus `json:"rollingSync,omitempty"`
+}
+
+// ApplicationSetRollingSyncStatus is the progress of the rollingSync strategy of an ApplicationSet
+type ApplicationSetRollingSyncStatus struct {
+	// CurrentStep is the step being rolled out, starting at 1, or 0 once all the steps are rolled out
+	CurrentStep int32 `json:"currentStep"`
+	// Steps is the number of steps, including the last one of the Applications matching none of the steps
+	Steps int32 `json:"steps"`
+}
+
+// ApplicationSetCondition is a condition of an ApplicationSet
+type ApplicationSetCondition struct {
+	Type   ApplicationSetConditionType   `json:"type"`
+	Status ApplicationSetConditionStatus `json:"status"`
+	// Reason is a CamelCase identifier of the cause of the status
+	Reason string `json:"reason"`
+	// Message is a human readable description of the status, e.g. the error which occurred
+	Message string `json:"message,omitempty"`
+	// LastTransitionTime is the last time the status changed
+	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// ApplicationSetConditionType is the type of an ApplicationSetCondition
+type ApplicationSetConditionType string
+
+const (
+	// ApplicationSetConditionErrorOccurred is True when the last reconciliation failed
+	ApplicationSetConditionErrorOccurred ApplicationSetConditionType = "ErrorOccurred"
+	// ApplicationSetConditionParametersGenerated is True when all the Applications could be generated
+	ApplicationSetConditionParametersGenerated ApplicationSetConditionType = "ParametersGenerated"
+	// ApplicationSetConditionResourcesUpToDate is True when the Applications in the cluster match the generated ones
+	ApplicationSetConditionResourcesUpToDate ApplicationSetConditionType = "ResourcesUpToDate"
+)
+
+// ApplicationSetConditionStatus is the status of an ApplicationSetCondition
+type ApplicationSetConditionStatus string
+
+const (
+	ApplicationSetConditionStatusTrue    ApplicationSetConditionStatus = "True"
+	ApplicationSetConditionStatusFalse   ApplicationSetConditionStatus = "False"
+	ApplicationSetConditionStatusUnknown ApplicationSetConditionStatus = "Unknown"
+)
+
+// The reasons of the ApplicationSetConditions
+const (
+	ApplicationSetReasonApplicationSetUpToDate      = "ApplicationSetUpToDate"
+	ApplicationSetReasonParametersGenerated         = "ParametersGenerated"
+	ApplicationSetReasonApplicationGenerationFailed = "ApplicationGenerationFailed"
+	ApplicationSetReasonUpdateApplicationError      = "UpdateApplicationError"
+	ApplicationSetReasonDeleteApplicationError      = "DeleteApplicationError"
+	ApplicationSetReasonRolloutProgressing          = "RolloutProgressing"
+	ApplicationSetReasonDeletionBlocked             = "DeletionBlocked"
+)
+
+// ApplicationSetApplicationStatus is the state of an Application generated by an ApplicationSet
+type ApplicationSetApplicationStatus struct {
+	Name string `json:"name"`
+	// LastAction is the last action of the controller on the Application: created, updated, unchanged, adopted,
+	// waiting or failed
+	LastAction string `json:"lastAction"`
+	// Message is the error of the last action, if it failed
+	Message string `json:"message,omitempty"`
+	// Step is the step of the rollingSync strategy the Application is rolled out in, starting at 1
+	Step int32 `json:"step,omitempty"`
+	// RolloutStatus is the progress of the rollout of the Application with the rollingSync strategy
+	RolloutStatus ApplicationSetRolloutStatus `json:"rolloutStatus,omitempty"`
+}
+
+// The LastActions of an ApplicationSetApplicationStatus which are not a controllerutil.OperationResult
+const (
+	ApplicationSetApplicationActionFailed = "failed"
+	// ApplicationSetApplicationActionWaiting is the action of the Applications waiting for the previous steps of
+	// the rollingSync strategy
+	ApplicationSetApplicationActionWaiting = "waiting"
+	// ApplicationSetApplicationActionAdopted is the action of the existing Applications the ApplicationSet took over
+	ApplicationSetApplicationActionAdopted = "adopted"
+)
+
+// ApplicationSetRolloutStatus is the progress of the rollout of an Application
+type ApplicationSetRolloutStatus string
+
+const (
+	// ApplicationSetRolloutWaiting is the status of the Applications not rolled out yet
+	ApplicationSetRolloutWaiting ApplicationSetRolloutStatus = "Waiting"
+	// ApplicationSetRolloutProgressing is the status of the Applications rolled out, which are not synced and
+	// healthy yet
+	ApplicationSetRolloutProgressing ApplicationSetRolloutStatus = "Progressing"
+	// ApplicationSetRolloutHealthy is the status of the Applications rolled out, synced and healthy
+	ApplicationSetRolloutHealthy ApplicationSetRolloutStatus = "Healthy"
+)
+
+// SharedApplicationSetTemplate is an Application template shared by several ApplicationSets, through their
+// templateRef. It's not named ApplicationSetTemplate, which is the type of the template of an ApplicationSet.
+// +kubebuilder:object:root=true
+type SharedApplicationSetTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Template          ApplicationSetTemplate `json:"template"`
+}
+
+// +kubebuilder:object:root=true
+
+// SharedApplicationSetTemplateList contains a list of SharedApplicationSetTemplate
+type SharedApplicationSetTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SharedApplicationSetTemplate `json:"items"`
+}
+
 // +kubebuilder:object:root=true
 
 // ApplicationSetList contains a list of ApplicationSet
@@ -84,4 +444,5 @@ type ApplicationSetList struct {
 
 func init() {
 	SchemeBuilder.Register(&ApplicationSet{}, &ApplicationSetList{})
+	SchemeBuilder.Register(&SharedApplicationSetTemplate{}, &SharedApplicationSetTemplateList{})
 }
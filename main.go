@@ -11,8 +11,11 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 
 	"os"
+	"path/filepath"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -47,6 +50,15 @@ func main() {
 	var policy string
 	var debugLog bool
 	var dryRun bool
+	var repoBackend string
+	var gitCacheDir string
+	var gitCacheSize int
+	var repoCacheTTL time.Duration
+	var repoCacheSize int
+	var maxConcurrentGenerators int
+	var generatorTimeout time.Duration
+	var maxDeletions string
+	var strictParams bool
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&metricsAddr, "probe-addr", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
@@ -54,9 +66,18 @@ func main() {
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&namespace, "namespace", "argocd", "Argo CD repo namesapce")
 	flag.StringVar(&argocdRepoServer, "argocd-repo-server", "argocd-repo-server:8081", "Argo CD repo server address")
-	flag.StringVar(&policy, "policy", "sync", "Modify how application is sync between the generator and the cluster. Default is sync (create & update & delete), options: create-only, create-update (no deletion)")
+	flag.StringVar(&policy, "policy", "sync", "Modify how application is sync between the generator and the cluster. Default is sync (create & update & delete), options: create-only, create-update (no deletion). ApplicationSets may select a less permissive policy with syncPolicy.applicationsSync")
 	flag.BoolVar(&debugLog, "debug", false, "print debug logs")
 	flag.BoolVar(&dryRun, "dry-run", false, "Enable dry run mode")
+	flag.StringVar(&repoBackend, "repo-backend", "repo-server", "Modify how git repositories are read by the git generator. Default is repo-server (through the Argo CD repo server), options: git (clone repositories directly, without the Argo CD repo server)")
+	flag.StringVar(&gitCacheDir, "git-cache-dir", filepath.Join(os.TempDir(), "applicationset-repos"), "Directory in which repositories are cloned, when using the git repo backend")
+	flag.IntVar(&gitCacheSize, "git-cache-size", 50, "Maximum number of repositories kept cloned on disk, when using the git repo backend")
+	flag.DurationVar(&repoCacheTTL, "repo-cache-ttl", time.Hour, "How long the applications listed in a commit of a repository are cached. Set to 0 to disable the cache")
+	flag.IntVar(&repoCacheSize, "repo-cache-size", 1000, "Maximum number of commits whose applications listing is cached")
+	flag.IntVar(&maxConcurrentGenerators, "max-concurrent-generators", 4, "Maximum number of generators of an ApplicationSet run concurrently. Set to 0 for no limit")
+	flag.DurationVar(&generatorTimeout, "generator-timeout", 5*time.Minute, "Maximum duration of a generator run. Set to 0 for no timeout")
+	flag.BoolVar(&strictParams, "strict-params", false, "Fail the generation of Applications whose template references params which don't exist, unless the strictParams option of their ApplicationSet is set to false")
+	flag.StringVar(&maxDeletions, "max-deletions", "", "Maximum number of Applications an ApplicationSet deletes in a reconciliation, as a number or a percentage of its Applications, e.g. 25%. More deletions are blocked until they are acknowledged. Empty for no limit, unless the maxDeletions option of the ApplicationSet is set")
 	flag.Parse()
 
 
@@ -69,6 +90,16 @@ func main() {
 		os.Exit(1)
 	}
   
+	var maxDeletionsObj *intstr.IntOrString
+	if maxDeletions != "" {
+		parsed := intstr.Parse(maxDeletions)
+		if _, err := intstr.GetValueFromIntOrPercent(&parsed, 100, false); err != nil {
+			setupLog.Error(err, "invalid max-deletions")
+			os.Exit(1)
+		}
+		maxDeletionsObj = &parsed
+	}
+
   if debugLog {
     log.SetLevel(log.DebugLevel)
   }
@@ -103,16 +134,39 @@ func main() {
 
 	k8s := kubernetes.NewForConfigOrDie(mgr.GetConfig())
 
+	var repos services.Apps
+	switch repoBackend {
+	case "repo-server":
+		repos = services.NewArgoCDService(context.Background(), k8s, namespace, argocdRepoServer)
+	case "git":
+		repos, err = services.NewGitService(context.Background(), k8s, namespace, gitCacheDir, gitCacheSize)
+		if err != nil {
+			setupLog.Error(err, "unable to create git repo backend")
+			os.Exit(1)
+		}
+	default:
+		setupLog.Info("Repo backend value can be: repo-server, git")
+		os.Exit(1)
+	}
+	if repoCacheTTL > 0 {
+		repos = services.NewCachedApps(repos, repoCacheTTL, repoCacheSize)
+	}
+
 	if err = (&controllers.ApplicationSetReconciler{
 		Generators: map[string]generators.Generator{
 			"List": generators.NewListGenerator(),
 			"Clusters": generators.NewClusterGenerator(mgr.GetClient()),
-			"Git": generators.NewGitGenerator(services.NewArgoCDService(context.Background(), k8s, namespace, argocdRepoServer)),
+			"Git": generators.NewGitGenerator(repos),
 		},
 		Client:      mgr.GetClient(),
 		Scheme:      mgr.GetScheme(),
 		Recorder:    mgr.GetEventRecorderFor("applicationset-controller"),
 		Renderer: &utils.Render{},
+		MaxConcurrentGenerators: maxConcurrentGenerators,
+		GeneratorTimeout:        generatorTimeout,
+		StrictParams:            strictParams,
+		MaxDeletions:            maxDeletionsObj,
+		Repos:                   repos,
     Policy: policyObj,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ApplicationSet")
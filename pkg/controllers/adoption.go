@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"fmt"
+
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	"github.com/argoproj-labs/applicationset/pkg/utils"
+)
+
+// getAdoptionPolicy returns the adoptionPolicy of the ApplicationSet, ifUnowned by default
+func getAdoptionPolicy(applicationSet *argoprojiov1alpha1.ApplicationSet) argoprojiov1alpha1.ApplicationSetAdoptionPolicy {
+	if applicationSet.Spec.SyncPolicy == nil || applicationSet.Spec.SyncPolicy.AdoptionPolicy == "" {
+		return argoprojiov1alpha1.ApplicationSetAdoptionPolicyIfUnowned
+	}
+	return applicationSet.Spec.SyncPolicy.AdoptionPolicy
+}
+
+// isControlledBy returns whether the Application is controlled by the ApplicationSet
+func isControlledBy(app *argov1alpha1.Application, applicationSet *argoprojiov1alpha1.ApplicationSet) bool {
+	owner := metav1.GetControllerOf(app)
+	return owner != nil && owner.Kind == "ApplicationSet" && owner.Name == applicationSet.Name && owner.UID == applicationSet.UID
+}
+
+// adoptApplication applies the adoptionPolicy of the ApplicationSet to an existing Application it doesn't control,
+// before it's updated. The Applications of the ApplicationSet it adopts from, controlled or released by it, are
+// always adopted. It returns a description of the adoption, e.g. 'Adopted Application "app"', or an error when
+// the policy doesn't allow the ApplicationSet to take the Application over.
+func adoptApplication(applicationSet *argoprojiov1alpha1.ApplicationSet, app *argov1alpha1.Application) (string, error) {
+	if isControlledBy(app, applicationSet) {
+		return "", nil
+	}
+
+	policy := getAdoptionPolicy(applicationSet)
+	owner := metav1.GetControllerOf(app)
+	adoptFrom := getAdoptFrom(applicationSet)
+	var res string
+	switch {
+	case adoptFrom != "" && owner != nil && owner.Kind == "ApplicationSet" && owner.Name == adoptFrom:
+		res = fmt.Sprintf("Adopted Application %q from ApplicationSet %q", app.Name, adoptFrom)
+	case adoptFrom != "" && owner == nil && app.Annotations[utils.ReleasedByAnnotation] == adoptFrom:
+		res = fmt.Sprintf("Adopted Application %q released by ApplicationSet %q", app.Name, adoptFrom)
+	case owner == nil && policy == argoprojiov1alpha1.ApplicationSetAdoptionPolicyNever:
+		return "", fmt.Errorf("Application %q already exists, and the adoptionPolicy is %s", app.Name, policy)
+	case owner == nil:
+		res = fmt.Sprintf("Adopted Application %q", app.Name)
+	case policy == argoprojiov1alpha1.ApplicationSetAdoptionPolicyAlways:
+		res = fmt.Sprintf("Adopted Application %q from %s %q", app.Name, owner.Kind, owner.Name)
+	default:
+		return "", fmt.Errorf("Application %q is controlled by %s %q, and the adoptionPolicy is %s", app.Name, owner.Kind, owner.Name, policy)
+	}
+
+	// The reference to the previous controller is replaced in the same update, so that the Application isn't
+	// deleted along with it
+	var ownerReferences []metav1.OwnerReference
+	for _, ref := range app.OwnerReferences {
+		if ref.Controller == nil || !*ref.Controller {
+			ownerReferences = append(ownerReferences, ref)
+		}
+	}
+	app.OwnerReferences = ownerReferences
+	delete(app.Annotations, utils.ReleasedByAnnotation)
+
+	return res, nil
+}
@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	"github.com/argoproj-labs/applicationset/pkg/utils"
+)
+
+func TestAdoptApplication(t *testing.T) {
+	isController := true
+	ownedBy := func(name string, uid types.UID) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{
+			APIVersion: "argoproj.io/v1alpha1",
+			Kind:       "ApplicationSet",
+			Name:       name,
+			UID:        uid,
+			Controller: &isController,
+		}}
+	}
+
+	for _, c := range []struct {
+		name                string
+		policy              argoprojiov1alpha1.ApplicationSetAdoptionPolicy
+		adoptFrom           string
+		ownerReferences     []metav1.OwnerReference
+		annotations         map[string]string
+		expected            string
+		expectedOwnerRefs   []metav1.OwnerReference
+		expectedAnnotations map[string]string
+		expectErr           bool
+	}{
+		{
+			name:              "controlled by the ApplicationSet",
+			policy:            argoprojiov1alpha1.ApplicationSetAdoptionPolicyNever,
+			ownerReferences:   ownedBy("name", "uid"),
+			expectedOwnerRefs: ownedBy("name", "uid"),
+		},
+		{
+			name:     "unowned, ifUnowned by default",
+			expected: `Adopted Application "app"`,
+		},
+		{
+			name:      "unowned, never",
+			policy:    argoprojiov1alpha1.ApplicationSetAdoptionPolicyNever,
+			expectErr: true,
+		},
+		{
+			name:            "controlled by another ApplicationSet, ifUnowned",
+			policy:          argoprojiov1alpha1.ApplicationSetAdoptionPolicyIfUnowned,
+			ownerReferences: ownedBy("other", "other-uid"),
+			expectErr:       true,
+		},
+		{
+			name:            "controlled by a previous ApplicationSet of the same name",
+			ownerReferences: ownedBy("name", "previous-uid"),
+			expectErr:       true,
+		},
+		{
+			name:   "controlled by another ApplicationSet, always",
+			policy: argoprojiov1alpha1.ApplicationSetAdoptionPolicyAlways,
+			ownerReferences: append(ownedBy("other", "other-uid"), metav1.OwnerReference{
+				APIVersion: "v1",
+				Kind:       "ConfigMap",
+				Name:       "config",
+				UID:        "config-uid",
+			}),
+			expected: `Adopted Application "app" from ApplicationSet "other"`,
+			expectedOwnerRefs: []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       "ConfigMap",
+				Name:       "config",
+				UID:        "config-uid",
+			}},
+		},
+		{
+			name:            "controlled by the ApplicationSet it adopts from, never",
+			policy:          argoprojiov1alpha1.ApplicationSetAdoptionPolicyNever,
+			adoptFrom:       "other",
+			ownerReferences: ownedBy("other", "other-uid"),
+			expected:        `Adopted Application "app" from ApplicationSet "other"`,
+		},
+		{
+			name:                "released by the ApplicationSet it adopts from, never",
+			policy:              argoprojiov1alpha1.ApplicationSetAdoptionPolicyNever,
+			adoptFrom:           "other",
+			annotations:         map[string]string{utils.ReleasedByAnnotation: "other", "notes": "value"},
+			expected:            `Adopted Application "app" released by ApplicationSet "other"`,
+			expectedAnnotations: map[string]string{"notes": "value"},
+		},
+		{
+			name:            "controlled by another ApplicationSet than the one it adopts from",
+			adoptFrom:       "other",
+			ownerReferences: ownedBy("third", "third-uid"),
+			expectErr:       true,
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			appSet := &argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "name", Namespace: "namespace", UID: "uid"},
+				Spec: argoprojiov1alpha1.ApplicationSetSpec{
+					SyncPolicy: &argoprojiov1alpha1.ApplicationSetSyncPolicy{AdoptionPolicy: cc.policy, AdoptFrom: cc.adoptFrom},
+				},
+			}
+			app := &argov1alpha1.Application{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "app",
+					Namespace:       "namespace",
+					OwnerReferences: cc.ownerReferences,
+					Annotations:     cc.annotations,
+				},
+			}
+
+			got, err := adoptApplication(appSet, app)
+			if cc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, cc.expected, got)
+			assert.Equal(t, cc.expectedOwnerRefs, app.OwnerReferences)
+			assert.Equal(t, cc.expectedAnnotations, app.Annotations)
+		})
+	}
+}
+
+func TestCreateOrUpdateInClusterAdoption(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, argoprojiov1alpha1.AddToScheme(scheme))
+	assert.NoError(t, argov1alpha1.AddToScheme(scheme))
+
+	isController := true
+	appSet := argoprojiov1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "name", Namespace: "namespace", UID: "uid"},
+	}
+	unowned := &argov1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "unowned", Namespace: "namespace", ResourceVersion: "1"},
+		Spec:       argov1alpha1.ApplicationSpec{Project: "default"},
+	}
+	owned := &argov1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "owned",
+			Namespace:       "namespace",
+			ResourceVersion: "1",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "argoproj.io/v1alpha1",
+				Kind:       "ApplicationSet",
+				Name:       "other",
+				UID:        "other-uid",
+				Controller: &isController,
+			}},
+		},
+		Spec: argov1alpha1.ApplicationSpec{Project: "default"},
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme, &appSet, unowned, owned)
+	recorder := record.NewFakeRecorder(10)
+	r := ApplicationSetReconciler{Client: client, Scheme: scheme, Recorder: recorder}
+
+	res, err := r.createOrUpdateInCluster(context.TODO(), appSet, []argov1alpha1.Application{
+		{ObjectMeta: metav1.ObjectMeta{Name: "owned"}, Spec: argov1alpha1.ApplicationSpec{Project: "default"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "unowned"}, Spec: argov1alpha1.ApplicationSpec{Project: "default"}},
+	})
+	assert.EqualError(t, err, `Application "owned" is controlled by ApplicationSet "other", and the adoptionPolicy is ifUnowned`)
+	assert.Equal(t, []argoprojiov1alpha1.ApplicationSetApplicationStatus{
+		{
+			Name:       "owned",
+			LastAction: argoprojiov1alpha1.ApplicationSetApplicationActionFailed,
+			Message:    `Application "owned" is controlled by ApplicationSet "other", and the adoptionPolicy is ifUnowned`,
+		},
+		{Name: "unowned", LastAction: argoprojiov1alpha1.ApplicationSetApplicationActionAdopted},
+	}, res)
+	assert.Equal(t, `Normal Adopted Adopted Application "unowned"`, <-recorder.Events)
+
+	var got argov1alpha1.Application
+	assert.NoError(t, client.Get(context.TODO(), types.NamespacedName{Namespace: "namespace", Name: "unowned"}, &got))
+	assert.True(t, isControlledBy(&got, &appSet))
+	assert.NoError(t, client.Get(context.TODO(), types.NamespacedName{Namespace: "namespace", Name: "owned"}, &got))
+	assert.False(t, isControlledBy(&got, &appSet))
+}
@@ -18,17 +18,23 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/argoproj-labs/applicationset/pkg/generators"
+	"github.com/argoproj-labs/applicationset/pkg/services"
 	"github.com/argoproj-labs/applicationset/pkg/utils"
 	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/kubernetes/pkg/apis/core"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/source"
@@ -47,6 +53,18 @@ type ApplicationSetReconciler struct {
 	Scheme     *runtime.Scheme
 	Recorder   record.EventRecorder
 	Generators map[string]generators.Generator
+	// MaxConcurrentGenerators is the maximum number of generators of an ApplicationSet called at the same time.
+	// 0 means no limit.
+	MaxConcurrentGenerators int
+	// GeneratorTimeout is the maximum duration of a call to a generator. 0 means no timeout.
+	GeneratorTimeout time.Duration
+	// StrictParams is the default of the strictParams option of the ApplicationSets
+	StrictParams bool
+	// MaxDeletions is the default of the maxDeletions option of the ApplicationSets. nil means no limit.
+	MaxDeletions *intstr.IntOrString
+	// Repos reads the templates referenced by the templateRef of the ApplicationSets from git
+	Repos services.Apps
+	// Policy is the default policy of the ApplicationSets, and the most permissive one they may select
 	utils.Policy
 	utils.Renderer
 }
@@ -54,6 +72,7 @@ type ApplicationSetReconciler struct {
 // +kubebuilder:rbac:groups=argoproj.io,resources=applicationsets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=argoproj.io,resources=applicationsets/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=argoproj.io,resources=applicationsets/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=argoproj.io,resources=sharedapplicationsettemplates,verbs=get;list;watch
 
 func (r *ApplicationSetReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	ctx := context.Background()
@@ -67,31 +86,73 @@ func (r *ApplicationSetReconciler) Reconcile(req ctrl.Request) (ctrl.Result, err
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// desiredApplications is the main list of all expected Applications from all generators in this appset.
-	desiredApplications, err := r.generateApplications(applicationSetInfo)
-	if err != nil {
+	if !applicationSetInfo.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.orphanApplications(ctx, &applicationSetInfo)
+	}
+
+	if err := r.setOrphanApplicationsFinalizer(ctx, &applicationSetInfo); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	if r.Policy.Update() {
-		err = r.createOrUpdateInCluster(ctx, applicationSetInfo, desiredApplications)
-		if err != nil {
-			return ctrl.Result{}, err
-		}
+	// desiredApplications is the main list of all expected Applications from all generators in this appset.
+	// When some Applications can't be generated, the others are still created or updated, but none are
+	// deleted since the list is incomplete.
+	desiredApplications, patchFailures, generateErr := r.generateApplications(ctx, applicationSetInfo)
+	// The Applications generated several times with the same name are refused, which is reported like an error
+	// of the generators
+	desiredApplications, collisions, collisionErr := r.refuseNameCollisions(&applicationSetInfo, desiredApplications)
+	if generateErr == nil {
+		generateErr = collisionErr
+	}
+	if generateErr != nil {
+		log.WithError(generateErr).WithField("applicationset", req.NamespacedName).
+			Error("failed to generate all the applications, skipping deletion")
+	}
+
+	policy := r.getPolicy(&applicationSetInfo)
+	result := reconcileResult{generateErr: generateErr}
+	// With a rollingSync strategy, only the Applications of the current step are created or updated
+	rollout, err := r.rollout(ctx, &applicationSetInfo, desiredApplications, policy)
+	if err != nil {
+		result.updateErr = err
 	} else {
-		err = r.createInCluster(ctx, applicationSetInfo, desiredApplications)
-		if err != nil {
-			return ctrl.Result{}, err
+		if policy.Update() {
+			result.applications, result.updateErr = r.createOrUpdateInCluster(ctx, applicationSetInfo, rollout.applications)
+		} else {
+			result.applications, result.updateErr = r.createInCluster(ctx, applicationSetInfo, rollout.applications)
 		}
+		result.applications = rollout.applicationStatuses(result.applications)
+		result.rollout = rollout.status
 	}
-
-	if r.Policy.Delete() {
-		err = r.deleteInCluster(ctx, applicationSetInfo, desiredApplications)
-		if err != nil {
-			return ctrl.Result{}, err
+	result.applications = append(result.applications, patchFailures...)
+	result.applications = append(result.applications, collisions...)
+
+	if result.updateErr == nil && generateErr == nil && policy.Delete() && !skipPrune(&applicationSetInfo) {
+		result.deleteErr = r.deleteInCluster(ctx, applicationSetInfo, desiredApplications)
+		if result.deleteErr == nil {
+			if err := r.clearDeletionsAcknowledgement(ctx, &applicationSetInfo); err != nil {
+				log.WithError(err).WithField("applicationset", req.NamespacedName).Error("failed to clear the deletions acknowledgement")
+			}
 		}
 	}
 
+	if err := r.updateStatus(ctx, &applicationSetInfo, result); err != nil {
+		log.WithError(err).WithField("applicationset", req.NamespacedName).Error("failed to update status")
+	}
+
+	if result.updateErr != nil {
+		return ctrl.Result{}, result.updateErr
+	}
+
+	if generateErr != nil {
+		return ctrl.Result{}, generateErr
+	}
+
+	// Blocked deletions are retried once acknowledged, which triggers another reconciliation
+	if result.deleteErr != nil && !isDeletionsBlocked(result.deleteErr) {
+		return ctrl.Result{}, result.deleteErr
+	}
+
 	requeueAfter := r.getMinRequeueAfter(&applicationSetInfo)
 	log.WithField("requeueAfter", requeueAfter).Info("end reconcile")
 
@@ -103,6 +164,17 @@ func (r *ApplicationSetReconciler) Reconcile(req ctrl.Request) (ctrl.Result, err
 func (r *ApplicationSetReconciler) GetRelevantGenerators(requestedGenerator *argoprojiov1alpha1.ApplicationSetGenerator) []generators.Generator {
 	var res []generators.Generator
 
+	for _, field := range getRelevantGeneratorFields(requestedGenerator) {
+		res = append(res, r.Generators[field.Name])
+	}
+
+	return res
+}
+
+// getRelevantGeneratorFields returns the fields of the generators set in the ApplicationSetGenerator
+func getRelevantGeneratorFields(requestedGenerator *argoprojiov1alpha1.ApplicationSetGenerator) []reflect.StructField {
+	var res []reflect.StructField
+
 	v := reflect.Indirect(reflect.ValueOf(requestedGenerator))
 	for i := 0; i < v.NumField(); i++ {
 		field := v.Field(i)
@@ -111,7 +183,7 @@ func (r *ApplicationSetReconciler) GetRelevantGenerators(requestedGenerator *arg
 		}
 
 		if !reflect.ValueOf(field.Interface()).IsNil() {
-			res = append(res, r.Generators[v.Type().Field(i).Name])
+			res = append(res, v.Type().Field(i))
 		}
 	}
 
@@ -138,54 +210,290 @@ func (r *ApplicationSetReconciler) getMinRequeueAfter(applicationSetInfo *argopr
 	return res
 }
 
-func getTempApplication(applicationSetTemplate argoprojiov1alpha1.ApplicationSetTemplate) *argov1alpha1.Application {
-	var tmplApplication argov1alpha1.Application
-	tmplApplication.Annotations = applicationSetTemplate.Annotations
-	tmplApplication.Labels = applicationSetTemplate.Labels
-	tmplApplication.Namespace = applicationSetTemplate.Namespace
-	tmplApplication.Name = applicationSetTemplate.Name
-	tmplApplication.Spec = applicationSetTemplate.Spec
+// generatorResult holds the params generated by one generator of an ApplicationSet
+type generatorResult struct {
+	// name identifies the generator in the ApplicationSet, e.g. 'generators[1].list'
+	name   string
+	params []map[string]interface{}
+	err    error
+}
+
+// generateParams calls all the generators of the ApplicationSet concurrently, at most MaxConcurrentGenerators
+// at a time. The results are returned in the order of the generators in the ApplicationSet, regardless of the
+// order in which they complete, so that the generated Applications are stable.
+func (r *ApplicationSetReconciler) generateParams(ctx context.Context, applicationSetInfo argoprojiov1alpha1.ApplicationSet) []generatorResult {
+	type job struct {
+		requestedGenerator *argoprojiov1alpha1.ApplicationSetGenerator
+		generator          generators.Generator
+		name               string
+	}
+
+	var jobs []job
+	for i := range applicationSetInfo.Spec.Generators {
+		requestedGenerator := &applicationSetInfo.Spec.Generators[i]
+		for _, field := range getRelevantGeneratorFields(requestedGenerator) {
+			jobs = append(jobs, job{
+				requestedGenerator: requestedGenerator,
+				generator:          r.Generators[field.Name],
+				name:               fmt.Sprintf("generators[%d].%s", i, strings.Split(field.Tag.Get("json"), ",")[0]),
+			})
+		}
+	}
+
+	concurrency := r.MaxConcurrentGenerators
+	if concurrency <= 0 || concurrency > len(jobs) {
+		concurrency = len(jobs)
+	}
+	sem := make(chan struct{}, concurrency)
+
+	results := make([]generatorResult, len(jobs))
+	var wg sync.WaitGroup
+	for i, j := range jobs {
+		wg.Add(1)
+		go func(i int, j job) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			params, err := r.callGenerator(ctx, j.generator, j.requestedGenerator)
+			results[i] = generatorResult{name: j.name, params: params, err: err}
+		}(i, j)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// callGenerator calls the generator, giving up after GeneratorTimeout. Generators are expected to stop
+// once their context is cancelled, but are not waited for if they don't.
+func (r *ApplicationSetReconciler) callGenerator(ctx context.Context, g generators.Generator, requestedGenerator *argoprojiov1alpha1.ApplicationSetGenerator) ([]map[string]interface{}, error) {
+	if r.GeneratorTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.GeneratorTimeout)
+		defer cancel()
+	}
 
-	return &tmplApplication
+	done := make(chan generatorResult, 1)
+	go func() {
+		params, err := g.GenerateParams(ctx, requestedGenerator)
+		done <- generatorResult{params: params, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.params, res.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("generator did not complete: %v", ctx.Err())
+	}
 }
 
-func (r *ApplicationSetReconciler) generateApplications(applicationSetInfo argoprojiov1alpha1.ApplicationSet) ([]argov1alpha1.Application, error) {
+// generateApplications renders the Applications from the params of all the generators of the ApplicationSet. The
+// Applications whose templatePatch failed are returned with the failed action, and reported like the errors of
+// the generators.
+func (r *ApplicationSetReconciler) generateApplications(ctx context.Context, applicationSetInfo argoprojiov1alpha1.ApplicationSet) ([]argov1alpha1.Application, []argoprojiov1alpha1.ApplicationSetApplicationStatus, error) {
 	res := []argov1alpha1.Application{}
+	var failed []argoprojiov1alpha1.ApplicationSetApplicationStatus
+
+	template, err := r.getTemplate(ctx, &applicationSetInfo)
+	if err != nil {
+		log.WithError(err).WithField("applicationset", applicationSetInfo.Name).Error("error resolving templateRef")
+		r.Recorder.Event(&applicationSetInfo, core.EventTypeWarning, "TemplateRefFailed", err.Error())
+		return res, nil, err
+	}
 
+	renderer := r.getRenderer(&applicationSetInfo)
+	if applicationSetInfo.Spec.Jsonnet != nil {
+		renderer, err = r.getJsonnetRenderer(ctx, &applicationSetInfo, renderer)
+		if err != nil {
+			log.WithError(err).WithField("applicationset", applicationSetInfo.Name).Error("error loading Jsonnet snippet")
+			r.Recorder.Event(&applicationSetInfo, core.EventTypeWarning, "JsonnetFailed", err.Error())
+			return res, nil, err
+		}
+	}
+	if !usesParam(&applicationSetInfo, template, utils.RevisionDateKeyName) {
+		ctx = generators.WithoutRevisionDate(ctx)
+	}
 	var firstError error
-	tmplApplication := getTempApplication(applicationSetInfo.Spec.Template)
-	for _, requestedGenerator := range applicationSetInfo.Spec.Generators {
-		generators := r.GetRelevantGenerators(&requestedGenerator)
-		for _, g := range generators {
-			params, err := g.GenerateParams(&requestedGenerator)
+	for _, result := range r.generateParams(ctx, applicationSetInfo) {
+		if result.err != nil {
+			log.WithError(result.err).WithField("generator", result.name).
+				Error("error generating params")
+			if firstError == nil {
+				firstError = result.err
+			}
+			continue
+		}
+
+		params := result.params
+		for _, p := range params {
+			app, err := renderer.RenderTemplateParams(template, p)
 			if err != nil {
-				log.WithError(err).WithField("generator", g).
-					Error("error generating params")
+				err = fmt.Errorf("failed to render application from the params of %s: %v", result.name, err)
+				log.WithError(err).WithField("params", params).WithField("generator", result.name).
+					Error("error generating application from params")
 				if firstError == nil {
 					firstError = err
 				}
 				continue
 			}
-
-			for _, p := range params {
-				app, err := r.Renderer.RenderTemplateParams(tmplApplication, p)
+			if applicationSetInfo.Spec.TemplatePatch != nil {
+				patched, err := utils.ApplyTemplatePatch(renderer, app, applicationSetInfo.Spec.TemplatePatch, p)
 				if err != nil {
-					log.WithError(err).WithField("params", params).WithField("generator", g).
-						Error("error generating application from params")
+					err = fmt.Errorf("failed to apply templatePatch to Application %q: %v", app.Name, err)
+					log.WithError(err).WithField("params", p).WithField("generator", result.name).
+						Error("error patching application")
+					name := app.Name
+					if applicationSetInfo.Spec.NormalizeNames {
+						name = utils.NormalizeName(name)
+					}
+					// The failure is only reported by an Event when it's new, rather than on each reconciliation
+					if !hasFailed(applicationSetInfo.Status.Applications, name, err.Error()) {
+						r.Recorder.Event(&applicationSetInfo, core.EventTypeWarning, "TemplatePatchFailed", err.Error())
+					}
+					failed = append(failed, argoprojiov1alpha1.ApplicationSetApplicationStatus{
+						Name:       name,
+						LastAction: argoprojiov1alpha1.ApplicationSetApplicationActionFailed,
+						Message:    err.Error(),
+					})
 					if firstError == nil {
 						firstError = err
 					}
 					continue
 				}
-				res = append(res, *app)
+				app = patched
 			}
+			// The name is normalized by refuseNameCollisions, which refuses the different names normalized to the
+			// same one
+			setResourcesFinalizer(app, applicationSetInfo.Spec.SyncPolicy)
+			setRevisionAnnotation(app, p)
+			res = append(res, *app)
+		}
+
+		log.WithField("generator", result.name).Infof("generated %d applications", len(res))
+		log.WithField("generator", result.name).Debugf("apps from generator: %+v", res)
+	}
+	return res, failed, firstError
+}
+
+// getPolicy returns the policy selected by the applicationsSync option of the ApplicationSet, capped by the
+// policy of the controller. An unknown policy is taken as create-only, the most restrictive one, rather than
+// allowing the ApplicationSet to update or delete Applications it may not be meant to.
+func (r *ApplicationSetReconciler) getPolicy(applicationSetInfo *argoprojiov1alpha1.ApplicationSet) utils.Policy {
+	syncPolicy := applicationSetInfo.Spec.SyncPolicy
+	if syncPolicy == nil || syncPolicy.ApplicationsSync == "" {
+		return r.Policy
+	}
+
+	policy, ok := utils.Policies[string(syncPolicy.ApplicationsSync)]
+	if !ok {
+		log.WithField("applicationset", applicationSetInfo.Name).WithField("applicationsSync", syncPolicy.ApplicationsSync).
+			Warn("unknown applicationsSync policy, using the create-only policy")
+		policy = &utils.CreateOnlyPolicy{}
+	}
+	return utils.CapPolicy(policy, r.Policy)
+}
 
-			log.WithField("generator", g).Infof("generated %d applications", len(res))
-			log.WithField("generator", g).Debugf("apps from generator: %+v", res)
+// getRenderer returns the Renderer selected by the goTemplate and strictParams options of the ApplicationSet
+func (r *ApplicationSetReconciler) getRenderer(applicationSetInfo *argoprojiov1alpha1.ApplicationSet) utils.Renderer {
+	strict := r.StrictParams
+	if applicationSetInfo.Spec.StrictParams != nil {
+		strict = *applicationSetInfo.Spec.StrictParams
+	}
 
+	if applicationSetInfo.Spec.GoTemplate {
+		options := applicationSetInfo.Spec.GoTemplateOptions
+		if strict {
+			options = append(append([]string{}, options...), "missingkey=error")
 		}
+		return &utils.GoTemplateRender{Options: options}
 	}
-	return res, firstError
+
+	if strict {
+		return &utils.Render{Strict: true}
+	}
+	return r.Renderer
+}
+
+// setResourcesFinalizer sets the resources finalizer selected by the sync policy on the Application. The variants
+// of it listed in the template, e.g. 'resources-finalizer.argocd.argoproj.io/foreground', are removed, as Argo CD
+// v1.7 doesn't handle them and would never delete the Application. The other finalizers of the template are kept.
+func setResourcesFinalizer(app *argov1alpha1.Application, syncPolicy *argoprojiov1alpha1.ApplicationSetSyncPolicy) {
+	policy := argoprojiov1alpha1.ResourcesFinalizerCascade
+	if syncPolicy != nil && syncPolicy.ResourcesFinalizer != "" {
+		policy = syncPolicy.ResourcesFinalizer
+	}
+
+	var finalizer string
+	if policy == argoprojiov1alpha1.ResourcesFinalizerCascade {
+		finalizer = utils.ResourcesFinalizerName
+	}
+
+	finalizers := []string{}
+	for _, f := range app.Finalizers {
+		if containsString(finalizers, f) {
+			continue
+		}
+		if f == finalizer || (f != utils.ResourcesFinalizerName && !strings.HasPrefix(f, utils.ResourcesFinalizerName+"/")) {
+			finalizers = append(finalizers, f)
+		}
+	}
+	if finalizer != "" && !containsString(finalizers, finalizer) {
+		finalizers = append(finalizers, finalizer)
+	}
+	app.Finalizers = finalizers
+}
+
+// hasFailed returns whether the statuses report that the Application failed with the message
+func hasFailed(statuses []argoprojiov1alpha1.ApplicationSetApplicationStatus, name string, message string) bool {
+	for _, status := range statuses {
+		if status.Name == name && status.LastAction == argoprojiov1alpha1.ApplicationSetApplicationActionFailed && status.Message == message {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, elem := range list {
+		if elem == s {
+			return true
+		}
+	}
+	return false
+}
+
+// usesParam returns whether the template, or the templatePatch, of the ApplicationSet refers to the param by its
+// name. The Jsonnet snippets are read from git, so they are assumed to use all the params.
+func usesParam(applicationSetInfo *argoprojiov1alpha1.ApplicationSet, template *argoprojiov1alpha1.ApplicationSetTemplate, key string) bool {
+	if applicationSetInfo.Spec.Jsonnet != nil {
+		return true
+	}
+	if patch := applicationSetInfo.Spec.TemplatePatch; patch != nil && strings.Contains(patch.Patch, key) {
+		return true
+	}
+
+	raw, err := json.Marshal(template)
+	return err != nil || strings.Contains(string(raw), key)
+}
+
+// setRevisionAnnotation records the git commit the Application was generated from, if any, so that
+// it can be audited. The date of the commit is only recorded when the generator read it.
+func setRevisionAnnotation(app *argov1alpha1.Application, params map[string]interface{}) {
+	sha, ok := params[utils.RevisionSHAKeyName]
+	if !ok {
+		return
+	}
+
+	annotation := map[string]interface{}{"sha": sha}
+	if date, ok := params[utils.RevisionDateKeyName]; ok {
+		annotation["date"] = date
+	}
+	revision, _ := json.Marshal(annotation)
+
+	if app.Annotations == nil {
+		app.Annotations = map[string]string{}
+	}
+	app.Annotations[utils.RevisionAnnotation] = string(revision)
 }
 
 func (r *ApplicationSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -208,15 +516,20 @@ func (r *ApplicationSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&argoprojiov1alpha1.ApplicationSet{}).
-		Owns(&argov1alpha1.Application{}).
+		For(&argoprojiov1alpha1.ApplicationSet{}, builder.WithPredicates(applicationSetPredicates())).
+		Owns(&argov1alpha1.Application{}, builder.WithPredicates(ownedApplicationPredicates(mgr.GetClient()))).
 		Watches(
 			&source.Kind{Type: &corev1.Secret{}},
 			&clusterSecretEventHandler{
 				Client: mgr.GetClient(),
 				Log:    log.WithField("type", "createSecretEventHandler"),
 			}).
-		// TODO: also watch Applications and respond on changes if we own them.
+		Watches(
+			&source.Kind{Type: &argoprojiov1alpha1.SharedApplicationSetTemplate{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.applicationSetsForTemplate)}).
+		Watches(
+			&source.Kind{Type: &argov1alpha1.Application{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.applicationSetsForReleasedApplication)}).
 		Complete(r)
 }
 
@@ -224,42 +537,87 @@ func (r *ApplicationSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
 // For new application it will call create
 // For application that need to update it will call update
 // The function also adds owner reference to all applications, and uses it for delete them.
-func (r *ApplicationSetReconciler) createOrUpdateInCluster(ctx context.Context, applicationSet argoprojiov1alpha1.ApplicationSet, desiredApplications []argov1alpha1.Application) error {
+// The action taken on each Application is returned, to be reported in the status of the ApplicationSet.
+func (r *ApplicationSetReconciler) createOrUpdateInCluster(ctx context.Context, applicationSet argoprojiov1alpha1.ApplicationSet, desiredApplications []argov1alpha1.Application) ([]argoprojiov1alpha1.ApplicationSetApplicationStatus, error) {
 
+	var res []argoprojiov1alpha1.ApplicationSetApplicationStatus
 	var firstError error
 	//create or updates the application in appList
 	for _, app := range desiredApplications {
 		appLog := log.WithFields(log.Fields{"app": app.Name, "appSet": applicationSet.Name})
 		app.Namespace = applicationSet.Namespace
 
-		found := app
+		// found is a deep copy, as reading the live Application into it must not change the generated one
+		found := *app.DeepCopy()
+		var adoption string
+		var conflict bool
 		action, err := utils.CreateOrUpdate(ctx, r.Client, &found, func() error {
-			found.Spec = app.Spec
-			return controllerutil.SetControllerReference(&applicationSet, &found, r.Scheme)
+			// The existing Applications the ApplicationSet doesn't control are only taken over per its adoptionPolicy,
+			// and never from another ApplicationSet still generating them
+			if found.ResourceVersion != "" {
+				err := r.checkApplicationSetConflict(ctx, &applicationSet, &found)
+				if err != nil {
+					conflict = true
+					return err
+				}
+				if adoption, err = adoptApplication(&applicationSet, &found); err != nil {
+					return err
+				}
+			}
+			return r.mutateApplication(&applicationSet, &found, &app)
 		})
 
 		if err != nil {
 			appLog.WithError(err).WithField("action", action).Errorf("failed to %s Application", action)
+			if conflict {
+				r.Recorder.Event(&applicationSet, core.EventTypeWarning, "NameConflict", err.Error())
+			}
 			if firstError == nil {
 				firstError = err
 			}
+			res = append(res, argoprojiov1alpha1.ApplicationSetApplicationStatus{
+				Name:       app.Name,
+				LastAction: argoprojiov1alpha1.ApplicationSetApplicationActionFailed,
+				Message:    err.Error(),
+			})
+			continue
+		}
+
+		if adoption != "" {
+			r.Recorder.Event(&applicationSet, core.EventTypeNormal, "Adopted", adoption)
+			appLog.Info(adoption)
+			res = append(res, argoprojiov1alpha1.ApplicationSetApplicationStatus{Name: app.Name, LastAction: argoprojiov1alpha1.ApplicationSetApplicationActionAdopted})
 			continue
 		}
 
 		r.Recorder.Eventf(&applicationSet, core.EventTypeNormal, fmt.Sprint(action), "%s Application %q", action, app.Name)
 		appLog.Logf(log.InfoLevel, "%s Application", action)
+		res = append(res, argoprojiov1alpha1.ApplicationSetApplicationStatus{Name: app.Name, LastAction: string(action)})
 	}
-	return firstError
+	return res, firstError
+}
+
+// mutateApplication sets the generated Application on the live one, before it's updated
+func (r *ApplicationSetReconciler) mutateApplication(applicationSet *argoprojiov1alpha1.ApplicationSet, found *argov1alpha1.Application, app *argov1alpha1.Application) error {
+	// The fields whose differences are ignored keep their live value
+	generated, err := utils.PreserveIgnoredFields(applicationSet.Spec.IgnoreApplicationDifferences, found, app)
+	if err != nil {
+		return err
+	}
+	found.Spec = generated.Spec
+	utils.MergeMetadata(&found.ObjectMeta, generated.ObjectMeta)
+	return controllerutil.SetControllerReference(applicationSet, found, r.Scheme)
 }
 
 // createInCluster will filter from the desiredApplications only the application that needs to be created
 // Then it will call createOrUpdateInCluster to do the actual create
-func (r *ApplicationSetReconciler) createInCluster(ctx context.Context, applicationSet argoprojiov1alpha1.ApplicationSet, desiredApplications []argov1alpha1.Application) error {
+func (r *ApplicationSetReconciler) createInCluster(ctx context.Context, applicationSet argoprojiov1alpha1.ApplicationSet, desiredApplications []argov1alpha1.Application) ([]argoprojiov1alpha1.ApplicationSetApplicationStatus, error) {
 
 	var createApps []argov1alpha1.Application
+	var res []argoprojiov1alpha1.ApplicationSetApplicationStatus
 	current, err := r.getCurrentApplications(ctx, applicationSet)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	m := make(map[string]bool) // Will holds the app names that are current in the cluster
@@ -274,10 +632,13 @@ func (r *ApplicationSetReconciler) createInCluster(ctx context.Context, applicat
 
 		if !exists {
 			createApps = append(createApps, app)
+		} else {
+			res = append(res, argoprojiov1alpha1.ApplicationSetApplicationStatus{Name: app.Name, LastAction: string(controllerutil.OperationResultNone)})
 		}
 	}
 
-	return r.createOrUpdateInCluster(ctx, applicationSet, createApps)
+	created, err := r.createOrUpdateInCluster(ctx, applicationSet, createApps)
+	return append(res, created...), err
 }
 
 func (r *ApplicationSetReconciler) getCurrentApplications(ctx context.Context, applicationSet argoprojiov1alpha1.ApplicationSet) ([]argov1alpha1.Application, error) {
@@ -307,17 +668,46 @@ func (r *ApplicationSetReconciler) deleteInCluster(ctx context.Context, applicat
 		m[app.Name] = true
 	}
 
+	// The Applications generated by the ApplicationSets adopting them are released rather than deleted
+	adopting, err := r.getAdoptingApplicationSets(ctx, &applicationSet)
+	if err != nil {
+		return err
+	}
+
+	// Mass deletions, e.g. when a generator returns nothing after an error, must be acknowledged
+	var deletions []string
+	for _, app := range current {
+		if !m[app.Name] && len(adopting[app.Name]) == 0 {
+			deletions = append(deletions, app.Name)
+		}
+	}
+	if err := r.checkDeletions(&applicationSet, deletions, len(current)); err != nil {
+		log.WithError(err).WithField("appSet", applicationSet.Name).Warn("blocked the deletion of Applications")
+		r.Recorder.Event(&applicationSet, core.EventTypeWarning, argoprojiov1alpha1.ApplicationSetReasonDeletionBlocked, err.Error())
+		return err
+	}
+
 	// Delete apps that are not in m[string]bool
 	var firstError error
 	for _, app := range current {
 		appLog := log.WithFields(log.Fields{"app": app.Name, "appSet": applicationSet.Name})
 		_, exists := m[app.Name]
 
-		if exists == false {
+		if exists == false && len(adopting[app.Name]) > 0 {
+			if err := r.releaseApplication(ctx, &applicationSet, &app); err != nil {
+				appLog.WithError(err).Error("failed to release Application")
+				if firstError == nil {
+					firstError = err
+				}
+				continue
+			}
+			r.Recorder.Eventf(&applicationSet, core.EventTypeNormal, "Released", "Released Application %q to ApplicationSet %s", app.Name, strings.Join(adopting[app.Name], ", "))
+			appLog.Log(log.InfoLevel, "Released application")
+		} else if exists == false {
 			err := r.Client.Delete(ctx, &app)
 			if err != nil {
 				appLog.WithError(err).Error("failed to delete Application")
-				if firstError != nil {
+				if firstError == nil {
 					firstError = err
 				}
 				continue
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/argoproj-labs/applicationset/pkg/generators"
+	"github.com/argoproj-labs/applicationset/pkg/utils"
 	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -14,6 +15,7 @@ import (
 	crtclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -24,10 +26,10 @@ type generatorMock struct {
 	mock.Mock
 }
 
-func (g *generatorMock) GenerateParams(appSetGenerator *argoprojiov1alpha1.ApplicationSetGenerator) ([]map[string]string, error) {
-	args := g.Called(appSetGenerator)
+func (g *generatorMock) GenerateParams(ctx context.Context, appSetGenerator *argoprojiov1alpha1.ApplicationSetGenerator) ([]map[string]interface{}, error) {
+	args := g.Called(ctx, appSetGenerator)
 
-	return args.Get(0).([]map[string]string), args.Error(1)
+	return args.Get(0).([]map[string]interface{}), args.Error(1)
 }
 
 type rendererMock struct {
@@ -40,7 +42,7 @@ func (g *generatorMock) GetRequeueAfter(appSetGenerator *argoprojiov1alpha1.Appl
 	return args.Get(0).(time.Duration)
 }
 
-func (r *rendererMock) RenderTemplateParams(tmpl *argov1alpha1.Application, params map[string]string) (*argov1alpha1.Application, error) {
+func (r *rendererMock) RenderTemplateParams(tmpl *argoprojiov1alpha1.ApplicationSetTemplate, params map[string]interface{}) (*argov1alpha1.Application, error) {
 	args := r.Called(tmpl, params)
 
 	if args.Error(1) != nil {
@@ -51,6 +53,12 @@ func (r *rendererMock) RenderTemplateParams(tmpl *argov1alpha1.Application, para
 
 }
 
+func (r *rendererMock) RenderYAML(str string, params map[string]interface{}) (interface{}, error) {
+	args := r.Called(str, params)
+
+	return args.Get(0), args.Error(1)
+}
+
 func TestExtractApplications(t *testing.T) {
 	scheme := runtime.NewScheme()
 	argoprojiov1alpha1.AddToScheme(scheme)
@@ -60,7 +68,7 @@ func TestExtractApplications(t *testing.T) {
 
 	for _, c := range []struct {
 		name				string
-		params				[]map[string]string
+		params				[]map[string]interface{}
 		template			argoprojiov1alpha1.ApplicationSetTemplate
 		generateParamsError	error
 		rendererError		error
@@ -68,14 +76,14 @@ func TestExtractApplications(t *testing.T) {
 	}{
 		{
 			name: 		"Generate two applications",
-			params: 	[]map[string]string{{"name": "app1"}, {"name": "app2"}},
+			params: 	[]map[string]interface{}{{"name": "app1"}, {"name": "app2"}},
 			template:	argoprojiov1alpha1.ApplicationSetTemplate{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:                       "name",
 					Namespace:                  "namespace",
 					Labels:                     map[string]string{ "label_name": "label_value"},
 				},
-				Spec:       argov1alpha1.ApplicationSpec{
+				Spec:       argoprojiov1alpha1.ApplicationTemplateSpec{
 
 				},
 			},
@@ -87,14 +95,14 @@ func TestExtractApplications(t *testing.T) {
 		},
 		{
 			name: 		"Handles error from the render",
-			params: 	[]map[string]string{{"name": "app1"}, {"name": "app2"}},
+			params: 	[]map[string]interface{}{{"name": "app1"}, {"name": "app2"}},
 			template:	argoprojiov1alpha1.ApplicationSetTemplate{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:                       "name",
 					Namespace:                  "namespace",
 					Labels:                     map[string]string{ "label_name": "label_value"},
 				},
-				Spec:       argov1alpha1.ApplicationSpec{
+				Spec:       argoprojiov1alpha1.ApplicationTemplateSpec{
 
 				},
 			},
@@ -106,6 +114,7 @@ func TestExtractApplications(t *testing.T) {
 		app := argov1alpha1.Application{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:                       "test",
+				Finalizers:                 []string{"resources-finalizer.argocd.argoproj.io"},
 			},
 		}
 
@@ -116,7 +125,7 @@ func TestExtractApplications(t *testing.T) {
 				List: &argoprojiov1alpha1.ListGenerator{},
 			}
 
-			generatorMock.On("GenerateParams", &generator).
+			generatorMock.On("GenerateParams", mock.Anything, &generator).
 				Return(cc.params, cc.generateParamsError)
 
 			rendererMock := rendererMock{}
@@ -127,10 +136,10 @@ func TestExtractApplications(t *testing.T) {
 				for _, p := range cc.params {
 
 					if cc.rendererError != nil {
-						rendererMock.On("RenderTemplateParams", getTempApplication(cc.template), p).
+						rendererMock.On("RenderTemplateParams", &cc.template, p).
 							Return(nil, cc.rendererError)
 					} else{
-						rendererMock.On("RenderTemplateParams", getTempApplication(cc.template), p).
+						rendererMock.On("RenderTemplateParams", &cc.template, p).
 							Return(&app, nil)
 						expectedApps = append(expectedApps, app)
 					}
@@ -147,7 +156,7 @@ func TestExtractApplications(t *testing.T) {
 				Renderer: &rendererMock,
 			}
 
-			got, err := r.generateApplications(argoprojiov1alpha1.ApplicationSet{
+			got, _, err := r.generateApplications(context.TODO(), argoprojiov1alpha1.ApplicationSet{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "name",
 					Namespace: "namespace",
@@ -225,9 +234,9 @@ func TestCreateOrUpdateInCluster(t *testing.T) {
 				},
 				Spec: argoprojiov1alpha1.ApplicationSetSpec{
 					Template: argoprojiov1alpha1.ApplicationSetTemplate{
-						Spec: argov1alpha1.ApplicationSpec{
+						Spec: argoprojiov1alpha1.ApplicationTemplateSpec{ApplicationSpec: argov1alpha1.ApplicationSpec{
 							Project: "project",
-						},
+						}},
 					},
 				},
 			},
@@ -282,9 +291,9 @@ func TestCreateOrUpdateInCluster(t *testing.T) {
 				},
 				Spec: argoprojiov1alpha1.ApplicationSetSpec{
 					Template: argoprojiov1alpha1.ApplicationSetTemplate{
-						Spec: argov1alpha1.ApplicationSpec{
+						Spec: argoprojiov1alpha1.ApplicationTemplateSpec{ApplicationSpec: argov1alpha1.ApplicationSpec{
 							Project: "project",
-						},
+						}},
 					},
 				},
 			},
@@ -331,6 +340,58 @@ func TestCreateOrUpdateInCluster(t *testing.T) {
 				},
 			},
 		},
+		{
+			appSet: argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "name",
+					Namespace: "namespace",
+				},
+			},
+			existsApps: []argov1alpha1.Application{
+				argov1alpha1.Application{
+					TypeMeta: metav1.TypeMeta{
+						Kind:       "Application",
+						APIVersion: "argoproj.io/v1alpha1",
+					},
+					ObjectMeta: metav1.ObjectMeta{
+						Name:            "app1",
+						Namespace:       "namespace",
+						ResourceVersion: "2",
+						Labels:          map[string]string{"team": "old", "env": "dev", "owner": "someone"},
+						Annotations: map[string]string{
+							"argocd.argoproj.io/refresh":        "normal",
+							utils.LastAppliedMetadataAnnotation: `{"labels":["env","team"]}`,
+						},
+					},
+				},
+			},
+			apps: []argov1alpha1.Application{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   "app1",
+						Labels: map[string]string{"team": "platform"},
+					},
+				},
+			},
+			expected: []argov1alpha1.Application{
+				{
+					TypeMeta: metav1.TypeMeta{
+						Kind:       "Application",
+						APIVersion: "argoproj.io/v1alpha1",
+					},
+					ObjectMeta: metav1.ObjectMeta{
+						Name:            "app1",
+						Namespace:       "namespace",
+						ResourceVersion: "3",
+						Labels:          map[string]string{"team": "platform", "owner": "someone"},
+						Annotations: map[string]string{
+							"argocd.argoproj.io/refresh":        "normal",
+							utils.LastAppliedMetadataAnnotation: `{"labels":["team"]}`,
+						},
+					},
+				},
+			},
+		},
 	} {
 		initObjs := []runtime.Object{&c.appSet}
 		for _, a := range c.existsApps {
@@ -412,9 +473,9 @@ func TestCreateApplications(t *testing.T) {
 				},
 				Spec: argoprojiov1alpha1.ApplicationSetSpec{
 					Template: argoprojiov1alpha1.ApplicationSetTemplate{
-						Spec: argov1alpha1.ApplicationSpec{
+						Spec: argoprojiov1alpha1.ApplicationTemplateSpec{ApplicationSpec: argov1alpha1.ApplicationSpec{
 							Project: "project",
-						},
+						}},
 					},
 				},
 			},
@@ -469,9 +530,9 @@ func TestCreateApplications(t *testing.T) {
 				},
 				Spec: argoprojiov1alpha1.ApplicationSetSpec{
 					Template: argoprojiov1alpha1.ApplicationSetTemplate{
-						Spec: argov1alpha1.ApplicationSpec{
+						Spec: argoprojiov1alpha1.ApplicationTemplateSpec{ApplicationSpec: argov1alpha1.ApplicationSpec{
 							Project: "project",
-						},
+						}},
 					},
 				},
 			},
@@ -571,9 +632,9 @@ func TestDeleteInCluster(t *testing.T) {
 				},
 				Spec: argoprojiov1alpha1.ApplicationSetSpec{
 					Template: argoprojiov1alpha1.ApplicationSetTemplate{
-						Spec: argov1alpha1.ApplicationSpec{
+						Spec: argoprojiov1alpha1.ApplicationTemplateSpec{ApplicationSpec: argov1alpha1.ApplicationSpec{
 							Project: "project",
-						},
+						}},
 					},
 				},
 			},
@@ -738,3 +799,595 @@ func TestGetMinRequeueAfter(t *testing.T) {
 
 	assert.Equal(t, time.Duration(1) * time.Second, got)
 }
+
+func TestSetRevisionAnnotation(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		app      argov1alpha1.Application
+		params   map[string]interface{}
+		expected map[string]string
+	}{
+		{
+			name:     "params without a revision leave the Application untouched",
+			params:   map[string]interface{}{"path": "app1"},
+			expected: nil,
+		},
+		{
+			name:   "revision is recorded",
+			params: map[string]interface{}{"path": "app1", "revision.sha": "sha", "revision.date": "2020-01-01T00:00:00Z"},
+			expected: map[string]string{
+				"applicationset.argoproj.io/revision": `{"date":"2020-01-01T00:00:00Z","sha":"sha"}`,
+			},
+		},
+		{
+			name:   "the date is left out when it wasn't read",
+			params: map[string]interface{}{"branch": "master", "revision.sha": "sha"},
+			expected: map[string]string{
+				"applicationset.argoproj.io/revision": `{"sha":"sha"}`,
+			},
+		},
+		{
+			name: "existing annotations are kept",
+			app: argov1alpha1.Application{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{"foo": "bar"},
+				},
+			},
+			params: map[string]interface{}{"revision.sha": "sha", "revision.date": "2020-01-01T00:00:00Z"},
+			expected: map[string]string{
+				"foo":                                 "bar",
+				"applicationset.argoproj.io/revision": `{"date":"2020-01-01T00:00:00Z","sha":"sha"}`,
+			},
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			setRevisionAnnotation(&cc.app, cc.params)
+
+			assert.Equal(t, cc.expected, cc.app.Annotations)
+		})
+	}
+}
+
+func TestUsesParam(t *testing.T) {
+	template := argoprojiov1alpha1.ApplicationSetTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "{{branch.slug}}",
+			Annotations: map[string]string{"date": "{{revision.date}}"},
+		},
+	}
+
+	for _, c := range []struct {
+		name     string
+		spec     argoprojiov1alpha1.ApplicationSetSpec
+		key      string
+		expected bool
+	}{
+		{
+			name:     "used by the template",
+			key:      "revision.date",
+			expected: true,
+		},
+		{
+			name:     "not used",
+			key:      "revision.sha",
+			expected: false,
+		},
+		{
+			name: "used by the templatePatch",
+			spec: argoprojiov1alpha1.ApplicationSetSpec{
+				TemplatePatch: &argoprojiov1alpha1.ApplicationSetTemplatePatch{Patch: `{spec: {source: {targetRevision: '{{revision.sha}}'}}}`},
+			},
+			key:      "revision.sha",
+			expected: true,
+		},
+		{
+			name: "Jsonnet snippets are assumed to use all the params",
+			spec: argoprojiov1alpha1.ApplicationSetSpec{
+				Jsonnet: &argoprojiov1alpha1.ApplicationSetJsonnet{},
+			},
+			key:      "revision.sha",
+			expected: true,
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			appSet := &argoprojiov1alpha1.ApplicationSet{Spec: cc.spec}
+
+			assert.Equal(t, cc.expected, usesParam(appSet, &template, cc.key))
+		})
+	}
+}
+
+// slowGenerator returns its params after a delay, tracking how many calls run concurrently in calls, if set.
+// Its fields are not modified by the calls, so that it can be read, e.g. logged, while they run.
+type slowGenerator struct {
+	delay time.Duration
+	// release, if set, blocks the calls until it's closed, whatever their context
+	release chan struct{}
+	params  []map[string]interface{}
+	calls   *generatorCalls
+}
+
+// generatorCalls tracks the calls of a generator running concurrently
+type generatorCalls struct {
+	running    int32
+	maxRunning int32
+}
+
+func (g *slowGenerator) GenerateParams(ctx context.Context, appSetGenerator *argoprojiov1alpha1.ApplicationSetGenerator) ([]map[string]interface{}, error) {
+	if g.calls != nil {
+		running := atomic.AddInt32(&g.calls.running, 1)
+		defer atomic.AddInt32(&g.calls.running, -1)
+		for {
+			max := atomic.LoadInt32(&g.calls.maxRunning)
+			if running <= max || atomic.CompareAndSwapInt32(&g.calls.maxRunning, max, running) {
+				break
+			}
+		}
+	}
+
+	if g.release != nil {
+		<-g.release
+		return g.params, nil
+	}
+
+	select {
+	case <-time.After(g.delay):
+		return g.params, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *slowGenerator) GetRequeueAfter(appSetGenerator *argoprojiov1alpha1.ApplicationSetGenerator) time.Duration {
+	return generators.NoRequeueAfter
+}
+
+func TestGenerateApplicationsConcurrently(t *testing.T) {
+	template := argoprojiov1alpha1.ApplicationSetTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "{{name}}",
+		},
+	}
+
+	t.Run("output keeps the order of the generators", func(t *testing.T) {
+		r := ApplicationSetReconciler{
+			Generators: map[string]generators.Generator{
+				"List":     &slowGenerator{delay: 50 * time.Millisecond, params: []map[string]interface{}{{"name": "slow"}}},
+				"Clusters": &slowGenerator{params: []map[string]interface{}{{"name": "fast"}}},
+			},
+			Renderer: &utils.Render{},
+		}
+
+		got, _, err := r.generateApplications(context.TODO(), argoprojiov1alpha1.ApplicationSet{
+			Spec: argoprojiov1alpha1.ApplicationSetSpec{
+				Generators: []argoprojiov1alpha1.ApplicationSetGenerator{
+					{List: &argoprojiov1alpha1.ListGenerator{}},
+					{Clusters: &argoprojiov1alpha1.ClusterGenerator{}},
+				},
+				Template: template,
+			},
+		})
+
+		assert.NoError(t, err)
+		if assert.Len(t, got, 2) {
+			assert.Equal(t, "slow", got[0].Name)
+			assert.Equal(t, "fast", got[1].Name)
+		}
+	})
+
+	t.Run("concurrency is bounded", func(t *testing.T) {
+		calls := &generatorCalls{}
+		g := &slowGenerator{delay: 20 * time.Millisecond, params: []map[string]interface{}{{"name": "app"}}, calls: calls}
+		r := ApplicationSetReconciler{
+			Generators: map[string]generators.Generator{
+				"List": g,
+			},
+			Renderer:                &utils.Render{},
+			MaxConcurrentGenerators: 2,
+		}
+
+		requested := []argoprojiov1alpha1.ApplicationSetGenerator{}
+		for i := 0; i < 5; i++ {
+			requested = append(requested, argoprojiov1alpha1.ApplicationSetGenerator{List: &argoprojiov1alpha1.ListGenerator{}})
+		}
+
+		got, _, err := r.generateApplications(context.TODO(), argoprojiov1alpha1.ApplicationSet{
+			Spec: argoprojiov1alpha1.ApplicationSetSpec{
+				Generators: requested,
+				Template:   template,
+			},
+		})
+
+		assert.NoError(t, err)
+		assert.Len(t, got, 5)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls.maxRunning))
+	})
+
+	t.Run("generators time out", func(t *testing.T) {
+		// The generator ignoring its context is only released once generateApplications returned, which it
+		// therefore must do without waiting for it
+		release := make(chan struct{})
+		defer close(release)
+		r := ApplicationSetReconciler{
+			Generators: map[string]generators.Generator{
+				"List":     &slowGenerator{delay: time.Hour, params: []map[string]interface{}{{"name": "list"}}},
+				"Clusters": &slowGenerator{release: release, params: []map[string]interface{}{{"name": "clusters"}}},
+				"Git":      &slowGenerator{params: []map[string]interface{}{{"name": "git"}}},
+			},
+			Renderer:         &utils.Render{},
+			GeneratorTimeout: 10 * time.Millisecond,
+		}
+
+		got, _, err := r.generateApplications(context.TODO(), argoprojiov1alpha1.ApplicationSet{
+			Spec: argoprojiov1alpha1.ApplicationSetSpec{
+				Generators: []argoprojiov1alpha1.ApplicationSetGenerator{
+					{List: &argoprojiov1alpha1.ListGenerator{}},
+					{Clusters: &argoprojiov1alpha1.ClusterGenerator{}},
+					{Git: &argoprojiov1alpha1.GitGenerator{}},
+				},
+				Template: template,
+			},
+		})
+
+		assert.EqualError(t, err, "generator did not complete: context deadline exceeded")
+		if assert.Len(t, got, 1) {
+			assert.Equal(t, "git", got[0].Name)
+		}
+	})
+}
+
+func TestGenerateApplicationsGoTemplate(t *testing.T) {
+	r := ApplicationSetReconciler{
+		Generators: map[string]generators.Generator{
+			"List": &slowGenerator{params: []map[string]interface{}{{"name": "App"}}},
+		},
+		Renderer: &utils.Render{},
+	}
+
+	got, _, err := r.generateApplications(context.TODO(), argoprojiov1alpha1.ApplicationSet{
+		Spec: argoprojiov1alpha1.ApplicationSetSpec{
+			Generators: []argoprojiov1alpha1.ApplicationSetGenerator{{List: &argoprojiov1alpha1.ListGenerator{}}},
+			Template: argoprojiov1alpha1.ApplicationSetTemplate{
+				ObjectMeta: metav1.ObjectMeta{Name: "{{ .name | lower }}"},
+			},
+			GoTemplate: true,
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, got, 1)
+	assert.Equal(t, "app", got[0].Name)
+}
+
+func TestGenerateApplicationsStrictParams(t *testing.T) {
+	strict := true
+	notStrict := false
+
+	for _, c := range []struct {
+		name          string
+		defaultStrict bool
+		strictParams  *bool
+		goTemplate    bool
+		expectedError string
+	}{
+		{name: "not strict by default"},
+		{name: "strict by default", defaultStrict: true, expectedError: "failed to render application from the params of generators[1].list: unresolved params: missing"},
+		{name: "strict ApplicationSet", strictParams: &strict, expectedError: "failed to render application from the params of generators[1].list: unresolved params: missing"},
+		{name: "not strict ApplicationSet", defaultStrict: true, strictParams: &notStrict},
+		{name: "strict goTemplate", strictParams: &strict, goTemplate: true, expectedError: "failed to render application from the params of generators[1].list: unresolved params: missing"},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			r := ApplicationSetReconciler{
+				Generators: map[string]generators.Generator{
+					"Clusters": &slowGenerator{},
+					"List":     &slowGenerator{params: []map[string]interface{}{{"name": "app"}}},
+				},
+				Renderer:     &utils.Render{},
+				StrictParams: cc.defaultStrict,
+			}
+
+			name := "{{name}}{{missing}}"
+			if cc.goTemplate {
+				name = "{{ .name }}{{ .missing }}"
+			}
+			_, _, err := r.generateApplications(context.TODO(), argoprojiov1alpha1.ApplicationSet{
+				Spec: argoprojiov1alpha1.ApplicationSetSpec{
+					Generators: []argoprojiov1alpha1.ApplicationSetGenerator{
+						{Clusters: &argoprojiov1alpha1.ClusterGenerator{}},
+						{List: &argoprojiov1alpha1.ListGenerator{}},
+					},
+					Template: argoprojiov1alpha1.ApplicationSetTemplate{
+						ObjectMeta: metav1.ObjectMeta{Name: name},
+					},
+					GoTemplate:   cc.goTemplate,
+					StrictParams: cc.strictParams,
+				},
+			})
+
+			if cc.expectedError == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), cc.expectedError)
+			}
+		})
+	}
+}
+
+func TestGenerateApplicationsNormalizeNames(t *testing.T) {
+	for _, c := range []struct {
+		name           string
+		normalizeNames bool
+		// identical renders the same Application from all the params, but for its name
+		identical      bool
+		params         []map[string]interface{}
+		expectedNames  []string
+		expectedError  bool
+		expectedEvent  string
+	}{
+		{
+			name:          "names are kept as is by default",
+			params:        []map[string]interface{}{{"name": "Feature/Foo"}},
+			expectedNames: []string{"Feature/Foo"},
+		},
+		{
+			name:           "names are normalized",
+			normalizeNames: true,
+			params:         []map[string]interface{}{{"name": "Feature/Foo"}, {"name": "feature/bar"}},
+			expectedNames:  []string{"feature-foo", "feature-bar"},
+		},
+		{
+			name:           "collisions are reported",
+			normalizeNames: true,
+			params:         []map[string]interface{}{{"name": "feature/foo"}, {"name": "Feature_Foo"}, {"name": "bar"}},
+			expectedNames:  []string{"bar"},
+			expectedError:  true,
+			expectedEvent:  `Warning NameCollision 2 different names are normalized to the name "feature-foo": "feature/foo", "Feature_Foo"`,
+		},
+		{
+			name:           "collisions of identical Applications are reported",
+			normalizeNames: true,
+			identical:      true,
+			params:         []map[string]interface{}{{"name": "feature/foo"}, {"name": "Feature_Foo"}, {"name": "bar"}},
+			expectedNames:  []string{"bar"},
+			expectedError:  true,
+			expectedEvent:  `Warning NameCollision 2 different names are normalized to the name "feature-foo": "feature/foo", "Feature_Foo"`,
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(1)
+			r := ApplicationSetReconciler{
+				Generators: map[string]generators.Generator{
+					"List": &slowGenerator{params: cc.params},
+				},
+				Renderer: &utils.Render{},
+				Recorder: recorder,
+			}
+
+			appSet := argoprojiov1alpha1.ApplicationSet{
+				Spec: argoprojiov1alpha1.ApplicationSetSpec{
+					Generators: []argoprojiov1alpha1.ApplicationSetGenerator{{List: &argoprojiov1alpha1.ListGenerator{}}},
+					Template: argoprojiov1alpha1.ApplicationSetTemplate{
+						ObjectMeta: metav1.ObjectMeta{Name: "{{name}}", Annotations: map[string]string{"rendered-name": "{{name}}"}},
+					},
+					NormalizeNames: cc.normalizeNames,
+				},
+			}
+			if cc.identical {
+				appSet.Spec.Template.Annotations = nil
+			}
+			got, _, err := r.generateApplications(context.TODO(), appSet)
+			assert.NoError(t, err)
+			// The colliding normalized names are refused as the other collisions
+			got, _, err = r.refuseNameCollisions(&appSet, got)
+
+			if cc.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			var names []string
+			for _, app := range got {
+				names = append(names, app.Name)
+			}
+			assert.Equal(t, cc.expectedNames, names)
+			if cc.expectedEvent != "" {
+				assert.Equal(t, cc.expectedEvent, <-recorder.Events)
+			}
+		})
+	}
+}
+
+func TestSetResourcesFinalizer(t *testing.T) {
+	for _, c := range []struct {
+		name       string
+		finalizers []string
+		syncPolicy *argoprojiov1alpha1.ApplicationSetSyncPolicy
+		expected   []string
+	}{
+		{
+			name:     "cascade by default",
+			expected: []string{"resources-finalizer.argocd.argoproj.io"},
+		},
+		{
+			name:       "cascade without sync policy finalizer",
+			syncPolicy: &argoprojiov1alpha1.ApplicationSetSyncPolicy{SkipPrune: true},
+			expected:   []string{"resources-finalizer.argocd.argoproj.io"},
+		},
+		{
+			name:       "finalizer listed in the template is not duplicated",
+			finalizers: []string{"resources-finalizer.argocd.argoproj.io", "other", "resources-finalizer.argocd.argoproj.io"},
+			expected:   []string{"resources-finalizer.argocd.argoproj.io", "other"},
+		},
+		{
+			name:       "variants of the template unknown to Argo CD are removed",
+			finalizers: []string{"resources-finalizer.argocd.argoproj.io/background", "other"},
+			syncPolicy: &argoprojiov1alpha1.ApplicationSetSyncPolicy{ResourcesFinalizer: argoprojiov1alpha1.ResourcesFinalizerCascade},
+			expected:   []string{"other", "resources-finalizer.argocd.argoproj.io"},
+		},
+		{
+			name:       "none",
+			finalizers: []string{"resources-finalizer.argocd.argoproj.io/foreground", "other"},
+			syncPolicy: &argoprojiov1alpha1.ApplicationSetSyncPolicy{ResourcesFinalizer: argoprojiov1alpha1.ResourcesFinalizerNone},
+			expected:   []string{"other"},
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			app := argov1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Finalizers: cc.finalizers}}
+
+			setResourcesFinalizer(&app, cc.syncPolicy)
+
+			assert.Equal(t, cc.expected, app.Finalizers)
+		})
+	}
+}
+
+func TestGenerateApplicationsTemplatePatch(t *testing.T) {
+	recorder := record.NewFakeRecorder(1)
+	r := ApplicationSetReconciler{
+		Generators: map[string]generators.Generator{
+			"List": &slowGenerator{params: []map[string]interface{}{{"name": "dev", "tier": "silver"}, {"name": "prod", "tier": "bronze"}}},
+		},
+		Renderer: &utils.Render{},
+		Recorder: recorder,
+	}
+	appSet := argoprojiov1alpha1.ApplicationSet{
+		Spec: argoprojiov1alpha1.ApplicationSetSpec{
+			Generators: []argoprojiov1alpha1.ApplicationSetGenerator{{List: &argoprojiov1alpha1.ListGenerator{}}},
+			Template: argoprojiov1alpha1.ApplicationSetTemplate{
+				ObjectMeta: metav1.ObjectMeta{Name: "{{name}}", Labels: map[string]string{"tier": "silver"}},
+			},
+			TemplatePatch: &argoprojiov1alpha1.ApplicationSetTemplatePatch{
+				Type: argoprojiov1alpha1.TemplatePatchTypeJSON,
+				// The test operation fails for prod
+				Patch: `[{op: test, path: /metadata/labels/tier, value: '{{tier}}'}, {op: replace, path: /metadata/labels/tier, value: gold}]`,
+			},
+		},
+	}
+
+	got, failed, err := r.generateApplications(context.TODO(), appSet)
+
+	assert.Error(t, err)
+	if assert.Len(t, got, 1) {
+		assert.Equal(t, "dev", got[0].Name)
+		assert.Equal(t, map[string]string{"tier": "gold"}, got[0].Labels)
+	}
+	if assert.Len(t, failed, 1) {
+		assert.Equal(t, "prod", failed[0].Name)
+		assert.Equal(t, argoprojiov1alpha1.ApplicationSetApplicationActionFailed, failed[0].LastAction)
+		assert.Equal(t, err.Error(), failed[0].Message)
+	}
+	select {
+	case event := <-recorder.Events:
+		assert.Contains(t, event, `Warning TemplatePatchFailed failed to apply templatePatch to Application "prod"`)
+	default:
+		t.Error("expected a TemplatePatchFailed event")
+	}
+
+	// The failure already reported in the status isn't reported by another Event
+	appSet.Status.Applications = failed
+	_, failed, err = r.generateApplications(context.TODO(), appSet)
+
+	assert.Error(t, err)
+	assert.Len(t, failed, 1)
+	select {
+	case event := <-recorder.Events:
+		t.Errorf("unexpected event %s", event)
+	default:
+	}
+}
+
+func TestCreateOrUpdateInClusterIgnoreDifferences(t *testing.T) {
+	scheme := runtime.NewScheme()
+	argoprojiov1alpha1.AddToScheme(scheme)
+	argov1alpha1.AddToScheme(scheme)
+
+	appSet := argoprojiov1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "name",
+			Namespace: "namespace",
+		},
+		Spec: argoprojiov1alpha1.ApplicationSetSpec{
+			IgnoreApplicationDifferences: []argoprojiov1alpha1.ApplicationSetIgnoreDifferences{
+				{JSONPointers: []string{"/spec/syncPolicy"}},
+				{Name: "app1", JQPathExpressions: []string{`.spec.source.helm.parameters[] | select(.name == "replicas")`}},
+			},
+		},
+	}
+
+	live := func(name string) *argov1alpha1.Application {
+		app := &argov1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "namespace",
+			},
+			Spec: argov1alpha1.ApplicationSpec{
+				Project: "default",
+				Source: argov1alpha1.ApplicationSource{
+					Helm: &argov1alpha1.ApplicationSourceHelm{
+						Parameters: []argov1alpha1.HelmParameter{{Name: "replicas", Value: "5"}},
+					},
+				},
+				SyncPolicy: &argov1alpha1.SyncPolicy{Automated: &argov1alpha1.SyncPolicyAutomated{Prune: true}},
+			},
+		}
+		_ = controllerutil.SetControllerReference(&appSet, app, scheme)
+		return app
+	}
+	generated := func(name string, project string) argov1alpha1.Application {
+		return argov1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+			},
+			Spec: argov1alpha1.ApplicationSpec{
+				Project: project,
+				Source: argov1alpha1.ApplicationSource{
+					Helm: &argov1alpha1.ApplicationSourceHelm{
+						Parameters: []argov1alpha1.HelmParameter{{Name: "replicas", Value: "1"}},
+					},
+				},
+			},
+		}
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme, &appSet, live("app1"), live("app2"), live("app3"))
+	r := ApplicationSetReconciler{
+		Client:   client,
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+	}
+
+	res, err := r.createOrUpdateInCluster(context.TODO(), appSet, []argov1alpha1.Application{
+		generated("app1", "default"),
+		generated("app2", "default"),
+		generated("app3", "other"),
+	})
+	assert.NoError(t, err)
+
+	// app1 only differs in ignored fields, app2 in its helm parameters and app3 in its project
+	assert.Equal(t, []argoprojiov1alpha1.ApplicationSetApplicationStatus{
+		{Name: "app1", LastAction: string(controllerutil.OperationResultNone)},
+		{Name: "app2", LastAction: string(controllerutil.OperationResultUpdated)},
+		{Name: "app3", LastAction: string(controllerutil.OperationResultUpdated)},
+	}, res)
+
+	for _, c := range []struct {
+		name     string
+		project  string
+		replicas string
+	}{
+		{name: "app1", project: "default", replicas: "5"},
+		{name: "app2", project: "default", replicas: "1"},
+		{name: "app3", project: "other", replicas: "1"},
+	} {
+		got := &argov1alpha1.Application{}
+		assert.NoError(t, client.Get(context.Background(), crtclient.ObjectKey{Namespace: "namespace", Name: c.name}, got))
+		assert.Equal(t, c.project, got.Spec.Project, c.name)
+		assert.Equal(t, c.replicas, got.Spec.Source.Helm.Parameters[0].Value, c.name)
+		assert.Equal(t, &argov1alpha1.SyncPolicy{Automated: &argov1alpha1.SyncPolicyAutomated{Prune: true}}, got.Spec.SyncPolicy, c.name)
+	}
+}
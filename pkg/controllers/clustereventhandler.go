@@ -2,10 +2,12 @@ package controllers
 
 import (
 	"context"
+	"reflect"
 
 	log "github.com/sirupsen/logrus"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -28,8 +30,10 @@ func (h *clusterSecretEventHandler) Create(e event.CreateEvent, q workqueue.Rate
 	h.queueRelatedAppGenerators(q, e.Meta)
 }
 
+// Update queues the ApplicationSets matching either the old or the new labels of the Secret, so that the
+// ApplicationSets which stop matching it are queued too
 func (h *clusterSecretEventHandler) Update(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
-	h.queueRelatedAppGenerators(q, e.MetaNew)
+	h.queueRelatedAppGenerators(q, e.MetaOld, e.MetaNew)
 }
 
 func (h *clusterSecretEventHandler) Delete(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
@@ -40,15 +44,22 @@ func (h *clusterSecretEventHandler) Generic(e event.GenericEvent, q workqueue.Ra
 	h.queueRelatedAppGenerators(q, e.Meta)
 }
 
-func (h *clusterSecretEventHandler) queueRelatedAppGenerators(q workqueue.RateLimitingInterface, meta metav1.Object) {
-	// Check for label, lookup all ApplicationSets that might match the cluster, queue them all
-	if meta.GetLabels()[generators.ArgoCDSecretTypeLabel] != generators.ArgoCDSecretTypeCluster {
+// queueRelatedAppGenerators queues the ApplicationSets having a cluster generator whose selector matches the
+// labels of any of the versions of a cluster Secret
+func (h *clusterSecretEventHandler) queueRelatedAppGenerators(q workqueue.RateLimitingInterface, metas ...metav1.Object) {
+	var clusterLabels []labels.Set
+	for _, meta := range metas {
+		if meta.GetLabels()[generators.ArgoCDSecretTypeLabel] == generators.ArgoCDSecretTypeCluster {
+			clusterLabels = append(clusterLabels, labels.Set(meta.GetLabels()))
+		}
+	}
+	if len(clusterLabels) == 0 {
 		return
 	}
 
 	h.Log.WithFields(log.Fields{
-		"namespace": meta.GetNamespace(),
-		"name":      meta.GetName(),
+		"namespace": metas[0].GetNamespace(),
+		"name":      metas[0].GetName(),
 	}).Info("processing event for cluster secret")
 
 	appSetList := &argoprojiov1alpha1.ApplicationSetList{}
@@ -59,17 +70,62 @@ func (h *clusterSecretEventHandler) queueRelatedAppGenerators(q workqueue.RateLi
 	}
 	h.Log.WithField("count", len(appSetList.Items)).Info("listed ApplicationSets")
 	for _, appSet := range appSetList.Items {
-		foundClusterGenerator := false
-		for _, generator := range appSet.Spec.Generators {
-			if generator.Clusters != nil {
-				foundClusterGenerator = true
-				break
-			}
-		}
-		if foundClusterGenerator {
-			// TODO: only queue the AppGenerator if the labels match this cluster
+		if clusterGeneratorsMatch(h.Log, &appSet, clusterLabels) {
 			req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: appSet.Namespace, Name: appSet.Name}}
 			q.Add(req)
 		}
 	}
 }
+
+// clusterGeneratorsMatch returns whether the selector of any cluster generator of the ApplicationSet, including
+// those nested in other generators, matches any of the labels
+func clusterGeneratorsMatch(logger log.FieldLogger, appSet *argoprojiov1alpha1.ApplicationSet, clusterLabels []labels.Set) bool {
+	for _, clusterGenerator := range findClusterGenerators(reflect.ValueOf(appSet.Spec.Generators)) {
+		selector, err := metav1.LabelSelectorAsSelector(&clusterGenerator.Selector)
+		if err != nil {
+			// The ApplicationSet is queued anyway, so that the invalid selector is reported
+			logger.WithError(err).WithField("applicationset", appSet.Name).Warn("invalid cluster generator selector")
+			return true
+		}
+		for _, set := range clusterLabels {
+			if selector.Matches(set) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findClusterGenerators returns the cluster generators found in a value, recursively, so that the generators
+// nested in other generators are found too
+func findClusterGenerators(v reflect.Value) []*argoprojiov1alpha1.ClusterGenerator {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		if clusterGenerator, ok := v.Interface().(*argoprojiov1alpha1.ClusterGenerator); ok {
+			return []*argoprojiov1alpha1.ClusterGenerator{clusterGenerator}
+		}
+		return findClusterGenerators(v.Elem())
+	case reflect.Struct:
+		var res []*argoprojiov1alpha1.ClusterGenerator
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			res = append(res, findClusterGenerators(v.Field(i))...)
+		}
+		return res
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		var res []*argoprojiov1alpha1.ClusterGenerator
+		for i := 0; i < v.Len(); i++ {
+			res = append(res, findClusterGenerators(v.Index(i))...)
+		}
+		return res
+	}
+	return nil
+}
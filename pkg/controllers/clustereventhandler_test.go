@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	"github.com/argoproj-labs/applicationset/pkg/generators"
+)
+
+func TestClusterSecretEventHandler(t *testing.T) {
+	scheme := runtime.NewScheme()
+	argoprojiov1alpha1.AddToScheme(scheme)
+	argov1alpha1.AddToScheme(scheme)
+
+	appSet := func(name string, generators ...argoprojiov1alpha1.ApplicationSetGenerator) *argoprojiov1alpha1.ApplicationSet {
+		return &argoprojiov1alpha1.ApplicationSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "argocd"},
+			Spec:       argoprojiov1alpha1.ApplicationSetSpec{Generators: generators},
+		}
+	}
+	clusters := func(selector metav1.LabelSelector) argoprojiov1alpha1.ApplicationSetGenerator {
+		return argoprojiov1alpha1.ApplicationSetGenerator{Clusters: &argoprojiov1alpha1.ClusterGenerator{Selector: selector}}
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme,
+		appSet("all", clusters(metav1.LabelSelector{})),
+		appSet("prod", clusters(metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}})),
+		appSet("staging", clusters(metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "env", Operator: metav1.LabelSelectorOpIn, Values: []string{"staging"}},
+		}})),
+		appSet("list", argoprojiov1alpha1.ApplicationSetGenerator{List: &argoprojiov1alpha1.ListGenerator{}}),
+		appSet("invalid", clusters(metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "env", Operator: "invalid"},
+		}})),
+	)
+
+	secret := func(labels map[string]string) *corev1.Secret {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "argocd", Labels: labels}}
+	}
+	clusterSecret := func(env string) *corev1.Secret {
+		return secret(map[string]string{generators.ArgoCDSecretTypeLabel: generators.ArgoCDSecretTypeCluster, "env": env})
+	}
+
+	for _, c := range []struct {
+		name     string
+		send     func(h *clusterSecretEventHandler, q workqueue.RateLimitingInterface)
+		expected []string
+	}{
+		{
+			name: "create",
+			send: func(h *clusterSecretEventHandler, q workqueue.RateLimitingInterface) {
+				s := clusterSecret("prod")
+				h.Create(event.CreateEvent{Meta: s, Object: s}, q)
+			},
+			expected: []string{"all", "invalid", "prod"},
+		},
+		{
+			name: "update matches the old and new labels",
+			send: func(h *clusterSecretEventHandler, q workqueue.RateLimitingInterface) {
+				oldSecret, newSecret := clusterSecret("prod"), clusterSecret("staging")
+				h.Update(event.UpdateEvent{MetaOld: oldSecret, ObjectOld: oldSecret, MetaNew: newSecret, ObjectNew: newSecret}, q)
+			},
+			expected: []string{"all", "invalid", "prod", "staging"},
+		},
+		{
+			name: "delete",
+			send: func(h *clusterSecretEventHandler, q workqueue.RateLimitingInterface) {
+				s := clusterSecret("dev")
+				h.Delete(event.DeleteEvent{Meta: s, Object: s}, q)
+			},
+			expected: []string{"all", "invalid"},
+		},
+		{
+			name: "not a cluster secret",
+			send: func(h *clusterSecretEventHandler, q workqueue.RateLimitingInterface) {
+				s := secret(map[string]string{"env": "prod"})
+				h.Create(event.CreateEvent{Meta: s, Object: s}, q)
+			},
+			expected: nil,
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			h := &clusterSecretEventHandler{Client: client, Log: log.WithField("type", "test")}
+			q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+			defer q.ShutDown()
+
+			cc.send(h, q)
+
+			var got []string
+			for q.Len() > 0 {
+				item, _ := q.Get()
+				got = append(got, item.(ctrl.Request).Name)
+				q.Done(item)
+			}
+			sort.Strings(got)
+			assert.Equal(t, cc.expected, got)
+		})
+	}
+}
+
+func TestFindClusterGenerators(t *testing.T) {
+	first := &argoprojiov1alpha1.ClusterGenerator{Selector: metav1.LabelSelector{MatchLabels: map[string]string{"a": "1"}}}
+	nested := &argoprojiov1alpha1.ClusterGenerator{Selector: metav1.LabelSelector{MatchLabels: map[string]string{"b": "2"}}}
+
+	// compositeGenerator stands for generators combining other generators
+	type compositeGenerator struct {
+		Generators []argoprojiov1alpha1.ApplicationSetGenerator
+	}
+	generators := []interface{}{
+		argoprojiov1alpha1.ApplicationSetGenerator{Clusters: first},
+		argoprojiov1alpha1.ApplicationSetGenerator{List: &argoprojiov1alpha1.ListGenerator{}},
+		&compositeGenerator{Generators: []argoprojiov1alpha1.ApplicationSetGenerator{{Clusters: nested}}},
+	}
+
+	var res []*argoprojiov1alpha1.ClusterGenerator
+	for _, g := range generators {
+		res = append(res, findClusterGenerators(reflect.ValueOf(g))...)
+	}
+	assert.Equal(t, []*argoprojiov1alpha1.ClusterGenerator{first, nested}, res)
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/kubernetes/pkg/apis/core"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	"github.com/argoproj-labs/applicationset/pkg/utils"
+)
+
+// refuseNameCollisions removes the Applications generated several times with the same name, e.g. by two param
+// sets of different generators, as none of them is the one to create. Identical Applications are kept once. With
+// normalizeNames, the names are normalized first, and the Applications generated with different names which are
+// normalized to the same one are refused too, even when they're identical, as they come from different params.
+// The refused Applications are reported by a NameCollision Event, and returned with the failed action, along with
+// the error of the first collision.
+func (r *ApplicationSetReconciler) refuseNameCollisions(applicationSet *argoprojiov1alpha1.ApplicationSet, desiredApplications []argov1alpha1.Application) ([]argov1alpha1.Application, []argoprojiov1alpha1.ApplicationSetApplicationStatus, error) {
+	generated := map[string][]argov1alpha1.Application{}
+	// generatedNames keeps the different names each name is normalized from, in the order they're generated
+	generatedNames := map[string][]string{}
+	var names []string
+	for _, app := range desiredApplications {
+		generatedName := app.Name
+		if applicationSet.Spec.NormalizeNames {
+			app.Name = utils.NormalizeName(app.Name)
+		}
+		if _, ok := generated[app.Name]; !ok {
+			names = append(names, app.Name)
+		}
+		if !containsApplication(generated[app.Name], app) {
+			generated[app.Name] = append(generated[app.Name], app)
+		}
+		if !containsString(generatedNames[app.Name], generatedName) {
+			generatedNames[app.Name] = append(generatedNames[app.Name], generatedName)
+		}
+	}
+
+	var res []argov1alpha1.Application
+	var statuses []argoprojiov1alpha1.ApplicationSetApplicationStatus
+	var firstError error
+	for _, name := range names {
+		apps := generated[name]
+		var err error
+		switch {
+		case len(generatedNames[name]) > 1:
+			err = fmt.Errorf("%d different names are normalized to the name %q: %s", len(generatedNames[name]), name, quoteNames(generatedNames[name]))
+		case len(apps) > 1:
+			err = fmt.Errorf("%d different Applications are generated with the name %q", len(apps), name)
+		default:
+			res = append(res, apps[0])
+			continue
+		}
+
+		log.WithError(err).WithField("appSet", applicationSet.Name).Error("refused colliding Applications")
+		r.Recorder.Event(applicationSet, core.EventTypeWarning, "NameCollision", err.Error())
+		statuses = append(statuses, argoprojiov1alpha1.ApplicationSetApplicationStatus{
+			Name:       name,
+			LastAction: argoprojiov1alpha1.ApplicationSetApplicationActionFailed,
+			Message:    err.Error(),
+		})
+		if firstError == nil {
+			firstError = err
+		}
+	}
+	return res, statuses, firstError
+}
+
+// containsApplication returns whether the list contains an Application equal to the given one
+func containsApplication(apps []argov1alpha1.Application, app argov1alpha1.Application) bool {
+	for i := range apps {
+		if utils.Equal(&apps[i], &app) {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteNames returns the names quoted and separated by commas, e.g. '"feature/foo", "Feature_Foo"'
+func quoteNames(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = strconv.Quote(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// checkApplicationSetConflict returns an error when the existing Application is controlled by another
+// ApplicationSet which still generates it, so that two ApplicationSets generating the same name don't take it
+// from each other on each reconciliation, whatever their adoptionPolicy. The ApplicationSet named by adoptFrom
+// hands its Applications over instead, and those of a deleted ApplicationSet are left to the adoptionPolicy.
+func (r *ApplicationSetReconciler) checkApplicationSetConflict(ctx context.Context, applicationSet *argoprojiov1alpha1.ApplicationSet, app *argov1alpha1.Application) error {
+	owner := metav1.GetControllerOf(app)
+	if owner == nil || owner.Kind != "ApplicationSet" || isControlledBy(app, applicationSet) || owner.Name == getAdoptFrom(applicationSet) {
+		return nil
+	}
+
+	var other argoprojiov1alpha1.ApplicationSet
+	if err := r.Get(ctx, types.NamespacedName{Namespace: applicationSet.Namespace, Name: owner.Name}, &other); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if other.UID != owner.UID || !other.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	for _, status := range other.Status.Applications {
+		if status.Name == app.Name && status.LastAction != argoprojiov1alpha1.ApplicationSetApplicationActionFailed {
+			return fmt.Errorf("Application %q is already generated by ApplicationSet %q", app.Name, other.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+)
+
+func TestRefuseNameCollisions(t *testing.T) {
+	app := func(name string, project string) argov1alpha1.Application {
+		return argov1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       argov1alpha1.ApplicationSpec{Project: project},
+		}
+	}
+
+	for _, c := range []struct {
+		name             string
+		apps             []argov1alpha1.Application
+		expectedApps     []argov1alpha1.Application
+		expectedStatuses []argoprojiov1alpha1.ApplicationSetApplicationStatus
+		normalizeNames   bool
+		expectedEvent    string
+	}{
+		{
+			name:         "no collision",
+			apps:         []argov1alpha1.Application{app("a", "default"), app("b", "default")},
+			expectedApps: []argov1alpha1.Application{app("a", "default"), app("b", "default")},
+		},
+		{
+			name:         "identical Applications are kept once",
+			apps:         []argov1alpha1.Application{app("a", "default"), app("b", "default"), app("a", "default")},
+			expectedApps: []argov1alpha1.Application{app("a", "default"), app("b", "default")},
+		},
+		{
+			name:         "different Applications are refused",
+			apps:         []argov1alpha1.Application{app("a", "one"), app("b", "default"), app("a", "two"), app("a", "one")},
+			expectedApps: []argov1alpha1.Application{app("b", "default")},
+			expectedStatuses: []argoprojiov1alpha1.ApplicationSetApplicationStatus{{
+				Name:       "a",
+				LastAction: argoprojiov1alpha1.ApplicationSetApplicationActionFailed,
+				Message:    `2 different Applications are generated with the name "a"`,
+			}},
+			expectedEvent: `Warning NameCollision 2 different Applications are generated with the name "a"`,
+		},
+		{
+			name:           "names are normalized",
+			normalizeNames: true,
+			apps:           []argov1alpha1.Application{app("Feature/Foo", "default"), app("b", "default")},
+			expectedApps:   []argov1alpha1.Application{app("feature-foo", "default"), app("b", "default")},
+		},
+		{
+			name:           "identical Applications of different names normalized to the same one are refused",
+			normalizeNames: true,
+			apps:           []argov1alpha1.Application{app("feature/foo", "default"), app("b", "default"), app("Feature_Foo", "default")},
+			expectedApps:   []argov1alpha1.Application{app("b", "default")},
+			expectedStatuses: []argoprojiov1alpha1.ApplicationSetApplicationStatus{{
+				Name:       "feature-foo",
+				LastAction: argoprojiov1alpha1.ApplicationSetApplicationActionFailed,
+				Message:    `2 different names are normalized to the name "feature-foo": "feature/foo", "Feature_Foo"`,
+			}},
+			expectedEvent: `Warning NameCollision 2 different names are normalized to the name "feature-foo": "feature/foo", "Feature_Foo"`,
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(1)
+			r := ApplicationSetReconciler{Recorder: recorder}
+
+			appSet := argoprojiov1alpha1.ApplicationSet{
+				Spec: argoprojiov1alpha1.ApplicationSetSpec{NormalizeNames: cc.normalizeNames},
+			}
+			apps, statuses, err := r.refuseNameCollisions(&appSet, cc.apps)
+			assert.Equal(t, cc.expectedApps, apps)
+			assert.Equal(t, cc.expectedStatuses, statuses)
+			if cc.expectedEvent == "" {
+				assert.NoError(t, err)
+				assert.Empty(t, recorder.Events)
+				return
+			}
+			assert.EqualError(t, err, cc.expectedStatuses[0].Message)
+			assert.Equal(t, cc.expectedEvent, <-recorder.Events)
+		})
+	}
+}
+
+func TestCheckApplicationSetConflict(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, argoprojiov1alpha1.AddToScheme(scheme))
+	assert.NoError(t, argov1alpha1.AddToScheme(scheme))
+
+	isController := true
+	now := metav1.Now()
+	for _, c := range []struct {
+		name        string
+		adoptFrom   string
+		owner       string
+		ownerUID    types.UID
+		other       *argoprojiov1alpha1.ApplicationSet
+		expectedErr string
+	}{
+		{
+			name:     "controlled by the ApplicationSet",
+			owner:    "name",
+			ownerUID: "uid",
+		},
+		{
+			name:     "controlled by another ApplicationSet generating it",
+			owner:    "other",
+			ownerUID: "other-uid",
+			other: &argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "namespace", UID: "other-uid"},
+				Status: argoprojiov1alpha1.ApplicationSetStatus{Applications: []argoprojiov1alpha1.ApplicationSetApplicationStatus{
+					{Name: "app", LastAction: "unchanged"},
+				}},
+			},
+			expectedErr: `Application "app" is already generated by ApplicationSet "other"`,
+		},
+		{
+			name:     "controlled by another ApplicationSet which failed to generate it",
+			owner:    "other",
+			ownerUID: "other-uid",
+			other: &argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "namespace", UID: "other-uid"},
+				Status: argoprojiov1alpha1.ApplicationSetStatus{Applications: []argoprojiov1alpha1.ApplicationSetApplicationStatus{
+					{Name: "app", LastAction: argoprojiov1alpha1.ApplicationSetApplicationActionFailed},
+				}},
+			},
+		},
+		{
+			name:     "controlled by another ApplicationSet not generating it anymore",
+			owner:    "other",
+			ownerUID: "other-uid",
+			other: &argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "namespace", UID: "other-uid"},
+			},
+		},
+		{
+			name:     "controlled by a deleted ApplicationSet",
+			owner:    "other",
+			ownerUID: "other-uid",
+		},
+		{
+			name:     "controlled by a previous ApplicationSet of the same name",
+			owner:    "other",
+			ownerUID: "previous-uid",
+			other: &argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "namespace", UID: "other-uid"},
+				Status: argoprojiov1alpha1.ApplicationSetStatus{Applications: []argoprojiov1alpha1.ApplicationSetApplicationStatus{
+					{Name: "app", LastAction: "unchanged"},
+				}},
+			},
+		},
+		{
+			name:     "controlled by an ApplicationSet being deleted",
+			owner:    "other",
+			ownerUID: "other-uid",
+			other: &argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "namespace", UID: "other-uid", DeletionTimestamp: &now},
+				Status: argoprojiov1alpha1.ApplicationSetStatus{Applications: []argoprojiov1alpha1.ApplicationSetApplicationStatus{
+					{Name: "app", LastAction: "unchanged"},
+				}},
+			},
+		},
+		{
+			name:      "controlled by the ApplicationSet it adopts from",
+			adoptFrom: "other",
+			owner:     "other",
+			ownerUID:  "other-uid",
+			other: &argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "namespace", UID: "other-uid"},
+				Status: argoprojiov1alpha1.ApplicationSetStatus{Applications: []argoprojiov1alpha1.ApplicationSetApplicationStatus{
+					{Name: "app", LastAction: "unchanged"},
+				}},
+			},
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			appSet := &argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "name", Namespace: "namespace", UID: "uid"},
+				Spec: argoprojiov1alpha1.ApplicationSetSpec{
+					SyncPolicy: &argoprojiov1alpha1.ApplicationSetSyncPolicy{AdoptFrom: cc.adoptFrom},
+				},
+			}
+			initObjs := []runtime.Object{appSet}
+			if cc.other != nil {
+				initObjs = append(initObjs, cc.other)
+			}
+			r := ApplicationSetReconciler{Client: fake.NewFakeClientWithScheme(scheme, initObjs...), Scheme: scheme}
+
+			app := &argov1alpha1.Application{ObjectMeta: metav1.ObjectMeta{
+				Name:      "app",
+				Namespace: "namespace",
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: "argoproj.io/v1alpha1",
+					Kind:       "ApplicationSet",
+					Name:       cc.owner,
+					UID:        cc.ownerUID,
+					Controller: &isController,
+				}},
+			}}
+
+			err := r.checkApplicationSetConflict(context.TODO(), appSet, app)
+			if cc.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, cc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestCreateOrUpdateInClusterConflict(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, argoprojiov1alpha1.AddToScheme(scheme))
+	assert.NoError(t, argov1alpha1.AddToScheme(scheme))
+
+	isController := true
+	appSet := argoprojiov1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "name", Namespace: "namespace", UID: "uid"},
+		Spec: argoprojiov1alpha1.ApplicationSetSpec{
+			SyncPolicy: &argoprojiov1alpha1.ApplicationSetSyncPolicy{AdoptionPolicy: argoprojiov1alpha1.ApplicationSetAdoptionPolicyAlways},
+		},
+	}
+	other := argoprojiov1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "namespace", UID: "other-uid"},
+		Status: argoprojiov1alpha1.ApplicationSetStatus{Applications: []argoprojiov1alpha1.ApplicationSetApplicationStatus{
+			{Name: "app", LastAction: "unchanged"},
+		}},
+	}
+	app := &argov1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "app",
+			Namespace:       "namespace",
+			ResourceVersion: "1",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "argoproj.io/v1alpha1",
+				Kind:       "ApplicationSet",
+				Name:       "other",
+				UID:        "other-uid",
+				Controller: &isController,
+			}},
+		},
+		Spec: argov1alpha1.ApplicationSpec{Project: "default"},
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme, &appSet, &other, app)
+	recorder := record.NewFakeRecorder(10)
+	r := ApplicationSetReconciler{Client: client, Scheme: scheme, Recorder: recorder}
+
+	res, err := r.createOrUpdateInCluster(context.TODO(), appSet, []argov1alpha1.Application{
+		{ObjectMeta: metav1.ObjectMeta{Name: "app"}, Spec: argov1alpha1.ApplicationSpec{Project: "other"}},
+	})
+	assert.EqualError(t, err, `Application "app" is already generated by ApplicationSet "other"`)
+	assert.Equal(t, []argoprojiov1alpha1.ApplicationSetApplicationStatus{{
+		Name:       "app",
+		LastAction: argoprojiov1alpha1.ApplicationSetApplicationActionFailed,
+		Message:    err.Error(),
+	}}, res)
+	assert.Equal(t, "Warning NameConflict "+err.Error(), <-recorder.Events)
+
+	var got argov1alpha1.Application
+	assert.NoError(t, client.Get(context.TODO(), types.NamespacedName{Namespace: "namespace", Name: "app"}, &got))
+	assert.Equal(t, "default", got.Spec.Project)
+}
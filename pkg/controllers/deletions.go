@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	"github.com/argoproj-labs/applicationset/pkg/utils"
+)
+
+// deletionsBlockedError is returned when more Applications would be deleted than allowed by the maxDeletions of
+// the ApplicationSet, e.g. because a generator returned nothing after an error
+type deletionsBlockedError struct {
+	deletions int
+	current   int
+	max       int
+	// hash identifies the blocked deletions, and is the value of the AllowDeletionsAnnotation acknowledging them
+	hash string
+}
+
+func (e *deletionsBlockedError) Error() string {
+	return fmt.Sprintf("deleting %d of the %d Applications exceeds the maximum of %d deletions, annotate the ApplicationSet with %s=%s to allow them",
+		e.deletions, e.current, e.max, utils.AllowDeletionsAnnotation, e.hash)
+}
+
+// isDeletionsBlocked returns whether the error is a deletionsBlockedError
+func isDeletionsBlocked(err error) bool {
+	_, blocked := err.(*deletionsBlockedError)
+	return blocked
+}
+
+// checkDeletions returns a deletionsBlockedError when deleting the given Applications, out of the current
+// Applications of the ApplicationSet, exceeds its maxDeletions. The deletions may be acknowledged by setting the
+// AllowDeletionsAnnotation to their hash: an acknowledgement of other deletions, e.g. before more Applications
+// stopped being generated, is ignored.
+func (r *ApplicationSetReconciler) checkDeletions(applicationSet *argoprojiov1alpha1.ApplicationSet, deletions []string, current int) error {
+	maxDeletions := r.MaxDeletions
+	if applicationSet.Spec.SyncPolicy != nil && applicationSet.Spec.SyncPolicy.MaxDeletions != nil {
+		maxDeletions = applicationSet.Spec.SyncPolicy.MaxDeletions
+	}
+	if maxDeletions == nil || len(deletions) == 0 {
+		return nil
+	}
+
+	max, err := intstr.GetValueFromIntOrPercent(maxDeletions, current, false)
+	if err != nil {
+		return fmt.Errorf("invalid maxDeletions: %v", err)
+	}
+	if len(deletions) <= max {
+		return nil
+	}
+
+	hash := deletionsHash(deletions)
+	if applicationSet.Annotations[utils.AllowDeletionsAnnotation] == hash {
+		return nil
+	}
+	return &deletionsBlockedError{deletions: len(deletions), current: current, max: max, hash: hash}
+}
+
+// deletionsHash returns a short hash of the names of the deleted Applications, whatever their order
+func deletionsHash(deletions []string) string {
+	names := append([]string{}, deletions...)
+	sort.Strings(names)
+	sum := sha256.Sum256([]byte(strings.Join(names, "\n")))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// clearDeletionsAcknowledgement removes the AllowDeletionsAnnotation of the ApplicationSet once the deletions it
+// allowed are done, so that the next ones are checked again
+func (r *ApplicationSetReconciler) clearDeletionsAcknowledgement(ctx context.Context, applicationSet *argoprojiov1alpha1.ApplicationSet) error {
+	if _, ok := applicationSet.Annotations[utils.AllowDeletionsAnnotation]; !ok {
+		return nil
+	}
+
+	delete(applicationSet.Annotations, utils.AllowDeletionsAnnotation)
+	return r.Client.Update(ctx, applicationSet)
+}
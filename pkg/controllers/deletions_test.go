@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	"github.com/argoproj-labs/applicationset/pkg/utils"
+)
+
+func TestCheckDeletions(t *testing.T) {
+	count := intstr.FromInt(2)
+	percent := intstr.FromString("50%")
+	invalid := intstr.FromString("half")
+	names := func(n int) []string {
+		var res []string
+		for i := 0; i < n; i++ {
+			res = append(res, fmt.Sprintf("app%d", i))
+		}
+		return res
+	}
+
+	for _, c := range []struct {
+		name           string
+		defaultMax     *intstr.IntOrString
+		max            *intstr.IntOrString
+		annotations    map[string]string
+		deletions      int
+		expectBlocked  bool
+		expectOtherErr bool
+	}{
+		{
+			name:      "no limit",
+			deletions: 10,
+		},
+		{
+			name:          "default of the controller",
+			defaultMax:    &count,
+			deletions:     3,
+			expectBlocked: true,
+		},
+		{
+			name:       "option of the ApplicationSet overrides the default",
+			defaultMax: &count,
+			max:        &percent,
+			deletions:  3,
+		},
+		{
+			name:          "percentage of the current Applications",
+			max:           &percent,
+			deletions:     6,
+			expectBlocked: true,
+		},
+		{
+			name:        "acknowledged deletions",
+			max:         &count,
+			annotations: map[string]string{utils.AllowDeletionsAnnotation: deletionsHash(names(10))},
+			deletions:   10,
+		},
+		{
+			name:          "acknowledgement of other deletions",
+			max:           &count,
+			annotations:   map[string]string{utils.AllowDeletionsAnnotation: deletionsHash(names(5))},
+			deletions:     10,
+			expectBlocked: true,
+		},
+		{
+			name:          "blanket acknowledgement",
+			max:           &count,
+			annotations:   map[string]string{utils.AllowDeletionsAnnotation: "true"},
+			deletions:     10,
+			expectBlocked: true,
+		},
+		{
+			name:           "invalid maxDeletions",
+			max:            &invalid,
+			deletions:      1,
+			expectOtherErr: true,
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			appSet := &argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "name", Namespace: "namespace", Annotations: cc.annotations},
+				Spec: argoprojiov1alpha1.ApplicationSetSpec{
+					SyncPolicy: &argoprojiov1alpha1.ApplicationSetSyncPolicy{MaxDeletions: cc.max},
+				},
+			}
+			r := ApplicationSetReconciler{MaxDeletions: cc.defaultMax}
+
+			err := r.checkDeletions(appSet, names(cc.deletions), 10)
+			switch {
+			case cc.expectBlocked:
+				assert.True(t, isDeletionsBlocked(err), "expected blocked deletions, got %v", err)
+			case cc.expectOtherErr:
+				assert.Error(t, err)
+				assert.False(t, isDeletionsBlocked(err))
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDeleteInClusterBlocked(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, argoprojiov1alpha1.AddToScheme(scheme))
+	assert.NoError(t, argov1alpha1.AddToScheme(scheme))
+
+	max := intstr.FromInt(1)
+	for _, c := range []struct {
+		name          string
+		annotations   map[string]string
+		expectDeleted bool
+	}{
+		{
+			name:          "blocked",
+			expectDeleted: false,
+		},
+		{
+			name:          "acknowledged",
+			annotations:   map[string]string{utils.AllowDeletionsAnnotation: deletionsHash([]string{"app3", "app2"})},
+			expectDeleted: true,
+		},
+		{
+			name:          "acknowledgement of other deletions",
+			annotations:   map[string]string{utils.AllowDeletionsAnnotation: deletionsHash([]string{"app2"})},
+			expectDeleted: false,
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			appSet := argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "name", Namespace: "namespace", Annotations: cc.annotations},
+				Spec: argoprojiov1alpha1.ApplicationSetSpec{
+					SyncPolicy: &argoprojiov1alpha1.ApplicationSetSyncPolicy{MaxDeletions: &max},
+				},
+			}
+			initObjs := []runtime.Object{&appSet}
+			for _, name := range []string{"app1", "app2", "app3"} {
+				app := &argov1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "namespace"}}
+				assert.NoError(t, controllerutil.SetControllerReference(&appSet, app, scheme))
+				initObjs = append(initObjs, app)
+			}
+			client := fake.NewFakeClientWithScheme(scheme, initObjs...)
+			recorder := record.NewFakeRecorder(10)
+			r := ApplicationSetReconciler{Client: client, Scheme: scheme, Recorder: recorder}
+
+			// Only app1 is still generated, deleting 2 of the 3 Applications
+			err := r.deleteInCluster(context.TODO(), appSet, []argov1alpha1.Application{
+				{ObjectMeta: metav1.ObjectMeta{Name: "app1", Namespace: "namespace"}},
+			})
+
+			for _, name := range []string{"app2", "app3"} {
+				getErr := client.Get(context.TODO(), types.NamespacedName{Namespace: "namespace", Name: name}, &argov1alpha1.Application{})
+				assert.Equal(t, cc.expectDeleted, apierrors.IsNotFound(getErr), name)
+			}
+
+			if cc.expectDeleted {
+				assert.NoError(t, err)
+				return
+			}
+			assert.True(t, isDeletionsBlocked(err))
+			assert.EqualError(t, err, "deleting 2 of the 3 Applications exceeds the maximum of 1 deletions, annotate the ApplicationSet with applicationset.argoproj.io/allow-deletions="+deletionsHash([]string{"app2", "app3"})+" to allow them")
+			assert.Equal(t, "Warning DeletionBlocked "+err.Error(), <-recorder.Events)
+		})
+	}
+}
+
+func TestClearDeletionsAcknowledgement(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, argoprojiov1alpha1.AddToScheme(scheme))
+
+	appSet := argoprojiov1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "name",
+			Namespace:   "namespace",
+			Annotations: map[string]string{utils.AllowDeletionsAnnotation: "true", "other": "value"},
+		},
+	}
+	client := fake.NewFakeClientWithScheme(scheme, &appSet)
+	r := ApplicationSetReconciler{Client: client, Scheme: scheme}
+
+	var got argoprojiov1alpha1.ApplicationSet
+	assert.NoError(t, client.Get(context.TODO(), types.NamespacedName{Namespace: "namespace", Name: "name"}, &got))
+	assert.NoError(t, r.clearDeletionsAcknowledgement(context.TODO(), &got))
+
+	assert.NoError(t, client.Get(context.TODO(), types.NamespacedName{Namespace: "namespace", Name: "name"}, &got))
+	assert.Equal(t, map[string]string{"other": "value"}, got.Annotations)
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	"github.com/argoproj-labs/applicationset/pkg/utils"
+)
+
+// getAdoptFrom returns the name of the ApplicationSet whose Applications the ApplicationSet adopts, if any
+func getAdoptFrom(applicationSet *argoprojiov1alpha1.ApplicationSet) string {
+	if applicationSet.Spec.SyncPolicy == nil {
+		return ""
+	}
+	return applicationSet.Spec.SyncPolicy.AdoptFrom
+}
+
+// getAdoptingApplicationSets returns, by name of Application, the ApplicationSets of the namespace adopting the
+// Applications of the ApplicationSet which generate it, according to the Applications reported in their status.
+// The Applications they failed to generate, e.g. because of a name collision, are not adopted.
+func (r *ApplicationSetReconciler) getAdoptingApplicationSets(ctx context.Context, applicationSet *argoprojiov1alpha1.ApplicationSet) (map[string][]string, error) {
+	appSetList := &argoprojiov1alpha1.ApplicationSetList{}
+	if err := r.List(ctx, appSetList, client.InNamespace(applicationSet.Namespace)); err != nil {
+		return nil, err
+	}
+
+	res := map[string][]string{}
+	for _, appSet := range appSetList.Items {
+		if appSet.Name == applicationSet.Name || getAdoptFrom(&appSet) != applicationSet.Name {
+			continue
+		}
+		for _, status := range appSet.Status.Applications {
+			if status.LastAction != argoprojiov1alpha1.ApplicationSetApplicationActionFailed {
+				res[status.Name] = append(res[status.Name], appSet.Name)
+			}
+		}
+	}
+	return res, nil
+}
+
+// releaseApplication removes the owner reference of the ApplicationSet from an Application it doesn't generate
+// anymore, instead of deleting it, so that the ApplicationSet adopting its Applications takes it over
+func (r *ApplicationSetReconciler) releaseApplication(ctx context.Context, applicationSet *argoprojiov1alpha1.ApplicationSet, app *argov1alpha1.Application) error {
+	var ownerReferences []metav1.OwnerReference
+	for _, ref := range app.OwnerReferences {
+		if ref.UID != applicationSet.UID {
+			ownerReferences = append(ownerReferences, ref)
+		}
+	}
+	app.OwnerReferences = ownerReferences
+
+	if app.Annotations == nil {
+		app.Annotations = map[string]string{}
+	}
+	app.Annotations[utils.ReleasedByAnnotation] = applicationSet.Name
+
+	return r.Client.Update(ctx, app)
+}
+
+// applicationSetsForReleasedApplication maps an Application released by an ApplicationSet to the ApplicationSets
+// adopting its Applications, so that they take it over right away.
+func (r *ApplicationSetReconciler) applicationSetsForReleasedApplication(a handler.MapObject) []reconcile.Request {
+	releasedBy, ok := a.Meta.GetAnnotations()[utils.ReleasedByAnnotation]
+	if !ok {
+		return nil
+	}
+
+	appSetList := &argoprojiov1alpha1.ApplicationSetList{}
+	if err := r.List(context.Background(), appSetList, client.InNamespace(a.Meta.GetNamespace())); err != nil {
+		log.WithError(err).Error("unable to list ApplicationSets")
+		return nil
+	}
+
+	var res []reconcile.Request
+	for _, appSet := range appSetList.Items {
+		if getAdoptFrom(&appSet) == releasedBy {
+			res = append(res, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: appSet.Namespace, Name: appSet.Name}})
+		}
+	}
+	return res
+}
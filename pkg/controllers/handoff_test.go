@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	"github.com/argoproj-labs/applicationset/pkg/utils"
+)
+
+func TestDeleteInClusterReleasesAdoptedApplications(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, argoprojiov1alpha1.AddToScheme(scheme))
+	assert.NoError(t, argov1alpha1.AddToScheme(scheme))
+
+	for _, c := range []struct {
+		name           string
+		adoptFrom      string
+		statuses       []argoprojiov1alpha1.ApplicationSetApplicationStatus
+		expectReleased bool
+	}{
+		{
+			name:           "adopted by another ApplicationSet",
+			adoptFrom:      "old",
+			statuses:       []argoprojiov1alpha1.ApplicationSetApplicationStatus{{Name: "app", LastAction: "unchanged"}},
+			expectReleased: true,
+		},
+		{
+			name:           "not adopted",
+			adoptFrom:      "other",
+			statuses:       []argoprojiov1alpha1.ApplicationSetApplicationStatus{{Name: "app", LastAction: "unchanged"}},
+			expectReleased: false,
+		},
+		{
+			name:           "not generated by the adopting ApplicationSet",
+			adoptFrom:      "old",
+			statuses:       []argoprojiov1alpha1.ApplicationSetApplicationStatus{{Name: "other", LastAction: "unchanged"}},
+			expectReleased: false,
+		},
+		{
+			name:           "failed by the adopting ApplicationSet",
+			adoptFrom:      "old",
+			statuses:       []argoprojiov1alpha1.ApplicationSetApplicationStatus{{Name: "app", LastAction: argoprojiov1alpha1.ApplicationSetApplicationActionFailed}},
+			expectReleased: false,
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			oldAppSet := argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "old", Namespace: "namespace", UID: "old-uid"},
+			}
+			newAppSet := argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "namespace", UID: "new-uid"},
+				Spec: argoprojiov1alpha1.ApplicationSetSpec{
+					SyncPolicy: &argoprojiov1alpha1.ApplicationSetSyncPolicy{AdoptFrom: cc.adoptFrom},
+				},
+				Status: argoprojiov1alpha1.ApplicationSetStatus{Applications: cc.statuses},
+			}
+			app := &argov1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "namespace"}}
+			assert.NoError(t, controllerutil.SetControllerReference(&oldAppSet, app, scheme))
+
+			client := fake.NewFakeClientWithScheme(scheme, &oldAppSet, &newAppSet, app)
+			recorder := record.NewFakeRecorder(10)
+			r := ApplicationSetReconciler{Client: client, Scheme: scheme, Recorder: recorder}
+
+			assert.NoError(t, r.deleteInCluster(context.TODO(), oldAppSet, nil))
+
+			var got argov1alpha1.Application
+			err := client.Get(context.TODO(), types.NamespacedName{Namespace: "namespace", Name: "app"}, &got)
+			if !cc.expectReleased {
+				assert.Error(t, err)
+				assert.Equal(t, `Normal Deleted Deleted Application "app"`, <-recorder.Events)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Empty(t, got.OwnerReferences)
+			assert.Equal(t, map[string]string{utils.ReleasedByAnnotation: "old"}, got.Annotations)
+			assert.Equal(t, `Normal Released Released Application "app" to ApplicationSet new`, <-recorder.Events)
+
+			// The adopting ApplicationSet takes the released Application over
+			adoption, err := adoptApplication(&newAppSet, &got)
+			assert.NoError(t, err)
+			assert.Equal(t, `Adopted Application "app" released by ApplicationSet "old"`, adoption)
+		})
+	}
+}
+
+func TestDeleteInClusterCountsApplicationsNotAdopted(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, argoprojiov1alpha1.AddToScheme(scheme))
+	assert.NoError(t, argov1alpha1.AddToScheme(scheme))
+
+	max := intstr.FromInt(1)
+	oldAppSet := argoprojiov1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "old", Namespace: "namespace", UID: "old-uid"},
+		Spec: argoprojiov1alpha1.ApplicationSetSpec{
+			SyncPolicy: &argoprojiov1alpha1.ApplicationSetSyncPolicy{MaxDeletions: &max},
+		},
+	}
+	newAppSet := argoprojiov1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "namespace", UID: "new-uid"},
+		Spec: argoprojiov1alpha1.ApplicationSetSpec{
+			SyncPolicy: &argoprojiov1alpha1.ApplicationSetSyncPolicy{AdoptFrom: "old"},
+		},
+		Status: argoprojiov1alpha1.ApplicationSetStatus{
+			Applications: []argoprojiov1alpha1.ApplicationSetApplicationStatus{{Name: "app1", LastAction: "unchanged"}},
+		},
+	}
+	initObjs := []runtime.Object{&oldAppSet, &newAppSet}
+	for _, name := range []string{"app1", "app2", "app3"} {
+		app := &argov1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "namespace"}}
+		assert.NoError(t, controllerutil.SetControllerReference(&oldAppSet, app, scheme))
+		initObjs = append(initObjs, app)
+	}
+	client := fake.NewFakeClientWithScheme(scheme, initObjs...)
+	r := ApplicationSetReconciler{Client: client, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+
+	// app1 is adopted, while deleting app2 and app3 exceeds the maxDeletions
+	err := r.deleteInCluster(context.TODO(), oldAppSet, nil)
+	assert.True(t, isDeletionsBlocked(err), "expected blocked deletions, got %v", err)
+	assert.EqualError(t, err, "deleting 2 of the 3 Applications exceeds the maximum of 1 deletions, annotate the ApplicationSet with applicationset.argoproj.io/allow-deletions="+deletionsHash([]string{"app2", "app3"})+" to allow them")
+}
+
+func TestApplicationSetsForReleasedApplication(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, argoprojiov1alpha1.AddToScheme(scheme))
+	assert.NoError(t, argov1alpha1.AddToScheme(scheme))
+
+	adopting := &argoprojiov1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "namespace"},
+		Spec: argoprojiov1alpha1.ApplicationSetSpec{
+			SyncPolicy: &argoprojiov1alpha1.ApplicationSetSyncPolicy{AdoptFrom: "old"},
+		},
+	}
+	other := &argoprojiov1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "namespace"},
+	}
+	r := ApplicationSetReconciler{Client: fake.NewFakeClientWithScheme(scheme, adopting, other), Scheme: scheme}
+
+	released := &argov1alpha1.Application{ObjectMeta: metav1.ObjectMeta{
+		Name:        "app",
+		Namespace:   "namespace",
+		Annotations: map[string]string{utils.ReleasedByAnnotation: "old"},
+	}}
+	assert.Equal(t, []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "namespace", Name: "new"}},
+	}, r.applicationSetsForReleasedApplication(handler.MapObject{Meta: released, Object: released}))
+
+	app := &argov1alpha1.Application{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "namespace"}}
+	assert.Nil(t, r.applicationSetsForReleasedApplication(handler.MapObject{Meta: app, Object: app}))
+}
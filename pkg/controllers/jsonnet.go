@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	"github.com/argoproj-labs/applicationset/pkg/services"
+	"github.com/argoproj-labs/applicationset/pkg/utils"
+)
+
+// getJsonnetRenderer returns the Renderer evaluating the Jsonnet snippet of the ApplicationSet. A snippet read
+// from git, and the libraries it imports, are read from the same commit, resolved once per reconciliation.
+// base renders the template patched by the snippet in patch mode.
+func (r *ApplicationSetReconciler) getJsonnetRenderer(ctx context.Context, applicationSetInfo *argoprojiov1alpha1.ApplicationSet, base utils.Renderer) (utils.Renderer, error) {
+	spec := applicationSetInfo.Spec.Jsonnet
+
+	res := &utils.JsonnetRender{
+		Snippet:  spec.Snippet,
+		Patch:    spec.Mode == argoprojiov1alpha1.JsonnetModePatch,
+		Renderer: base,
+		Context:  ctx,
+	}
+
+	switch {
+	case spec.Snippet != "" && spec.Git != nil:
+		return nil, fmt.Errorf("jsonnet must set either snippet or git, not both")
+	case spec.Snippet != "":
+		return res, nil
+	case spec.Git == nil:
+		return nil, fmt.Errorf("jsonnet must set either snippet or git")
+	}
+
+	if r.Repos == nil {
+		return nil, fmt.Errorf("jsonnet.git is not supported by this controller")
+	}
+
+	git := spec.Git
+	revision, err := r.Repos.GetRevision(ctx, git.RepoURL, git.Revision)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve revision %q of %s: %v", git.Revision, git.RepoURL, err)
+	}
+
+	snippet, err := r.Repos.GetFileContent(ctx, git.RepoURL, revision.SHA, git.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Jsonnet snippet %s from %s: %v", git.Path, git.RepoURL, err)
+	}
+
+	res.Snippet = string(snippet)
+	res.Filename = git.Path
+	res.Libraries = git.Libraries
+	res.ReadFile = func(path string) ([]byte, error) {
+		content, err := r.Repos.GetFileContent(ctx, git.RepoURL, revision.SHA, path)
+		if services.IsFileNotFound(err) {
+			return nil, os.ErrNotExist
+		}
+		return content, err
+	}
+	return res, nil
+}
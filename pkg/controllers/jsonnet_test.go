@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/argoproj-labs/applicationset/pkg/generators"
+	"github.com/argoproj-labs/applicationset/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+)
+
+func TestGenerateApplicationsJsonnet(t *testing.T) {
+	repos := &filesApps{files: map[string]string{
+		"https://github.com/argoproj/jsonnet.git/apps/main.jsonnet": `(import "app.libsonnet")(std.extVar("name"))`,
+		"https://github.com/argoproj/jsonnet.git/lib/app.libsonnet": `function(name) { metadata: { name: std.asciiLower(name) }, spec: { project: "default" } }`,
+	}}
+
+	for _, c := range []struct {
+		name        string
+		jsonnet     *argoprojiov1alpha1.ApplicationSetJsonnet
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "inline snippet",
+			jsonnet:  &argoprojiov1alpha1.ApplicationSetJsonnet{Snippet: `{ metadata: { name: std.extVar("name") + "-jsonnet" } }`},
+			expected: "App-jsonnet",
+		},
+		{
+			name: "patch",
+			jsonnet: &argoprojiov1alpha1.ApplicationSetJsonnet{
+				Mode:    argoprojiov1alpha1.JsonnetModePatch,
+				Snippet: `{ metadata: { name: std.asciiUpper(std.extVar("name")) } }`,
+			},
+			expected: "APP",
+		},
+		{
+			name: "git",
+			jsonnet: &argoprojiov1alpha1.ApplicationSetJsonnet{Git: &argoprojiov1alpha1.GitJsonnetSource{
+				RepoURL:   "https://github.com/argoproj/jsonnet.git",
+				Path:      "apps/main.jsonnet",
+				Libraries: []string{"lib"},
+			}},
+			expected: "app",
+		},
+		{
+			name: "missing git file",
+			jsonnet: &argoprojiov1alpha1.ApplicationSetJsonnet{Git: &argoprojiov1alpha1.GitJsonnetSource{
+				RepoURL: "https://github.com/argoproj/jsonnet.git",
+				Path:    "missing.jsonnet",
+			}},
+			expectedErr: "failed to read Jsonnet snippet missing.jsonnet from https://github.com/argoproj/jsonnet.git: file not found",
+		},
+		{
+			name:        "neither snippet nor git",
+			jsonnet:     &argoprojiov1alpha1.ApplicationSetJsonnet{},
+			expectedErr: "jsonnet must set either snippet or git",
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			r := ApplicationSetReconciler{
+				Generators: map[string]generators.Generator{
+					"List": &slowGenerator{params: []map[string]interface{}{{"name": "App"}}},
+				},
+				Recorder: record.NewFakeRecorder(1),
+				Renderer: &utils.Render{},
+				Repos:    repos,
+			}
+
+			got, _, err := r.generateApplications(context.TODO(), argoprojiov1alpha1.ApplicationSet{
+				Spec: argoprojiov1alpha1.ApplicationSetSpec{
+					Generators: []argoprojiov1alpha1.ApplicationSetGenerator{{List: &argoprojiov1alpha1.ListGenerator{}}},
+					Template: argoprojiov1alpha1.ApplicationSetTemplate{
+						ObjectMeta: metav1.ObjectMeta{Name: "{{name}}"},
+					},
+					Jsonnet: cc.jsonnet,
+				},
+			})
+
+			if cc.expectedErr != "" {
+				assert.EqualError(t, err, cc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, got, 1)
+			assert.Equal(t, cc.expected, got[0].Name)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	"github.com/argoproj-labs/applicationset/pkg/utils"
+)
+
+// skipPrune returns whether the Applications of the ApplicationSet must be kept when they are not generated
+// anymore, or when the ApplicationSet is deleted
+func skipPrune(applicationSet *argoprojiov1alpha1.ApplicationSet) bool {
+	return applicationSet.Spec.SyncPolicy != nil && applicationSet.Spec.SyncPolicy.SkipPrune
+}
+
+// setOrphanApplicationsFinalizer adds the finalizer releasing the Applications before the deletion of the
+// ApplicationSet when skipPrune is set, and removes it otherwise.
+func (r *ApplicationSetReconciler) setOrphanApplicationsFinalizer(ctx context.Context, applicationSet *argoprojiov1alpha1.ApplicationSet) error {
+	hasFinalizer := containsString(applicationSet.Finalizers, utils.OrphanApplicationsFinalizerName)
+	if skipPrune(applicationSet) == hasFinalizer {
+		return nil
+	}
+
+	if hasFinalizer {
+		applicationSet.Finalizers = removeString(applicationSet.Finalizers, utils.OrphanApplicationsFinalizerName)
+	} else {
+		applicationSet.Finalizers = append(applicationSet.Finalizers, utils.OrphanApplicationsFinalizerName)
+	}
+	return r.Client.Update(ctx, applicationSet)
+}
+
+// orphanApplications removes the owner reference of the ApplicationSet being deleted from its Applications when
+// skipPrune is set, so that they are not garbage collected, then removes its finalizer.
+func (r *ApplicationSetReconciler) orphanApplications(ctx context.Context, applicationSet *argoprojiov1alpha1.ApplicationSet) error {
+	if !containsString(applicationSet.Finalizers, utils.OrphanApplicationsFinalizerName) {
+		return nil
+	}
+
+	if skipPrune(applicationSet) {
+		current, err := r.getCurrentApplications(ctx, *applicationSet)
+		if err != nil {
+			return err
+		}
+
+		for _, app := range current {
+			var ownerReferences []metav1.OwnerReference
+			for _, ref := range app.OwnerReferences {
+				if ref.UID != applicationSet.UID {
+					ownerReferences = append(ownerReferences, ref)
+				}
+			}
+			app.OwnerReferences = ownerReferences
+			if err := r.Client.Update(ctx, &app); err != nil {
+				return err
+			}
+			log.WithFields(log.Fields{"app": app.Name, "appSet": applicationSet.Name}).Info("orphaned Application")
+		}
+	}
+
+	applicationSet.Finalizers = removeString(applicationSet.Finalizers, utils.OrphanApplicationsFinalizerName)
+	return r.Client.Update(ctx, applicationSet)
+}
+
+func removeString(list []string, s string) []string {
+	var res []string
+	for _, elem := range list {
+		if elem != s {
+			res = append(res, elem)
+		}
+	}
+	return res
+}
@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/argoproj-labs/applicationset/pkg/utils"
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+)
+
+func TestGetPolicy(t *testing.T) {
+	for _, c := range []struct {
+		name             string
+		controllerPolicy string
+		syncPolicy       *argoprojiov1alpha1.ApplicationSetSyncPolicy
+		expectedUpdate   bool
+		expectedDelete   bool
+	}{
+		{
+			name:             "default",
+			controllerPolicy: "create-update",
+			expectedUpdate:   true,
+			expectedDelete:   false,
+		},
+		{
+			name:             "less permissive",
+			controllerPolicy: "sync",
+			syncPolicy:       &argoprojiov1alpha1.ApplicationSetSyncPolicy{ApplicationsSync: argoprojiov1alpha1.ApplicationsSyncPolicyCreateOnly},
+			expectedUpdate:   false,
+			expectedDelete:   false,
+		},
+		{
+			name:             "capped by the controller",
+			controllerPolicy: "create-update",
+			syncPolicy:       &argoprojiov1alpha1.ApplicationSetSyncPolicy{ApplicationsSync: argoprojiov1alpha1.ApplicationsSyncPolicySync},
+			expectedUpdate:   true,
+			expectedDelete:   false,
+		},
+		{
+			name:             "unknown is create-only",
+			controllerPolicy: "sync",
+			syncPolicy:       &argoprojiov1alpha1.ApplicationSetSyncPolicy{ApplicationsSync: "unknown"},
+			expectedUpdate:   false,
+			expectedDelete:   false,
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			r := ApplicationSetReconciler{Policy: utils.Policies[cc.controllerPolicy]}
+
+			got := r.getPolicy(&argoprojiov1alpha1.ApplicationSet{
+				Spec: argoprojiov1alpha1.ApplicationSetSpec{SyncPolicy: cc.syncPolicy},
+			})
+
+			assert.Equal(t, cc.expectedUpdate, got.Update())
+			assert.Equal(t, cc.expectedDelete, got.Delete())
+		})
+	}
+}
+
+func TestSetOrphanApplicationsFinalizer(t *testing.T) {
+	scheme := runtime.NewScheme()
+	argoprojiov1alpha1.AddToScheme(scheme)
+	argov1alpha1.AddToScheme(scheme)
+
+	for _, c := range []struct {
+		name       string
+		finalizers []string
+		skipPrune  bool
+		expected   []string
+	}{
+		{name: "added", finalizers: []string{"other"}, skipPrune: true, expected: []string{"other", utils.OrphanApplicationsFinalizerName}},
+		{name: "kept", finalizers: []string{utils.OrphanApplicationsFinalizerName}, skipPrune: true, expected: []string{utils.OrphanApplicationsFinalizerName}},
+		{name: "removed", finalizers: []string{utils.OrphanApplicationsFinalizerName, "other"}, skipPrune: false, expected: []string{"other"}},
+		{name: "none", skipPrune: false, expected: nil},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			appSet := &argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "name", Namespace: "namespace", Finalizers: cc.finalizers},
+				Spec: argoprojiov1alpha1.ApplicationSetSpec{
+					SyncPolicy: &argoprojiov1alpha1.ApplicationSetSyncPolicy{SkipPrune: cc.skipPrune},
+				},
+			}
+			client := fake.NewFakeClientWithScheme(scheme, appSet)
+			r := ApplicationSetReconciler{Client: client, Scheme: scheme}
+
+			assert.NoError(t, r.setOrphanApplicationsFinalizer(context.TODO(), appSet))
+
+			var got argoprojiov1alpha1.ApplicationSet
+			assert.NoError(t, client.Get(context.TODO(), types.NamespacedName{Namespace: "namespace", Name: "name"}, &got))
+			assert.Equal(t, cc.expected, got.Finalizers)
+		})
+	}
+}
+
+func TestOrphanApplications(t *testing.T) {
+	scheme := runtime.NewScheme()
+	argoprojiov1alpha1.AddToScheme(scheme)
+	argov1alpha1.AddToScheme(scheme)
+
+	trueValue := true
+	ownerReferences := []metav1.OwnerReference{
+		{APIVersion: "argoproj.io/v1alpha1", Kind: "ApplicationSet", Name: "name", UID: "appset-uid", Controller: &trueValue},
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "other", UID: "other-uid"},
+	}
+
+	for _, c := range []struct {
+		name                    string
+		skipPrune               bool
+		expectedOwnerReferences []metav1.OwnerReference
+	}{
+		{
+			name:                    "Applications are released with skipPrune",
+			skipPrune:               true,
+			expectedOwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ConfigMap", Name: "other", UID: "other-uid"}},
+		},
+		{
+			// skipPrune was turned off after the finalizer was added, and before it was removed
+			name:                    "Applications are left to garbage collection without skipPrune",
+			skipPrune:               false,
+			expectedOwnerReferences: ownerReferences,
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			appSet := &argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "name",
+					Namespace:  "namespace",
+					UID:        "appset-uid",
+					Finalizers: []string{utils.OrphanApplicationsFinalizerName},
+				},
+				Spec: argoprojiov1alpha1.ApplicationSetSpec{
+					SyncPolicy: &argoprojiov1alpha1.ApplicationSetSyncPolicy{SkipPrune: cc.skipPrune},
+				},
+			}
+			app := &argov1alpha1.Application{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:            "app",
+					Namespace:       "namespace",
+					OwnerReferences: ownerReferences,
+				},
+			}
+			client := fake.NewFakeClientWithScheme(scheme, appSet, app)
+			r := ApplicationSetReconciler{Client: client, Scheme: scheme}
+
+			assert.NoError(t, r.orphanApplications(context.TODO(), appSet))
+
+			var gotApp argov1alpha1.Application
+			assert.NoError(t, client.Get(context.TODO(), types.NamespacedName{Namespace: "namespace", Name: "app"}, &gotApp))
+			assert.Equal(t, cc.expectedOwnerReferences, gotApp.OwnerReferences)
+
+			var gotAppSet argoprojiov1alpha1.ApplicationSet
+			assert.NoError(t, client.Get(context.TODO(), types.NamespacedName{Namespace: "namespace", Name: "name"}, &gotAppSet))
+			assert.Empty(t, gotAppSet.Finalizers)
+		})
+	}
+}
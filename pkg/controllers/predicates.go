@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+)
+
+// applicationSetPredicates filters the updates of the ApplicationSets which only change their status, so that the
+// status written by a reconciliation doesn't trigger another one. Changes of the metadata are still reconciled, as
+// the controller reads some annotations, e.g. the acknowledgement of blocked deletions.
+func applicationSetPredicates() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldAppSet, isAppSet := e.ObjectOld.(*argoprojiov1alpha1.ApplicationSet)
+			if !isAppSet {
+				return false
+			}
+			newAppSet, isAppSet := e.ObjectNew.(*argoprojiov1alpha1.ApplicationSet)
+			if !isAppSet {
+				return false
+			}
+			return oldAppSet.Generation != newAppSet.Generation ||
+				!reflect.DeepEqual(oldAppSet.Labels, newAppSet.Labels) ||
+				!reflect.DeepEqual(oldAppSet.Annotations, newAppSet.Annotations) ||
+				!reflect.DeepEqual(oldAppSet.Finalizers, newAppSet.Finalizers) ||
+				!oldAppSet.DeletionTimestamp.Equal(newAppSet.DeletionTimestamp)
+		},
+	}
+}
+
+// ownedApplicationPredicates filters the events of the Applications owned by an ApplicationSet, so that their
+// ApplicationSet is reconciled when they are modified or deleted by someone else, or when their sync or health
+// status changes and the ApplicationSet has a rollingSync strategy, which it gates. The Applications created by
+// the controller itself, and the other changes of their status or operation, which Argo CD writes all the time,
+// are ignored.
+func ownedApplicationPredicates(c client.Client) predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return false
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldApp, isApp := e.ObjectOld.(*argov1alpha1.Application)
+			if !isApp {
+				return false
+			}
+			newApp, isApp := e.ObjectNew.(*argov1alpha1.Application)
+			if !isApp {
+				return false
+			}
+			return appManagedFieldsChanged(oldApp, newApp) ||
+				(appRolloutStatusChanged(oldApp, newApp) && ownerHasRollingSync(c, newApp))
+		},
+	}
+}
+
+// appManagedFieldsChanged returns whether the fields of the Application which are set by the controller changed
+func appManagedFieldsChanged(oldApp *argov1alpha1.Application, newApp *argov1alpha1.Application) bool {
+	return !reflect.DeepEqual(oldApp.Spec, newApp.Spec) ||
+		!reflect.DeepEqual(oldApp.Labels, newApp.Labels) ||
+		!reflect.DeepEqual(oldApp.Annotations, newApp.Annotations) ||
+		!reflect.DeepEqual(oldApp.Finalizers, newApp.Finalizers) ||
+		!reflect.DeepEqual(oldApp.OwnerReferences, newApp.OwnerReferences) ||
+		!oldApp.DeletionTimestamp.Equal(newApp.DeletionTimestamp)
+}
+
+// appRolloutStatusChanged returns whether the sync or health status of the Application changed, or the source and
+// destination they were computed for
+func appRolloutStatusChanged(oldApp *argov1alpha1.Application, newApp *argov1alpha1.Application) bool {
+	return oldApp.Status.Sync.Status != newApp.Status.Sync.Status ||
+		oldApp.Status.Health.Status != newApp.Status.Health.Status ||
+		!reflect.DeepEqual(oldApp.Status.Sync.ComparedTo, newApp.Status.Sync.ComparedTo)
+}
+
+// ownerHasRollingSync returns whether the Application is controlled by an ApplicationSet with a rollingSync strategy
+func ownerHasRollingSync(c client.Client, app *argov1alpha1.Application) bool {
+	owner := metav1.GetControllerOf(app)
+	if owner == nil || owner.Kind != "ApplicationSet" {
+		return false
+	}
+
+	var appSet argoprojiov1alpha1.ApplicationSet
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: app.Namespace, Name: owner.Name}, &appSet); err != nil {
+		return false
+	}
+	return appSet.UID == owner.UID && appSet.Spec.Strategy != nil && appSet.Spec.Strategy.RollingSync != nil
+}
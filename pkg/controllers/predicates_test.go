@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"testing"
+
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/health"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+)
+
+func TestApplicationSetPredicates(t *testing.T) {
+	appSet := &argoprojiov1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "appset",
+			Namespace:   "namespace",
+			Generation:  1,
+			Annotations: map[string]string{"annotation": "value"},
+		},
+	}
+
+	predicates := applicationSetPredicates()
+
+	assert.True(t, predicates.Create(event.CreateEvent{Meta: appSet, Object: appSet}))
+	assert.True(t, predicates.Delete(event.DeleteEvent{Meta: appSet, Object: appSet}))
+
+	for _, c := range []struct {
+		name     string
+		modify   func(appSet *argoprojiov1alpha1.ApplicationSet)
+		expected bool
+	}{
+		{
+			name: "status",
+			modify: func(appSet *argoprojiov1alpha1.ApplicationSet) {
+				appSet.Status.Applications = []argoprojiov1alpha1.ApplicationSetApplicationStatus{{Name: "app"}}
+				appSet.ResourceVersion = "2"
+			},
+			expected: false,
+		},
+		{
+			name: "spec",
+			modify: func(appSet *argoprojiov1alpha1.ApplicationSet) {
+				appSet.Spec.Template.Name = "app"
+				appSet.Generation = 2
+			},
+			expected: true,
+		},
+		{
+			name: "annotations",
+			modify: func(appSet *argoprojiov1alpha1.ApplicationSet) {
+				appSet.Annotations = map[string]string{"annotation": "other"}
+			},
+			expected: true,
+		},
+		{
+			name: "deletion",
+			modify: func(appSet *argoprojiov1alpha1.ApplicationSet) {
+				now := metav1.Now()
+				appSet.DeletionTimestamp = &now
+			},
+			expected: true,
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			newAppSet := appSet.DeepCopy()
+			cc.modify(newAppSet)
+			assert.Equal(t, cc.expected, predicates.Update(event.UpdateEvent{MetaOld: appSet, ObjectOld: appSet, MetaNew: newAppSet, ObjectNew: newAppSet}))
+		})
+	}
+}
+
+func TestOwnedApplicationPredicates(t *testing.T) {
+	scheme := runtime.NewScheme()
+	argoprojiov1alpha1.AddToScheme(scheme)
+	argov1alpha1.AddToScheme(scheme)
+
+	rollingSync := &argoprojiov1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "rolling-sync", Namespace: "namespace", UID: "rolling-sync"},
+		Spec: argoprojiov1alpha1.ApplicationSetSpec{
+			Strategy: &argoprojiov1alpha1.ApplicationSetStrategy{RollingSync: &argoprojiov1alpha1.ApplicationSetRollingSync{}},
+		},
+	}
+	allAtOnce := &argoprojiov1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "all-at-once", Namespace: "namespace", UID: "all-at-once"},
+	}
+	client := fake.NewFakeClientWithScheme(scheme, rollingSync, allAtOnce)
+
+	app := &argov1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "app",
+			Namespace:       "namespace",
+			Labels:          map[string]string{"label": "value"},
+			Annotations:     map[string]string{"annotation": "value"},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(rollingSync, argoprojiov1alpha1.GroupVersion.WithKind("ApplicationSet"))},
+		},
+		Spec: argov1alpha1.ApplicationSpec{Project: "default"},
+	}
+
+	predicates := ownedApplicationPredicates(client)
+
+	assert.False(t, predicates.Create(event.CreateEvent{Meta: app, Object: app}))
+	assert.True(t, predicates.Delete(event.DeleteEvent{Meta: app, Object: app}))
+
+	for _, c := range []struct {
+		name     string
+		modify   func(app *argov1alpha1.Application)
+		expected bool
+	}{
+		{
+			name: "status",
+			modify: func(app *argov1alpha1.Application) {
+				now := metav1.Now()
+				app.Status.ReconciledAt = &now
+				app.ResourceVersion = "2"
+			},
+			expected: false,
+		},
+		{
+			name: "sync status",
+			modify: func(app *argov1alpha1.Application) {
+				app.Status.Sync.Status = argov1alpha1.SyncStatusCodeOutOfSync
+			},
+			expected: true,
+		},
+		{
+			name: "health status",
+			modify: func(app *argov1alpha1.Application) {
+				app.Status.Health.Status = health.HealthStatusDegraded
+			},
+			expected: true,
+		},
+		{
+			name: "operation",
+			modify: func(app *argov1alpha1.Application) {
+				app.Operation = &argov1alpha1.Operation{Sync: &argov1alpha1.SyncOperation{Revision: "HEAD"}}
+			},
+			expected: false,
+		},
+		{
+			name: "spec",
+			modify: func(app *argov1alpha1.Application) {
+				app.Spec.Project = "other"
+			},
+			expected: true,
+		},
+		{
+			name: "labels",
+			modify: func(app *argov1alpha1.Application) {
+				app.Labels = map[string]string{"label": "other"}
+			},
+			expected: true,
+		},
+		{
+			name: "annotations",
+			modify: func(app *argov1alpha1.Application) {
+				app.Annotations = nil
+			},
+			expected: true,
+		},
+		{
+			name: "finalizers",
+			modify: func(app *argov1alpha1.Application) {
+				app.Finalizers = []string{"finalizer"}
+			},
+			expected: true,
+		},
+		{
+			name: "deletion",
+			modify: func(app *argov1alpha1.Application) {
+				now := metav1.Now()
+				app.DeletionTimestamp = &now
+			},
+			expected: true,
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			newApp := app.DeepCopy()
+			cc.modify(newApp)
+
+			got := predicates.Update(event.UpdateEvent{MetaOld: app, ObjectOld: app, MetaNew: newApp, ObjectNew: newApp})
+			assert.Equal(t, cc.expected, got)
+		})
+	}
+	// The sync and health status only gate the rollingSync strategy
+	t.Run("health status without rollingSync", func(t *testing.T) {
+		oldApp := app.DeepCopy()
+		oldApp.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(allAtOnce, argoprojiov1alpha1.GroupVersion.WithKind("ApplicationSet"))}
+		newApp := oldApp.DeepCopy()
+		newApp.Status.Health.Status = health.HealthStatusDegraded
+
+		got := predicates.Update(event.UpdateEvent{MetaOld: oldApp, ObjectOld: oldApp, MetaNew: newApp, ObjectNew: newApp})
+		assert.False(t, got)
+	})
+}
@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/health"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	"github.com/argoproj-labs/applicationset/pkg/utils"
+)
+
+// rolloutResult is the outcome of the rollingSync strategy of an ApplicationSet
+type rolloutResult struct {
+	// applications are the generated Applications to create or update now
+	applications []argov1alpha1.Application
+	// statuses are the rollout status of the generated Applications by name, with the waiting action for
+	// those which are not rolled out yet
+	statuses map[string]argoprojiov1alpha1.ApplicationSetApplicationStatus
+	// status is the progress of the rollout, nil without a rollingSync strategy
+	status *argoprojiov1alpha1.ApplicationSetRollingSyncStatus
+}
+
+// rolloutApplication is a generated Application, with the state of its live Application
+type rolloutApplication struct {
+	app argov1alpha1.Application
+	// upToDate is whether the live Application exists, and doesn't need to be updated
+	upToDate bool
+	// rolledOut is whether the live Application is synced and healthy
+	rolledOut bool
+}
+
+// rollout selects the generated Applications to create or update now with the rollingSync strategy of the
+// ApplicationSet. The current step is the first one whose Applications are not all up to date, synced and
+// healthy: up to maxUpdate of its Applications are rolled out at the same time, while those of the next steps
+// wait. The Applications which are already up to date are always selected. Without a rollingSync strategy,
+// all the Applications are.
+func (r *ApplicationSetReconciler) rollout(ctx context.Context, applicationSet *argoprojiov1alpha1.ApplicationSet, desiredApplications []argov1alpha1.Application, policy utils.Policy) (rolloutResult, error) {
+	if applicationSet.Spec.Strategy == nil || applicationSet.Spec.Strategy.RollingSync == nil {
+		return rolloutResult{applications: desiredApplications}, nil
+	}
+	steps := applicationSet.Spec.Strategy.RollingSync.Steps
+
+	selectors := make([]labels.Selector, len(steps))
+	for i, step := range steps {
+		selector, err := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{MatchExpressions: step.MatchExpressions})
+		if err != nil {
+			return rolloutResult{}, fmt.Errorf("invalid matchExpressions in step %d of the rollingSync strategy: %v", i+1, err)
+		}
+		selectors[i] = selector
+	}
+
+	// The Applications matching none of the steps are in an additional last step
+	stepApplications := make([][]rolloutApplication, len(steps)+1)
+	for _, app := range desiredApplications {
+		step := len(steps)
+		for i, selector := range selectors {
+			if selector.Matches(labels.Set(app.Labels)) {
+				step = i
+				break
+			}
+		}
+
+		rolloutApp, err := r.getRolloutApplication(ctx, applicationSet, app, policy)
+		if err != nil {
+			return rolloutResult{}, err
+		}
+		stepApplications[step] = append(stepApplications[step], rolloutApp)
+	}
+
+	res := rolloutResult{
+		statuses: map[string]argoprojiov1alpha1.ApplicationSetApplicationStatus{},
+		status:   &argoprojiov1alpha1.ApplicationSetRollingSyncStatus{Steps: int32(len(stepApplications))},
+	}
+	for i, apps := range stepApplications {
+		sort.Slice(apps, func(a, b int) bool {
+			return apps[a].app.Name < apps[b].app.Name
+		})
+
+		// The Applications of the current step being rolled out count against its maxUpdate
+		budget := 0
+		if res.status.CurrentStep == 0 && !stepRolledOut(apps) {
+			res.status.CurrentStep = int32(i + 1)
+
+			var step *argoprojiov1alpha1.ApplicationSetRolloutStep
+			if i < len(steps) {
+				step = &steps[i]
+			}
+			var err error
+			if budget, err = maxUpdate(step, len(apps)); err != nil {
+				return rolloutResult{}, fmt.Errorf("invalid maxUpdate in step %d of the rollingSync strategy: %v", i+1, err)
+			}
+			for _, app := range apps {
+				if app.upToDate && !app.rolledOut {
+					budget--
+				}
+			}
+		}
+
+		for _, app := range apps {
+			status := argoprojiov1alpha1.ApplicationSetApplicationStatus{Name: app.app.Name, Step: int32(i + 1)}
+			switch {
+			case app.upToDate && app.rolledOut:
+				status.RolloutStatus = argoprojiov1alpha1.ApplicationSetRolloutHealthy
+			case app.upToDate:
+				status.RolloutStatus = argoprojiov1alpha1.ApplicationSetRolloutProgressing
+			case budget > 0:
+				budget--
+				status.RolloutStatus = argoprojiov1alpha1.ApplicationSetRolloutProgressing
+			default:
+				status.LastAction = argoprojiov1alpha1.ApplicationSetApplicationActionWaiting
+				status.RolloutStatus = argoprojiov1alpha1.ApplicationSetRolloutWaiting
+			}
+
+			res.statuses[app.app.Name] = status
+			if status.RolloutStatus != argoprojiov1alpha1.ApplicationSetRolloutWaiting {
+				res.applications = append(res.applications, app.app)
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// applicationStatuses returns the status of the Applications created or updated, with their rollout status, and
+// of those waiting for their step
+func (res rolloutResult) applicationStatuses(applications []argoprojiov1alpha1.ApplicationSetApplicationStatus) []argoprojiov1alpha1.ApplicationSetApplicationStatus {
+	if res.status == nil {
+		return applications
+	}
+
+	var statuses []argoprojiov1alpha1.ApplicationSetApplicationStatus
+	for _, status := range applications {
+		if rolloutStatus, ok := res.statuses[status.Name]; ok {
+			status.Step = rolloutStatus.Step
+			status.RolloutStatus = rolloutStatus.RolloutStatus
+		}
+		statuses = append(statuses, status)
+	}
+	for _, status := range res.statuses {
+		if status.RolloutStatus == argoprojiov1alpha1.ApplicationSetRolloutWaiting {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// getRolloutApplication returns the state of the live Application of a generated Application
+func (r *ApplicationSetReconciler) getRolloutApplication(ctx context.Context, applicationSet *argoprojiov1alpha1.ApplicationSet, app argov1alpha1.Application, policy utils.Policy) (rolloutApplication, error) {
+	res := rolloutApplication{app: app}
+
+	var live argov1alpha1.Application
+	if err := r.Get(ctx, types.NamespacedName{Namespace: applicationSet.Namespace, Name: app.Name}, &live); err != nil {
+		if apierrors.IsNotFound(err) {
+			return res, nil
+		}
+		return res, err
+	}
+
+	res.upToDate = true
+	if policy.Update() {
+		generated := app.DeepCopy()
+		generated.Namespace = applicationSet.Namespace
+		updated := live.DeepCopy()
+		// An Application which can't be updated, e.g. because it's controlled by another owner, is rolled out
+		// like the others, its update reporting the error
+		if err := r.mutateApplication(applicationSet, updated, generated); err == nil {
+			res.upToDate = utils.Equal(&live, updated)
+		} else {
+			res.upToDate = false
+		}
+	}
+	res.rolledOut = applicationRolledOut(&live)
+
+	return res, nil
+}
+
+// applicationRolledOut returns whether Argo CD reports the Application as synced and healthy. The status must have
+// been computed for the current source and destination of the Application, as it's outdated right after an update.
+func applicationRolledOut(app *argov1alpha1.Application) bool {
+	return app.Status.Sync.Status == argov1alpha1.SyncStatusCodeSynced &&
+		app.Status.Health.Status == health.HealthStatusHealthy &&
+		utils.Equal(app.Status.Sync.ComparedTo, argov1alpha1.ComparedTo{Source: app.Spec.Source, Destination: app.Spec.Destination})
+}
+
+// stepRolledOut returns whether all the Applications of a step are up to date, synced and healthy
+func stepRolledOut(apps []rolloutApplication) bool {
+	for _, app := range apps {
+		if !app.upToDate || !app.rolledOut {
+			return false
+		}
+	}
+	return true
+}
+
+// maxUpdate returns the maximum number of Applications of a step rolled out at the same time, at least 1. The
+// step is nil for the Applications matching none of the steps, which are all rolled out at the same time.
+func maxUpdate(step *argoprojiov1alpha1.ApplicationSetRolloutStep, apps int) (int, error) {
+	if step == nil || step.MaxUpdate == nil {
+		return apps, nil
+	}
+
+	res, err := intstr.GetValueFromIntOrPercent(step.MaxUpdate, apps, true)
+	if err != nil {
+		return 0, err
+	}
+	if res < 1 {
+		res = 1
+	}
+	return res, nil
+}
@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/health"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	"github.com/argoproj-labs/applicationset/pkg/utils"
+)
+
+func TestRollout(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.NoError(t, argoprojiov1alpha1.AddToScheme(scheme))
+	assert.NoError(t, argov1alpha1.AddToScheme(scheme))
+
+	percent := func(s string) *intstr.IntOrString {
+		res := intstr.FromString(s)
+		return &res
+	}
+	rollingSync := func(steps ...argoprojiov1alpha1.ApplicationSetRolloutStep) *argoprojiov1alpha1.ApplicationSetStrategy {
+		return &argoprojiov1alpha1.ApplicationSetStrategy{
+			RollingSync: &argoprojiov1alpha1.ApplicationSetRollingSync{Steps: steps},
+		}
+	}
+	envStep := func(env string, max *intstr.IntOrString) argoprojiov1alpha1.ApplicationSetRolloutStep {
+		return argoprojiov1alpha1.ApplicationSetRolloutStep{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "env", Operator: metav1.LabelSelectorOpIn, Values: []string{env}},
+			},
+			MaxUpdate: max,
+		}
+	}
+	generated := func(name string, env string, project string) argov1alpha1.Application {
+		return argov1alpha1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"env": env}},
+			Spec:       argov1alpha1.ApplicationSpec{Project: project},
+		}
+	}
+
+	// liveApp is the live Application of a generated Application, with the project generated before
+	type liveApp struct {
+		name      string
+		env       string
+		project   string
+		rolledOut bool
+		// otherOwner is whether the live Application is controlled by another ApplicationSet
+		otherOwner bool
+	}
+
+	for _, c := range []struct {
+		name             string
+		strategy         *argoprojiov1alpha1.ApplicationSetStrategy
+		policy           utils.Policy
+		live             []liveApp
+		expectedApps     []string
+		expectedStatuses map[string]argoprojiov1alpha1.ApplicationSetApplicationStatus
+		expectedStatus   *argoprojiov1alpha1.ApplicationSetRollingSyncStatus
+		expectErr        bool
+	}{
+		{
+			name:         "no strategy",
+			expectedApps: []string{"dev-1", "dev-2", "other", "prod-1", "prod-2"},
+		},
+		{
+			name:         "first step is rolled out",
+			strategy:     rollingSync(envStep("dev", nil), envStep("prod", nil)),
+			expectedApps: []string{"dev-1", "dev-2"},
+			expectedStatuses: map[string]argoprojiov1alpha1.ApplicationSetApplicationStatus{
+				"dev-1":  {Name: "dev-1", Step: 1, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutProgressing},
+				"dev-2":  {Name: "dev-2", Step: 1, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutProgressing},
+				"prod-1": {Name: "prod-1", Step: 2, LastAction: "waiting", RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutWaiting},
+				"prod-2": {Name: "prod-2", Step: 2, LastAction: "waiting", RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutWaiting},
+				"other":  {Name: "other", Step: 3, LastAction: "waiting", RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutWaiting},
+			},
+			expectedStatus: &argoprojiov1alpha1.ApplicationSetRollingSyncStatus{CurrentStep: 1, Steps: 3},
+		},
+		{
+			name:     "next step once the previous one is synced and healthy",
+			strategy: rollingSync(envStep("dev", nil), envStep("prod", nil)),
+			live: []liveApp{
+				{name: "dev-1", env: "dev", project: "new", rolledOut: true},
+				{name: "dev-2", env: "dev", project: "new", rolledOut: true},
+				{name: "prod-1", env: "prod", project: "old", rolledOut: true},
+			},
+			expectedApps: []string{"dev-1", "dev-2", "prod-1", "prod-2"},
+			expectedStatuses: map[string]argoprojiov1alpha1.ApplicationSetApplicationStatus{
+				"dev-1":  {Name: "dev-1", Step: 1, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutHealthy},
+				"dev-2":  {Name: "dev-2", Step: 1, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutHealthy},
+				"prod-1": {Name: "prod-1", Step: 2, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutProgressing},
+				"prod-2": {Name: "prod-2", Step: 2, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutProgressing},
+				"other":  {Name: "other", Step: 3, LastAction: "waiting", RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutWaiting},
+			},
+			expectedStatus: &argoprojiov1alpha1.ApplicationSetRollingSyncStatus{CurrentStep: 2, Steps: 3},
+		},
+		{
+			name:     "step waits for its Applications to be healthy",
+			strategy: rollingSync(envStep("dev", nil), envStep("prod", nil)),
+			live: []liveApp{
+				{name: "dev-1", env: "dev", project: "new", rolledOut: true},
+				{name: "dev-2", env: "dev", project: "new", rolledOut: false},
+				{name: "prod-1", env: "prod", project: "new", rolledOut: true},
+			},
+			expectedApps: []string{"dev-1", "dev-2", "prod-1"},
+			expectedStatuses: map[string]argoprojiov1alpha1.ApplicationSetApplicationStatus{
+				"dev-1":  {Name: "dev-1", Step: 1, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutHealthy},
+				"dev-2":  {Name: "dev-2", Step: 1, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutProgressing},
+				"prod-1": {Name: "prod-1", Step: 2, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutHealthy},
+				"prod-2": {Name: "prod-2", Step: 2, LastAction: "waiting", RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutWaiting},
+				"other":  {Name: "other", Step: 3, LastAction: "waiting", RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutWaiting},
+			},
+			expectedStatus: &argoprojiov1alpha1.ApplicationSetRollingSyncStatus{CurrentStep: 1, Steps: 3},
+		},
+		{
+			name:     "maxUpdate counts the Applications being rolled out",
+			strategy: rollingSync(envStep("prod", percent("50%"))),
+			live: []liveApp{
+				{name: "prod-1", env: "prod", project: "new", rolledOut: false},
+				{name: "prod-2", env: "prod", project: "old", rolledOut: true},
+			},
+			expectedApps: []string{"prod-1"},
+			expectedStatuses: map[string]argoprojiov1alpha1.ApplicationSetApplicationStatus{
+				"prod-1": {Name: "prod-1", Step: 1, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutProgressing},
+				"prod-2": {Name: "prod-2", Step: 1, LastAction: "waiting", RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutWaiting},
+				"dev-1":  {Name: "dev-1", Step: 2, LastAction: "waiting", RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutWaiting},
+				"dev-2":  {Name: "dev-2", Step: 2, LastAction: "waiting", RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutWaiting},
+				"other":  {Name: "other", Step: 2, LastAction: "waiting", RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutWaiting},
+			},
+			expectedStatus: &argoprojiov1alpha1.ApplicationSetRollingSyncStatus{CurrentStep: 1, Steps: 2},
+		},
+		{
+			name:     "all the steps are rolled out",
+			strategy: rollingSync(envStep("dev", nil)),
+			policy:   &utils.CreateOnlyPolicy{},
+			live: []liveApp{
+				{name: "dev-1", env: "dev", project: "old", rolledOut: true},
+				{name: "dev-2", env: "dev", project: "old", rolledOut: true},
+				{name: "prod-1", env: "prod", project: "old", rolledOut: true},
+				{name: "prod-2", env: "prod", project: "old", rolledOut: true},
+				{name: "other", env: "other", project: "old", rolledOut: true},
+			},
+			expectedApps: []string{"dev-1", "dev-2", "other", "prod-1", "prod-2"},
+			expectedStatuses: map[string]argoprojiov1alpha1.ApplicationSetApplicationStatus{
+				"dev-1":  {Name: "dev-1", Step: 1, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutHealthy},
+				"dev-2":  {Name: "dev-2", Step: 1, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutHealthy},
+				"prod-1": {Name: "prod-1", Step: 2, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutHealthy},
+				"prod-2": {Name: "prod-2", Step: 2, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutHealthy},
+				"other":  {Name: "other", Step: 2, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutHealthy},
+			},
+			expectedStatus: &argoprojiov1alpha1.ApplicationSetRollingSyncStatus{CurrentStep: 0, Steps: 2},
+		},
+		{
+			name:     "Applications controlled by another owner don't fail the rollout",
+			strategy: rollingSync(envStep("dev", nil), envStep("prod", nil)),
+			live: []liveApp{
+				{name: "dev-1", env: "dev", project: "new", rolledOut: true, otherOwner: true},
+				{name: "dev-2", env: "dev", project: "new", rolledOut: true},
+			},
+			expectedApps:   []string{"dev-1", "dev-2"},
+			expectedStatus: &argoprojiov1alpha1.ApplicationSetRollingSyncStatus{CurrentStep: 1, Steps: 3},
+		},
+		{
+			name: "invalid matchExpressions",
+			strategy: rollingSync(argoprojiov1alpha1.ApplicationSetRolloutStep{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "env", Operator: "Invalid"}},
+			}),
+			expectErr: true,
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			appSet := argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "name", Namespace: "namespace"},
+				Spec:       argoprojiov1alpha1.ApplicationSetSpec{Strategy: cc.strategy},
+			}
+			r := ApplicationSetReconciler{Scheme: scheme}
+
+			initObjs := []runtime.Object{&appSet}
+			for _, l := range cc.live {
+				app := generated(l.name, l.env, l.project)
+				live := app.DeepCopy()
+				live.Namespace = appSet.Namespace
+				assert.NoError(t, r.mutateApplication(&appSet, live, &app))
+				if l.otherOwner {
+					other := &argoprojiov1alpha1.ApplicationSet{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: appSet.Namespace, UID: "other"}}
+					live.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(other, argoprojiov1alpha1.GroupVersion.WithKind("ApplicationSet"))}
+				}
+				if l.rolledOut {
+					live.Status.Sync.Status = argov1alpha1.SyncStatusCodeSynced
+					live.Status.Sync.ComparedTo = argov1alpha1.ComparedTo{Source: live.Spec.Source, Destination: live.Spec.Destination}
+					live.Status.Health.Status = health.HealthStatusHealthy
+				}
+				initObjs = append(initObjs, live)
+			}
+			r.Client = fake.NewFakeClientWithScheme(scheme, initObjs...)
+
+			policy := cc.policy
+			if policy == nil {
+				policy = &utils.SyncPolicy{}
+			}
+			got, err := r.rollout(context.TODO(), &appSet, []argov1alpha1.Application{
+				generated("dev-1", "dev", "new"),
+				generated("dev-2", "dev", "new"),
+				generated("other", "other", "new"),
+				generated("prod-1", "prod", "new"),
+				generated("prod-2", "prod", "new"),
+			}, policy)
+			if cc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			var gotApps []string
+			for _, app := range got.applications {
+				gotApps = append(gotApps, app.Name)
+			}
+			assert.ElementsMatch(t, cc.expectedApps, gotApps)
+			if cc.expectedStatuses != nil {
+				assert.Equal(t, cc.expectedStatuses, got.statuses)
+			}
+			assert.Equal(t, cc.expectedStatus, got.status)
+		})
+	}
+}
+
+func TestRolloutApplicationStatuses(t *testing.T) {
+	rollout := rolloutResult{
+		statuses: map[string]argoprojiov1alpha1.ApplicationSetApplicationStatus{
+			"app1": {Name: "app1", Step: 1, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutProgressing},
+			"app2": {Name: "app2", Step: 2, LastAction: "waiting", RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutWaiting},
+		},
+		status: &argoprojiov1alpha1.ApplicationSetRollingSyncStatus{CurrentStep: 1, Steps: 2},
+	}
+
+	got := rollout.applicationStatuses([]argoprojiov1alpha1.ApplicationSetApplicationStatus{
+		{Name: "app1", LastAction: "updated"},
+	})
+	assert.Equal(t, []argoprojiov1alpha1.ApplicationSetApplicationStatus{
+		{Name: "app1", LastAction: "updated", Step: 1, RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutProgressing},
+		{Name: "app2", Step: 2, LastAction: "waiting", RolloutStatus: argoprojiov1alpha1.ApplicationSetRolloutWaiting},
+	}, got)
+
+	// Without a rollingSync strategy, the statuses are unchanged
+	applications := []argoprojiov1alpha1.ApplicationSetApplicationStatus{{Name: "app1", LastAction: "updated"}}
+	assert.Equal(t, applications, rolloutResult{}.applicationStatuses(applications))
+}
@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+)
+
+// reconcileResult is the outcome of a reconciliation of an ApplicationSet, reported in its status
+type reconcileResult struct {
+	// applications are the generated Applications, with the action taken on them
+	applications []argoprojiov1alpha1.ApplicationSetApplicationStatus
+	generateErr  error
+	updateErr    error
+	deleteErr    error
+	// rollout is the progress of the rollingSync strategy, if any
+	rollout *argoprojiov1alpha1.ApplicationSetRollingSyncStatus
+}
+
+// updateStatus sets the status of the ApplicationSet from the result of its reconciliation. The status is only
+// written when it changed, as each write triggers another reconciliation.
+func (r *ApplicationSetReconciler) updateStatus(ctx context.Context, applicationSet *argoprojiov1alpha1.ApplicationSet, result reconcileResult) error {
+	status := buildStatus(applicationSet.Status, result, metav1.Now())
+	status.ObservedGeneration = applicationSet.Generation
+
+	if reflect.DeepEqual(status, applicationSet.Status) {
+		return nil
+	}
+
+	applicationSet.Status = status
+	return r.Client.Status().Update(ctx, applicationSet)
+}
+
+// buildStatus returns the status matching the result of a reconciliation. The LastTransitionTime of the
+// conditions of the previous status is kept when their status did not change.
+func buildStatus(previous argoprojiov1alpha1.ApplicationSetStatus, result reconcileResult, now metav1.Time) argoprojiov1alpha1.ApplicationSetStatus {
+	errorOccurred := argoprojiov1alpha1.ApplicationSetCondition{
+		Type:   argoprojiov1alpha1.ApplicationSetConditionErrorOccurred,
+		Status: argoprojiov1alpha1.ApplicationSetConditionStatusFalse,
+		Reason: argoprojiov1alpha1.ApplicationSetReasonApplicationSetUpToDate,
+	}
+	parametersGenerated := argoprojiov1alpha1.ApplicationSetCondition{
+		Type:    argoprojiov1alpha1.ApplicationSetConditionParametersGenerated,
+		Status:  argoprojiov1alpha1.ApplicationSetConditionStatusTrue,
+		Reason:  argoprojiov1alpha1.ApplicationSetReasonParametersGenerated,
+		Message: "Successfully generated parameters for all Applications",
+	}
+	resourcesUpToDate := argoprojiov1alpha1.ApplicationSetCondition{
+		Type:    argoprojiov1alpha1.ApplicationSetConditionResourcesUpToDate,
+		Status:  argoprojiov1alpha1.ApplicationSetConditionStatusTrue,
+		Reason:  argoprojiov1alpha1.ApplicationSetReasonApplicationSetUpToDate,
+		Message: "All applications have been generated successfully",
+	}
+
+	// The first error is reported, as the reconciliation stops there
+	var reason string
+	var err error
+	switch {
+	case result.updateErr != nil:
+		reason, err = argoprojiov1alpha1.ApplicationSetReasonUpdateApplicationError, result.updateErr
+	case result.generateErr != nil:
+		reason, err = argoprojiov1alpha1.ApplicationSetReasonApplicationGenerationFailed, result.generateErr
+	case isDeletionsBlocked(result.deleteErr):
+		reason, err = argoprojiov1alpha1.ApplicationSetReasonDeletionBlocked, result.deleteErr
+	case result.deleteErr != nil:
+		reason, err = argoprojiov1alpha1.ApplicationSetReasonDeleteApplicationError, result.deleteErr
+	}
+	if err != nil {
+		errorOccurred.Status = argoprojiov1alpha1.ApplicationSetConditionStatusTrue
+		errorOccurred.Reason = reason
+		errorOccurred.Message = err.Error()
+		resourcesUpToDate.Status = argoprojiov1alpha1.ApplicationSetConditionStatusFalse
+		resourcesUpToDate.Reason = reason
+		resourcesUpToDate.Message = err.Error()
+	}
+	if err == nil && result.rollout != nil && result.rollout.CurrentStep != 0 {
+		resourcesUpToDate.Status = argoprojiov1alpha1.ApplicationSetConditionStatusFalse
+		resourcesUpToDate.Reason = argoprojiov1alpha1.ApplicationSetReasonRolloutProgressing
+		resourcesUpToDate.Message = fmt.Sprintf("Rolling out step %d of %d", result.rollout.CurrentStep, result.rollout.Steps)
+	}
+	if result.generateErr != nil {
+		parametersGenerated.Status = argoprojiov1alpha1.ApplicationSetConditionStatusFalse
+		parametersGenerated.Reason = argoprojiov1alpha1.ApplicationSetReasonApplicationGenerationFailed
+		parametersGenerated.Message = result.generateErr.Error()
+	}
+
+	status := argoprojiov1alpha1.ApplicationSetStatus{
+		ObservedGeneration: previous.ObservedGeneration,
+		RollingSync:        result.rollout,
+	}
+	for _, condition := range []argoprojiov1alpha1.ApplicationSetCondition{errorOccurred, parametersGenerated, resourcesUpToDate} {
+		condition.LastTransitionTime = &now
+		for _, previousCondition := range previous.Conditions {
+			if previousCondition.Type == condition.Type && previousCondition.Status == condition.Status {
+				condition.LastTransitionTime = previousCondition.LastTransitionTime
+			}
+		}
+		status.Conditions = append(status.Conditions, condition)
+	}
+
+	status.Applications = append(status.Applications, result.applications...)
+	sort.Slice(status.Applications, func(i, j int) bool {
+		return status.Applications[i].Name < status.Applications[j].Name
+	})
+
+	return status
+}
@@ -0,0 +1,214 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+)
+
+func TestBuildStatus(t *testing.T) {
+	before := metav1.NewTime(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	now := metav1.NewTime(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC))
+
+	upToDate := []argoprojiov1alpha1.ApplicationSetCondition{
+		{
+			Type:               argoprojiov1alpha1.ApplicationSetConditionErrorOccurred,
+			Status:             argoprojiov1alpha1.ApplicationSetConditionStatusFalse,
+			Reason:             argoprojiov1alpha1.ApplicationSetReasonApplicationSetUpToDate,
+			LastTransitionTime: &before,
+		},
+		{
+			Type:               argoprojiov1alpha1.ApplicationSetConditionParametersGenerated,
+			Status:             argoprojiov1alpha1.ApplicationSetConditionStatusTrue,
+			Reason:             argoprojiov1alpha1.ApplicationSetReasonParametersGenerated,
+			Message:            "Successfully generated parameters for all Applications",
+			LastTransitionTime: &before,
+		},
+		{
+			Type:               argoprojiov1alpha1.ApplicationSetConditionResourcesUpToDate,
+			Status:             argoprojiov1alpha1.ApplicationSetConditionStatusTrue,
+			Reason:             argoprojiov1alpha1.ApplicationSetReasonApplicationSetUpToDate,
+			Message:            "All applications have been generated successfully",
+			LastTransitionTime: &before,
+		},
+	}
+
+	for _, c := range []struct {
+		name     string
+		previous argoprojiov1alpha1.ApplicationSetStatus
+		result   reconcileResult
+		expected argoprojiov1alpha1.ApplicationSetStatus
+	}{
+		{
+			name:     "up to date, the transition times are kept",
+			previous: argoprojiov1alpha1.ApplicationSetStatus{ObservedGeneration: 1, Conditions: upToDate},
+			result: reconcileResult{applications: []argoprojiov1alpha1.ApplicationSetApplicationStatus{
+				{Name: "b", LastAction: "unchanged"},
+				{Name: "a", LastAction: "created"},
+			}},
+			expected: argoprojiov1alpha1.ApplicationSetStatus{
+				ObservedGeneration: 1,
+				Conditions:         upToDate,
+				Applications: []argoprojiov1alpha1.ApplicationSetApplicationStatus{
+					{Name: "a", LastAction: "created"},
+					{Name: "b", LastAction: "unchanged"},
+				},
+			},
+		},
+		{
+			name:     "generation error",
+			previous: argoprojiov1alpha1.ApplicationSetStatus{Conditions: upToDate},
+			result:   reconcileResult{generateErr: errors.New("generate")},
+			expected: argoprojiov1alpha1.ApplicationSetStatus{
+				Conditions: []argoprojiov1alpha1.ApplicationSetCondition{
+					{
+						Type:               argoprojiov1alpha1.ApplicationSetConditionErrorOccurred,
+						Status:             argoprojiov1alpha1.ApplicationSetConditionStatusTrue,
+						Reason:             argoprojiov1alpha1.ApplicationSetReasonApplicationGenerationFailed,
+						Message:            "generate",
+						LastTransitionTime: &now,
+					},
+					{
+						Type:               argoprojiov1alpha1.ApplicationSetConditionParametersGenerated,
+						Status:             argoprojiov1alpha1.ApplicationSetConditionStatusFalse,
+						Reason:             argoprojiov1alpha1.ApplicationSetReasonApplicationGenerationFailed,
+						Message:            "generate",
+						LastTransitionTime: &now,
+					},
+					{
+						Type:               argoprojiov1alpha1.ApplicationSetConditionResourcesUpToDate,
+						Status:             argoprojiov1alpha1.ApplicationSetConditionStatusFalse,
+						Reason:             argoprojiov1alpha1.ApplicationSetReasonApplicationGenerationFailed,
+						Message:            "generate",
+						LastTransitionTime: &now,
+					},
+				},
+			},
+		},
+		{
+			name:   "update and delete errors",
+			result: reconcileResult{updateErr: errors.New("update"), deleteErr: errors.New("delete")},
+			expected: argoprojiov1alpha1.ApplicationSetStatus{
+				Conditions: []argoprojiov1alpha1.ApplicationSetCondition{
+					{
+						Type:               argoprojiov1alpha1.ApplicationSetConditionErrorOccurred,
+						Status:             argoprojiov1alpha1.ApplicationSetConditionStatusTrue,
+						Reason:             argoprojiov1alpha1.ApplicationSetReasonUpdateApplicationError,
+						Message:            "update",
+						LastTransitionTime: &now,
+					},
+					{
+						Type:               argoprojiov1alpha1.ApplicationSetConditionParametersGenerated,
+						Status:             argoprojiov1alpha1.ApplicationSetConditionStatusTrue,
+						Reason:             argoprojiov1alpha1.ApplicationSetReasonParametersGenerated,
+						Message:            "Successfully generated parameters for all Applications",
+						LastTransitionTime: &now,
+					},
+					{
+						Type:               argoprojiov1alpha1.ApplicationSetConditionResourcesUpToDate,
+						Status:             argoprojiov1alpha1.ApplicationSetConditionStatusFalse,
+						Reason:             argoprojiov1alpha1.ApplicationSetReasonUpdateApplicationError,
+						Message:            "update",
+						LastTransitionTime: &now,
+					},
+				},
+			},
+		},
+		{
+			name:     "rollout in progress",
+			previous: argoprojiov1alpha1.ApplicationSetStatus{Conditions: upToDate},
+			result: reconcileResult{
+				rollout: &argoprojiov1alpha1.ApplicationSetRollingSyncStatus{CurrentStep: 1, Steps: 2},
+			},
+			expected: argoprojiov1alpha1.ApplicationSetStatus{
+				Conditions: []argoprojiov1alpha1.ApplicationSetCondition{
+					upToDate[0],
+					upToDate[1],
+					{
+						Type:               argoprojiov1alpha1.ApplicationSetConditionResourcesUpToDate,
+						Status:             argoprojiov1alpha1.ApplicationSetConditionStatusFalse,
+						Reason:             argoprojiov1alpha1.ApplicationSetReasonRolloutProgressing,
+						Message:            "Rolling out step 1 of 2",
+						LastTransitionTime: &now,
+					},
+				},
+				RollingSync: &argoprojiov1alpha1.ApplicationSetRollingSyncStatus{CurrentStep: 1, Steps: 2},
+			},
+		},
+		{
+			name:   "deletion blocked",
+			result: reconcileResult{deleteErr: &deletionsBlockedError{deletions: 2, current: 3, max: 1, hash: "0123456789abcdef"}},
+			expected: argoprojiov1alpha1.ApplicationSetStatus{
+				Conditions: []argoprojiov1alpha1.ApplicationSetCondition{
+					{
+						Type:               argoprojiov1alpha1.ApplicationSetConditionErrorOccurred,
+						Status:             argoprojiov1alpha1.ApplicationSetConditionStatusTrue,
+						Reason:             argoprojiov1alpha1.ApplicationSetReasonDeletionBlocked,
+						Message:            "deleting 2 of the 3 Applications exceeds the maximum of 1 deletions, annotate the ApplicationSet with applicationset.argoproj.io/allow-deletions=0123456789abcdef to allow them",
+						LastTransitionTime: &now,
+					},
+					{
+						Type:               argoprojiov1alpha1.ApplicationSetConditionParametersGenerated,
+						Status:             argoprojiov1alpha1.ApplicationSetConditionStatusTrue,
+						Reason:             argoprojiov1alpha1.ApplicationSetReasonParametersGenerated,
+						Message:            "Successfully generated parameters for all Applications",
+						LastTransitionTime: &now,
+					},
+					{
+						Type:               argoprojiov1alpha1.ApplicationSetConditionResourcesUpToDate,
+						Status:             argoprojiov1alpha1.ApplicationSetConditionStatusFalse,
+						Reason:             argoprojiov1alpha1.ApplicationSetReasonDeletionBlocked,
+						Message:            "deleting 2 of the 3 Applications exceeds the maximum of 1 deletions, annotate the ApplicationSet with applicationset.argoproj.io/allow-deletions=0123456789abcdef to allow them",
+						LastTransitionTime: &now,
+					},
+				},
+			},
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			got := buildStatus(cc.previous, cc.result, now)
+			assert.Equal(t, cc.expected, got)
+		})
+	}
+}
+
+func TestUpdateStatus(t *testing.T) {
+	scheme := runtime.NewScheme()
+	argoprojiov1alpha1.AddToScheme(scheme)
+	argov1alpha1.AddToScheme(scheme)
+
+	appSet := &argoprojiov1alpha1.ApplicationSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "name", Namespace: "namespace", Generation: 2},
+	}
+	client := fake.NewFakeClientWithScheme(scheme, appSet)
+	r := ApplicationSetReconciler{Client: client, Scheme: scheme}
+
+	var got argoprojiov1alpha1.ApplicationSet
+	key := types.NamespacedName{Namespace: "namespace", Name: "name"}
+	assert.NoError(t, client.Get(context.TODO(), key, &got))
+
+	result := reconcileResult{applications: []argoprojiov1alpha1.ApplicationSetApplicationStatus{{Name: "app", LastAction: "created"}}}
+	assert.NoError(t, r.updateStatus(context.TODO(), &got, result))
+
+	assert.NoError(t, client.Get(context.TODO(), key, &got))
+	assert.Equal(t, int64(2), got.Status.ObservedGeneration)
+	assert.Len(t, got.Status.Conditions, 3)
+	assert.Equal(t, []argoprojiov1alpha1.ApplicationSetApplicationStatus{{Name: "app", LastAction: "created"}}, got.Status.Applications)
+
+	// An unchanged status is not written again
+	resourceVersion := got.ResourceVersion
+	assert.NoError(t, r.updateStatus(context.TODO(), &got, result))
+	assert.NoError(t, client.Get(context.TODO(), key, &got))
+	assert.Equal(t, resourceVersion, got.ResourceVersion)
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	"github.com/argoproj-labs/applicationset/pkg/utils"
+)
+
+// getTemplate returns the template of the generated Applications: the template referenced by the templateRef of
+// the ApplicationSet, if any, overridden by the fields set in its inline template.
+func (r *ApplicationSetReconciler) getTemplate(ctx context.Context, applicationSetInfo *argoprojiov1alpha1.ApplicationSet) (*argoprojiov1alpha1.ApplicationSetTemplate, error) {
+	templateRef := applicationSetInfo.Spec.TemplateRef
+	if templateRef == nil {
+		return &applicationSetInfo.Spec.Template, nil
+	}
+
+	var referenced *argoprojiov1alpha1.ApplicationSetTemplate
+	switch {
+	case templateRef.Name != "" && templateRef.Git != nil:
+		return nil, fmt.Errorf("templateRef must set either name or git, not both")
+	case templateRef.Name != "":
+		var template argoprojiov1alpha1.SharedApplicationSetTemplate
+		key := types.NamespacedName{Namespace: applicationSetInfo.Namespace, Name: templateRef.Name}
+		if err := r.Get(ctx, key, &template); err != nil {
+			return nil, fmt.Errorf("failed to get SharedApplicationSetTemplate %q: %v", templateRef.Name, err)
+		}
+		referenced = &template.Template
+	case templateRef.Git != nil:
+		if r.Repos == nil {
+			return nil, fmt.Errorf("templateRef.git is not supported by this controller")
+		}
+		// The template is read from the commit the revision resolves to, whose files are cached
+		git := templateRef.Git
+		revision, err := r.Repos.GetRevision(ctx, git.RepoURL, git.Revision)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve revision %q of %s: %v", git.Revision, git.RepoURL, err)
+		}
+		content, err := r.Repos.GetFileContent(ctx, git.RepoURL, revision.SHA, git.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template %s from %s: %v", git.Path, git.RepoURL, err)
+		}
+		referenced, err = utils.DecodeTemplate(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template %s from %s: %v", git.Path, git.RepoURL, err)
+		}
+	default:
+		return nil, fmt.Errorf("templateRef must set either name or git")
+	}
+
+	return utils.MergeTemplates(referenced, &applicationSetInfo.Spec.Template)
+}
+
+// applicationSetsForTemplate maps a SharedApplicationSetTemplate to the ApplicationSets of its namespace which
+// reference it, so that they are reconciled when it changes.
+func (r *ApplicationSetReconciler) applicationSetsForTemplate(a handler.MapObject) []reconcile.Request {
+	appSetList := &argoprojiov1alpha1.ApplicationSetList{}
+	if err := r.List(context.Background(), appSetList, client.InNamespace(a.Meta.GetNamespace())); err != nil {
+		log.WithError(err).Error("unable to list ApplicationSets")
+		return nil
+	}
+
+	var res []reconcile.Request
+	for _, appSet := range appSetList.Items {
+		if appSet.Spec.TemplateRef != nil && appSet.Spec.TemplateRef.Name == a.Meta.GetName() {
+			res = append(res, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: appSet.Namespace, Name: appSet.Name}})
+		}
+	}
+	return res
+}
@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/argoproj-labs/applicationset/pkg/services"
+	"github.com/argoproj-labs/applicationset/pkg/utils"
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+)
+
+// filesApps is a fake Apps serving the files of a single repository, whose revisions all resolve to the commit "sha".
+// The files are only served for the resolved commit, as callers must not read them from a moving revision.
+type filesApps struct {
+	services.Apps
+	files map[string]string
+}
+
+func (a *filesApps) GetFileContent(ctx context.Context, repoURL string, revision string, path string) ([]byte, error) {
+	if revision != "sha" {
+		return nil, fmt.Errorf("revision %q is not resolved", revision)
+	}
+	content, ok := a.files[repoURL+"/"+path]
+	if !ok {
+		return nil, errors.New("file not found")
+	}
+	return []byte(content), nil
+}
+
+func (a *filesApps) GetRevision(ctx context.Context, repoURL string, revision string) (*services.Revision, error) {
+	return &services.Revision{SHA: "sha"}, nil
+}
+
+func TestGetTemplate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	argoprojiov1alpha1.AddToScheme(scheme)
+	argov1alpha1.AddToScheme(scheme)
+
+	sharedTemplate, err := utils.DecodeTemplate([]byte(`
+metadata:
+  name: '{{cluster}}-guestbook'
+  labels:
+    team: platform
+spec:
+  project: default
+  source:
+    repoURL: https://github.com/argoproj/argo-cd.git
+    path: guestbook
+  destination:
+    server: '{{url}}'
+    namespace: guestbook
+`))
+	assert.NoError(t, err)
+
+	client := fake.NewFakeClientWithScheme(scheme, &argoprojiov1alpha1.SharedApplicationSetTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "guestbook", Namespace: "argocd"},
+		Template:   *sharedTemplate,
+	})
+	repos := &filesApps{files: map[string]string{
+		"https://github.com/argoproj/templates.git/guestbook.yaml": `
+metadata:
+  name: '{{cluster}}-guestbook'
+spec:
+  project: default
+  source:
+    path: guestbook
+`,
+	}}
+
+	for _, c := range []struct {
+		name        string
+		templateRef *argoprojiov1alpha1.ApplicationSetTemplateRef
+		template    string
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "no templateRef",
+			template: `{"metadata":{"name":"app"},"spec":{"project":"default"}}`,
+			expected: `{"metadata":{"name":"app","creationTimestamp":null},"spec":{"project":"default"}}`,
+		},
+		{
+			name:        "SharedApplicationSetTemplate",
+			templateRef: &argoprojiov1alpha1.ApplicationSetTemplateRef{Name: "guestbook"},
+			template:    `{"metadata":{},"spec":{}}`,
+			expected: `{"metadata":{"name":"{{cluster}}-guestbook","creationTimestamp":null,"labels":{"team":"platform"}},` +
+				`"spec":{"destination":{"namespace":"guestbook","server":"{{url}}"},"project":"default","source":{"path":"guestbook","repoURL":"https://github.com/argoproj/argo-cd.git"}}}`,
+		},
+		{
+			name:        "the inline template overrides the referenced one",
+			templateRef: &argoprojiov1alpha1.ApplicationSetTemplateRef{Name: "guestbook"},
+			template:    `{"metadata":{"labels":{"env":"prod"}},"spec":{"source":{"path":"guestbook-prod"},"destination":{"namespace":""}}}`,
+			expected: `{"metadata":{"name":"{{cluster}}-guestbook","creationTimestamp":null,"labels":{"env":"prod","team":"platform"}},` +
+				`"spec":{"destination":{"namespace":"guestbook","server":"{{url}}"},"project":"default","source":{"path":"guestbook-prod","repoURL":"https://github.com/argoproj/argo-cd.git"}}}`,
+		},
+		{
+			name: "git",
+			templateRef: &argoprojiov1alpha1.ApplicationSetTemplateRef{Git: &argoprojiov1alpha1.GitTemplateRef{
+				RepoURL: "https://github.com/argoproj/templates.git",
+				Path:    "guestbook.yaml",
+			}},
+			template: `{"metadata":{},"spec":{"source":{"repoURL":"https://github.com/argoproj/argo-cd.git"}}}`,
+			expected: `{"metadata":{"name":"{{cluster}}-guestbook","creationTimestamp":null},` +
+				`"spec":{"project":"default","source":{"path":"guestbook","repoURL":"https://github.com/argoproj/argo-cd.git"}}}`,
+		},
+		{
+			name:        "missing SharedApplicationSetTemplate",
+			templateRef: &argoprojiov1alpha1.ApplicationSetTemplateRef{Name: "missing"},
+			template:    `{"metadata":{},"spec":{}}`,
+			expectedErr: `failed to get SharedApplicationSetTemplate "missing"`,
+		},
+		{
+			name: "missing git file",
+			templateRef: &argoprojiov1alpha1.ApplicationSetTemplateRef{Git: &argoprojiov1alpha1.GitTemplateRef{
+				RepoURL: "https://github.com/argoproj/templates.git",
+				Path:    "missing.yaml",
+			}},
+			template:    `{"metadata":{},"spec":{}}`,
+			expectedErr: "failed to read template missing.yaml from https://github.com/argoproj/templates.git: file not found",
+		},
+		{
+			name: "name and git",
+			templateRef: &argoprojiov1alpha1.ApplicationSetTemplateRef{Name: "guestbook", Git: &argoprojiov1alpha1.GitTemplateRef{
+				RepoURL: "https://github.com/argoproj/templates.git",
+				Path:    "guestbook.yaml",
+			}},
+			template:    `{"metadata":{},"spec":{}}`,
+			expectedErr: "templateRef must set either name or git, not both",
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			r := ApplicationSetReconciler{
+				Client: client,
+				Scheme: scheme,
+				Repos:  repos,
+			}
+			template, err := utils.DecodeTemplate([]byte(cc.template))
+			assert.NoError(t, err)
+
+			got, err := r.getTemplate(context.TODO(), &argoprojiov1alpha1.ApplicationSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "set", Namespace: "argocd"},
+				Spec: argoprojiov1alpha1.ApplicationSetSpec{
+					Template:    *template,
+					TemplateRef: cc.templateRef,
+				},
+			})
+
+			if cc.expectedErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), cc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			gotJSON, err := json.Marshal(got)
+			assert.NoError(t, err)
+			assert.JSONEq(t, cc.expected, string(gotJSON))
+		})
+	}
+}
+
+func TestApplicationSetsForTemplate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	argoprojiov1alpha1.AddToScheme(scheme)
+	argov1alpha1.AddToScheme(scheme)
+
+	appSet := func(namespace string, name string, templateRef *argoprojiov1alpha1.ApplicationSetTemplateRef) *argoprojiov1alpha1.ApplicationSet {
+		return &argoprojiov1alpha1.ApplicationSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       argoprojiov1alpha1.ApplicationSetSpec{TemplateRef: templateRef},
+		}
+	}
+
+	client := fake.NewFakeClientWithScheme(scheme,
+		appSet("argocd", "ref", &argoprojiov1alpha1.ApplicationSetTemplateRef{Name: "guestbook"}),
+		appSet("argocd", "other-ref", &argoprojiov1alpha1.ApplicationSetTemplateRef{Name: "other"}),
+		appSet("argocd", "git-ref", &argoprojiov1alpha1.ApplicationSetTemplateRef{Git: &argoprojiov1alpha1.GitTemplateRef{Path: "guestbook"}}),
+		appSet("argocd", "inline", nil),
+		appSet("other", "other-namespace", &argoprojiov1alpha1.ApplicationSetTemplateRef{Name: "guestbook"}),
+	)
+	r := ApplicationSetReconciler{Client: client, Scheme: scheme}
+
+	template := &argoprojiov1alpha1.SharedApplicationSetTemplate{ObjectMeta: metav1.ObjectMeta{Name: "guestbook", Namespace: "argocd"}}
+	got := r.applicationSetsForTemplate(handler.MapObject{Meta: template, Object: template})
+
+	assert.Equal(t, []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: "argocd", Name: "ref"}}}, got)
+}
@@ -38,7 +38,7 @@ func (g *ClusterGenerator) GetRequeueAfter(appSetGenerator *argoprojiov1alpha1.A
 }
 
 func (g *ClusterGenerator) GenerateParams(
-	appSetGenerator *argoprojiov1alpha1.ApplicationSetGenerator) ([]map[string]string, error) {
+	ctx context.Context, appSetGenerator *argoprojiov1alpha1.ApplicationSetGenerator) ([]map[string]interface{}, error) {
 
 	if appSetGenerator == nil {
 		return nil, EmptyAppSetGeneratorError
@@ -57,14 +57,14 @@ func (g *ClusterGenerator) GenerateParams(
 		return nil, err
 	}
 
-	if err := g.Client.List(context.Background(), clusterSecretList, client.MatchingLabelsSelector{secretSelector}); err != nil {
+	if err := g.Client.List(ctx, clusterSecretList, client.MatchingLabelsSelector{secretSelector}); err != nil {
 		return nil, err
 	}
 	log.Debug("clusters matching labels", "count", len(clusterSecretList.Items))
 
-	res := make([]map[string]string, len(clusterSecretList.Items))
+	res := make([]map[string]interface{}, len(clusterSecretList.Items))
 	for i, cluster := range clusterSecretList.Items {
-		params := make(map[string]string, len(cluster.ObjectMeta.Annotations)+len(cluster.ObjectMeta.Labels)+2)
+		params := make(map[string]interface{}, len(cluster.ObjectMeta.Annotations)+len(cluster.ObjectMeta.Labels)+2)
 		params["name"] = string(cluster.Data["name"])
 		params["server"] = string(cluster.Data["server"])
 		for key, value := range cluster.ObjectMeta.Annotations {
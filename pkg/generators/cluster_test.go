@@ -84,13 +84,13 @@ func TestGenerateParams(t *testing.T) {
 	}
 	testCases := []struct {
 		selector      metav1.LabelSelector
-		expected      []map[string]string
+		expected      []map[string]interface{}
 		clientError   bool
 		expectedError error
 	}{
 		{
 			metav1.LabelSelector{},
-			[]map[string]string{
+			[]map[string]interface{}{
 				{"name": "c3RhZ2luZy0wMQ==", "server": "https://staging-01.example.com", "metadata.labels.environment": "staging", "metadata.labels.org": "foo", "metadata.labels.argocd.argoproj.io/secret-type": "cluster", "metadata.annotations.foo.argoproj.io": "staging"},
 				{"name": "cHJvZHVjdGlvbi0wMQ==", "server": "https://production-01.example.com", "metadata.labels.environment": "production", "metadata.labels.org": "bar", "metadata.labels.argocd.argoproj.io/secret-type": "cluster", "metadata.annotations.foo.argoproj.io": "production"},
 			},
@@ -103,7 +103,7 @@ func TestGenerateParams(t *testing.T) {
 					"environment": "production",
 				},
 			},
-			[]map[string]string{
+			[]map[string]interface{}{
 				{"name": "cHJvZHVjdGlvbi0wMQ==", "server": "https://production-01.example.com", "metadata.labels.environment": "production", "metadata.labels.org": "bar", "metadata.labels.argocd.argoproj.io/secret-type": "cluster", "metadata.annotations.foo.argoproj.io": "production"},
 			},
 			false,
@@ -122,7 +122,7 @@ func TestGenerateParams(t *testing.T) {
 					},
 				},
 			},
-			[]map[string]string{
+			[]map[string]interface{}{
 				{"name": "c3RhZ2luZy0wMQ==", "server": "https://staging-01.example.com", "metadata.labels.environment": "staging", "metadata.labels.org": "foo", "metadata.labels.argocd.argoproj.io/secret-type": "cluster", "metadata.annotations.foo.argoproj.io": "staging"},
 				{"name": "cHJvZHVjdGlvbi0wMQ==", "server": "https://production-01.example.com", "metadata.labels.environment": "production", "metadata.labels.org": "bar", "metadata.labels.argocd.argoproj.io/secret-type": "cluster", "metadata.annotations.foo.argoproj.io": "production"},
 			},
@@ -145,7 +145,7 @@ func TestGenerateParams(t *testing.T) {
 					"org": "foo",
 				},
 			},
-			[]map[string]string{
+			[]map[string]interface{}{
 				{"name": "c3RhZ2luZy0wMQ==", "server": "https://staging-01.example.com", "metadata.labels.environment": "staging", "metadata.labels.org": "foo", "metadata.labels.argocd.argoproj.io/secret-type": "cluster", "metadata.annotations.foo.argoproj.io": "staging"},
 			},
 			false,
@@ -168,7 +168,7 @@ func TestGenerateParams(t *testing.T) {
 
 		var clusterGenerator = NewClusterGenerator(cl)
 
-		got, err := clusterGenerator.GenerateParams(&argoprojiov1alpha1.ApplicationSetGenerator{
+		got, err := clusterGenerator.GenerateParams(context.TODO(), &argoprojiov1alpha1.ApplicationSetGenerator{
 			Clusters: &argoprojiov1alpha1.ClusterGenerator{
 				Selector: testCase.selector,
 			},
@@ -2,8 +2,15 @@ package generators
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
 	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
 	"github.com/argoproj-labs/applicationset/pkg/services"
+	"github.com/argoproj-labs/applicationset/pkg/utils"
 	log "github.com/sirupsen/logrus"
 	"path"
 	"time"
@@ -26,7 +33,7 @@ func (g * GitGenerator) GetRequeueAfter(appSetGenerator *argoprojiov1alpha1.Appl
 	return time.Duration(appSetGenerator.Git.RequeueAfterSeconds) * time.Second
 }
 
-func (g *GitGenerator) GenerateParams(appSetGenerator *argoprojiov1alpha1.ApplicationSetGenerator) ([]map[string]string, error) {
+func (g *GitGenerator) GenerateParams(ctx context.Context, appSetGenerator *argoprojiov1alpha1.ApplicationSetGenerator) ([]map[string]interface{}, error) {
 
 	if appSetGenerator == nil {
 		return nil, EmptyAppSetGeneratorError
@@ -36,7 +43,18 @@ func (g *GitGenerator) GenerateParams(appSetGenerator *argoprojiov1alpha1.Applic
 		return nil, EmptyAppSetGeneratorError
 	}
 
-	allApps, err := g.repos.GetApps(context.TODO(), appSetGenerator.Git.RepoURL, appSetGenerator.Git.Revision)
+	if len(appSetGenerator.Git.Branches) > 0 {
+		return g.generateParamsForBranches(ctx, appSetGenerator)
+	}
+
+	// Resolve the revision first, so that all applications are generated from the same commit,
+	// even if the revision is moved while generating
+	revision, err := g.repos.GetRevision(ctx, appSetGenerator.Git.RepoURL, appSetGenerator.Git.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	allApps, err := g.repos.GetApps(ctx, appSetGenerator.Git.RepoURL, revision.SHA)
 	if err != nil {
 		return nil, err
 	}
@@ -46,11 +64,12 @@ func (g *GitGenerator) GenerateParams(appSetGenerator *argoprojiov1alpha1.Applic
 		"total": len(allApps),
 		"repoURL": appSetGenerator.Git.RepoURL,
 		"revision": appSetGenerator.Git.Revision,
+		"sha": revision.SHA,
 	}).Info("applications result from the repo service")
 
 	requestedApps := g.filter(appSetGenerator.Git.Directories, allApps)
 
-	res := g.generateParams(requestedApps, appSetGenerator)
+	res := g.generateParams(requestedApps, revision)
 
 	return res, nil
 }
@@ -73,17 +92,152 @@ func (g *GitGenerator) filter(Directories []argoprojiov1alpha1.GitDirectoryGener
 	return res
 }
 
-func (g *GitGenerator) generateParams(requestedApps []string, appSetGenerator *argoprojiov1alpha1.ApplicationSetGenerator) []map[string]string {
+func (g *GitGenerator) generateParams(requestedApps []string, revision *services.Revision) []map[string]interface{} {
 
-	res := make([]map[string]string, len(requestedApps))
+	res := make([]map[string]interface{}, len(requestedApps))
 	for i, a := range requestedApps {
 
-		params := make(map[string]string, 2)
+		params := make(map[string]interface{}, 4)
 		params["path"] = a
 		params["path.basename"] = path.Base(a)
+		setRevisionParams(params, revision)
 
 		res[i] = params
 	}
 
 	return res
 }
+
+// generateParamsForBranches generates one set of params per remote branch matching any of the requested regexes
+func (g *GitGenerator) generateParamsForBranches(ctx context.Context, appSetGenerator *argoprojiov1alpha1.ApplicationSetGenerator) ([]map[string]interface{}, error) {
+	var filters []*regexp.Regexp
+	for _, requested := range appSetGenerator.Git.Branches {
+		// Anchor the expression, so that 'feature/.*' does not match 'old-feature/foo'
+		r, err := regexp.Compile("^(?:" + requested.Regex + ")$")
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, r)
+	}
+
+	branches, err := g.repos.GetBranches(ctx, appSetGenerator.Git.RepoURL)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"total":   len(branches),
+		"repoURL": appSetGenerator.Git.RepoURL,
+	}).Info("branches result from the repo service")
+
+	res := []map[string]interface{}{}
+	for _, branch := range branches {
+		for _, r := range filters {
+			if r.MatchString(branch.Name) {
+				// The branches are already resolved to their commit, which only needs to be read for its date
+				revision := &services.Revision{SHA: branch.SHA}
+				if revisionDateUsed(ctx) {
+					revision, err = g.repos.GetRevision(ctx, appSetGenerator.Git.RepoURL, branch.SHA)
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				params := make(map[string]interface{}, 5)
+				params["branch"] = branch.Name
+				params["branch.slug"] = slugify(branch.Name)
+				params["sha"] = branch.SHA
+				setRevisionParams(params, revision)
+				res = append(res, params)
+				break
+			}
+		}
+	}
+	disambiguateSlugs(res)
+
+	return res, nil
+}
+
+// setRevisionParams adds the commit the params were generated from, which is also recorded
+// on the generated Application. The date is left out when it wasn't read.
+func setRevisionParams(params map[string]interface{}, revision *services.Revision) {
+	params[utils.RevisionSHAKeyName] = revision.SHA
+	if !revision.Date.IsZero() {
+		params[utils.RevisionDateKeyName] = revision.Date.UTC().Format(time.RFC3339)
+	}
+}
+
+type revisionDateKey struct{}
+
+// WithoutRevisionDate returns a context telling the Git generator that the template doesn't use the revision.date
+// param, so that it doesn't read the commit of every branch for its date.
+func WithoutRevisionDate(ctx context.Context) context.Context {
+	return context.WithValue(ctx, revisionDateKey{}, false)
+}
+
+// revisionDateUsed returns whether the revision.date param is used, which it's assumed to be unless told otherwise
+func revisionDateUsed(ctx context.Context) bool {
+	used, ok := ctx.Value(revisionDateKey{}).(bool)
+	return !ok || used
+}
+
+var invalidSlugChars = regexp.MustCompile("[^a-z0-9-]+")
+
+// slugify converts a branch name to a DNS-1123 label, e.g. 'feature/JIRA_123' to 'feature-jira-123'. A branch name
+// without any allowed character, e.g. made of non-ASCII characters only, is converted to a hash of the name.
+func slugify(name string) string {
+	slug := truncateSlug(invalidSlugChars.ReplaceAllString(strings.ToLower(name), "-"), 63)
+	if slug == "" {
+		return branchHash(name, 0)
+	}
+	return slug
+}
+
+// truncateSlug truncates the slug to at most max characters, without leading or trailing dash
+func truncateSlug(slug string, max int) string {
+	if len(slug) > max {
+		slug = slug[:max]
+	}
+	return strings.Trim(slug, "-")
+}
+
+// branchHash returns a short hash of the branch name. Different attempts return different hashes.
+func branchHash(branch string, attempt int) string {
+	if attempt > 0 {
+		branch = fmt.Sprintf("%s#%d", branch, attempt)
+	}
+	hash := sha256.Sum256([]byte(branch))
+	return hex.EncodeToString(hash[:])[:8]
+}
+
+// disambiguateSlugs suffixes the slugs shared by several branches, e.g. 'feature/a_b' and 'feature/a-b', with a
+// hash of the branch name, so that they don't generate Applications overwriting each other. The slugs of the
+// other branches are kept as is.
+// A suffixed slug may still be the slug of another branch, e.g. of a branch named after it, so it's checked against
+// all the slugs in use, and hashed again until it's unique.
+func disambiguateSlugs(params []map[string]interface{}) {
+	branches := map[string]int{}
+	used := map[string]bool{}
+	for _, p := range params {
+		slug := p["branch.slug"].(string)
+		branches[slug]++
+		used[slug] = true
+	}
+
+	for _, p := range params {
+		slug := p["branch.slug"].(string)
+		if branches[slug] < 2 {
+			continue
+		}
+		for attempt := 0; ; attempt++ {
+			suffixed := truncateSlug(slug, 63-9) + "-" + branchHash(p["branch"].(string), attempt)
+			if !used[suffixed] {
+				p["branch.slug"] = suffixed
+				used[suffixed] = true
+				break
+			}
+		}
+		log.WithField("branch", p["branch"]).WithField("slug", p["branch.slug"]).
+			Warn("branch slug shared by several branches, suffixed with a hash of the branch name")
+	}
+}
@@ -2,14 +2,19 @@ package generators
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	"github.com/argoproj-labs/applicationset/pkg/services"
 	"github.com/argoproj/argo-cd/reposerver/apiclient"
 	"github.com/argoproj/gitops-engine/pkg/utils/io"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
 	"testing"
+	"time"
 )
 
 type clientSet struct {
@@ -24,12 +29,42 @@ type argoCDServiceMock struct {
 	mock.Mock
 }
 
-func (a argoCDServiceMock) GetApps(ctx context.Context, repoURL string, revision string) ([]string, error) {
+func (a *argoCDServiceMock) GetApps(ctx context.Context, repoURL string, revision string) ([]string, error) {
 	args := a.Called(ctx, repoURL, revision)
 
 	return args.Get(0).([]string), args.Error(1)
 }
 
+func (a *argoCDServiceMock) GetBranches(ctx context.Context, repoURL string) ([]services.Branch, error) {
+	args := a.Called(ctx, repoURL)
+
+	return args.Get(0).([]services.Branch), args.Error(1)
+}
+
+func (a *argoCDServiceMock) GetRevision(ctx context.Context, repoURL string, revision string) (*services.Revision, error) {
+	args := a.Called(ctx, repoURL, revision)
+
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*services.Revision), args.Error(1)
+}
+
+func (a *argoCDServiceMock) ResolveRevision(ctx context.Context, repoURL string, revision string) (string, error) {
+	args := a.Called(ctx, repoURL, revision)
+
+	return args.String(0), args.Error(1)
+}
+
+func (a *argoCDServiceMock) GetFileContent(ctx context.Context, repoURL string, revision string, path string) ([]byte, error) {
+	args := a.Called(ctx, repoURL, revision, path)
+
+	return args.Get(0).([]byte), args.Error(1)
+}
+
+var testRevisionDate = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
 func TestGitGenerateParams(t *testing.T) {
 
 	cases := []struct {
@@ -37,7 +72,7 @@ func TestGitGenerateParams(t *testing.T) {
 		directories   []argoprojiov1alpha1.GitDirectoryGeneratorItem
 		repoApps      []string
 		repoError     error
-		expected      []map[string]string
+		expected      []map[string]interface{}
 		expectedError error
 	}{
 		{
@@ -49,9 +84,9 @@ func TestGitGenerateParams(t *testing.T) {
 					"p1/app3",
 			},
 			repoError: nil,
-			expected: []map[string]string{
-				{"path": "app1", "path.basename": "app1"},
-				{"path": "app2", "path.basename": "app2"},
+			expected: []map[string]interface{}{
+				{"path": "app1", "path.basename": "app1", "revision.sha": "sha", "revision.date": "2020-01-01T00:00:00Z"},
+				{"path": "app2", "path.basename": "app2", "revision.sha": "sha", "revision.date": "2020-01-01T00:00:00Z"},
 			},
 			expectedError: nil,
 		},
@@ -65,9 +100,9 @@ func TestGitGenerateParams(t *testing.T) {
 				"p1/p2/p3/app4",
 			},
 			repoError: nil,
-			expected: []map[string]string{
-				{"path": "p1/app2", "path.basename": "app2"},
-				{"path": "p1/p2/app3", "path.basename": "app3"},
+			expected: []map[string]interface{}{
+				{"path": "p1/app2", "path.basename": "app2", "revision.sha": "sha", "revision.date": "2020-01-01T00:00:00Z"},
+				{"path": "p1/p2/app3", "path.basename": "app3", "revision.sha": "sha", "revision.date": "2020-01-01T00:00:00Z"},
 			},
 			expectedError: nil,
 		},
@@ -76,7 +111,7 @@ func TestGitGenerateParams(t *testing.T) {
 			directories: []argoprojiov1alpha1.GitDirectoryGeneratorItem{{"*"}},
 			repoApps: []string{},
 			repoError: nil,
-			expected: []map[string]string{},
+			expected: []map[string]interface{}{},
 			expectedError:nil,
 		},
 		{
@@ -84,7 +119,7 @@ func TestGitGenerateParams(t *testing.T) {
 			directories: []argoprojiov1alpha1.GitDirectoryGeneratorItem{{"*"}},
 			repoApps: []string{},
 			repoError: fmt.Errorf("error"),
-			expected: []map[string]string{},
+			expected: []map[string]interface{}{},
 			expectedError: fmt.Errorf("error"),
 		},
 	}
@@ -92,8 +127,10 @@ func TestGitGenerateParams(t *testing.T) {
 	for _, c := range cases {
 		cc := c
 		t.Run(cc.name, func(t *testing.T) {
-			argoCDServiceMock := argoCDServiceMock{}
-			argoCDServiceMock.On("GetApps", mock.Anything, mock.Anything, mock.Anything).Return(c.repoApps, c.repoError)
+			argoCDServiceMock := &argoCDServiceMock{}
+			argoCDServiceMock.On("GetRevision", mock.Anything, "RepoURL", "Revision").
+				Return(&services.Revision{SHA: "sha", Date: testRevisionDate}, nil)
+			argoCDServiceMock.On("GetApps", mock.Anything, "RepoURL", "sha").Return(c.repoApps, c.repoError)
 
 			var gitGenerator = NewGitGenerator(argoCDServiceMock)
 			applicationSetInfo := argoprojiov1alpha1.ApplicationSet{
@@ -111,7 +148,7 @@ func TestGitGenerateParams(t *testing.T) {
 				},
 			}
 
-			got, err := gitGenerator.GenerateParams(&applicationSetInfo.Spec.Generators[0])
+			got, err := gitGenerator.GenerateParams(context.TODO(), &applicationSetInfo.Spec.Generators[0])
 
 			if c.expectedError != nil {
 				assert.EqualError(t, err, c.expectedError.Error())
@@ -125,3 +162,209 @@ func TestGitGenerateParams(t *testing.T) {
 	}
 
 }
+
+func TestGitGenerateParamsRevisionError(t *testing.T) {
+	argoCDServiceMock := &argoCDServiceMock{}
+	argoCDServiceMock.On("GetRevision", mock.Anything, "RepoURL", "Revision").Return(nil, fmt.Errorf("error"))
+
+	var gitGenerator = NewGitGenerator(argoCDServiceMock)
+	_, err := gitGenerator.GenerateParams(context.TODO(), &argoprojiov1alpha1.ApplicationSetGenerator{
+		Git: &argoprojiov1alpha1.GitGenerator{
+			RepoURL:     "RepoURL",
+			Revision:    "Revision",
+			Directories: []argoprojiov1alpha1.GitDirectoryGeneratorItem{{Path: "*"}},
+		},
+	})
+
+	assert.EqualError(t, err, "error")
+	argoCDServiceMock.AssertNotCalled(t, "GetApps", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGitGenerateParamsFromBranches(t *testing.T) {
+
+	cases := []struct {
+		name          string
+		branches      []argoprojiov1alpha1.GitBranchGeneratorItem
+		repoBranches  []services.Branch
+		repoError     error
+		expected      []map[string]interface{}
+		expectedError error
+	}{
+		{
+			name:     "happy flow - matching branches",
+			branches: []argoprojiov1alpha1.GitBranchGeneratorItem{{Regex: "feature/.*"}},
+			repoBranches: []services.Branch{
+				{Name: "feature/Add_Login", SHA: "sha1"},
+				{Name: "master", SHA: "sha2"},
+				{Name: "old-feature/foo", SHA: "sha3"},
+			},
+			expected: []map[string]interface{}{
+				{"branch": "feature/Add_Login", "branch.slug": "feature-add-login", "sha": "sha1", "revision.sha": "sha1", "revision.date": "2020-01-01T00:00:00Z"},
+			},
+		},
+		{
+			name:     "a branch matching several regexes is generated once",
+			branches: []argoprojiov1alpha1.GitBranchGeneratorItem{{Regex: "feature/.*"}, {Regex: ".*"}},
+			repoBranches: []services.Branch{
+				{Name: "feature/foo", SHA: "sha1"},
+				{Name: "master", SHA: "sha2"},
+			},
+			expected: []map[string]interface{}{
+				{"branch": "feature/foo", "branch.slug": "feature-foo", "sha": "sha1", "revision.sha": "sha1", "revision.date": "2020-01-01T00:00:00Z"},
+				{"branch": "master", "branch.slug": "master", "sha": "sha2", "revision.sha": "sha2", "revision.date": "2020-01-01T00:00:00Z"},
+			},
+		},
+		{
+			name:     "slugs shared by several branches are suffixed with a hash",
+			branches: []argoprojiov1alpha1.GitBranchGeneratorItem{{Regex: "feature/.*"}},
+			repoBranches: []services.Branch{
+				{Name: "feature/a_b", SHA: "sha1"},
+				{Name: "feature/a-b", SHA: "sha2"},
+				{Name: "feature/c", SHA: "sha3"},
+			},
+			expected: []map[string]interface{}{
+				{"branch": "feature/a_b", "branch.slug": "feature-a-b-" + slugHash("feature/a_b"), "sha": "sha1", "revision.sha": "sha1", "revision.date": "2020-01-01T00:00:00Z"},
+				{"branch": "feature/a-b", "branch.slug": "feature-a-b-" + slugHash("feature/a-b"), "sha": "sha2", "revision.sha": "sha2", "revision.date": "2020-01-01T00:00:00Z"},
+				{"branch": "feature/c", "branch.slug": "feature-c", "sha": "sha3", "revision.sha": "sha3", "revision.date": "2020-01-01T00:00:00Z"},
+			},
+		},
+		{
+			name:         "handles empty response from repo server",
+			branches:     []argoprojiov1alpha1.GitBranchGeneratorItem{{Regex: ".*"}},
+			repoBranches: []services.Branch{},
+			expected:     []map[string]interface{}{},
+		},
+		{
+			name:          "handles error from repo server",
+			branches:      []argoprojiov1alpha1.GitBranchGeneratorItem{{Regex: ".*"}},
+			repoBranches:  []services.Branch{},
+			repoError:     fmt.Errorf("error"),
+			expectedError: fmt.Errorf("error"),
+		},
+	}
+
+	for _, c := range cases {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			argoCDServiceMock := &argoCDServiceMock{}
+			argoCDServiceMock.On("GetBranches", mock.Anything, "RepoURL").Return(cc.repoBranches, cc.repoError)
+			for _, expected := range cc.expected {
+				argoCDServiceMock.On("GetRevision", mock.Anything, "RepoURL", expected["sha"]).
+					Return(&services.Revision{SHA: expected["sha"].(string), Date: testRevisionDate}, nil)
+			}
+
+			var gitGenerator = NewGitGenerator(argoCDServiceMock)
+			got, err := gitGenerator.GenerateParams(context.TODO(), &argoprojiov1alpha1.ApplicationSetGenerator{
+				Git: &argoprojiov1alpha1.GitGenerator{
+					RepoURL:  "RepoURL",
+					Branches: cc.branches,
+				},
+			})
+
+			if cc.expectedError != nil {
+				assert.EqualError(t, err, cc.expectedError.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, cc.expected, got)
+			}
+
+			argoCDServiceMock.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGitGenerateParamsFromBranchesWithoutRevisionDate(t *testing.T) {
+	argoCDServiceMock := &argoCDServiceMock{}
+	argoCDServiceMock.On("GetBranches", mock.Anything, "RepoURL").Return([]services.Branch{{Name: "feature/foo", SHA: "sha1"}}, nil)
+
+	var gitGenerator = NewGitGenerator(argoCDServiceMock)
+	got, err := gitGenerator.GenerateParams(WithoutRevisionDate(context.TODO()), &argoprojiov1alpha1.ApplicationSetGenerator{
+		Git: &argoprojiov1alpha1.GitGenerator{
+			RepoURL:  "RepoURL",
+			Branches: []argoprojiov1alpha1.GitBranchGeneratorItem{{Regex: "feature/.*"}},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"branch": "feature/foo", "branch.slug": "feature-foo", "sha": "sha1", "revision.sha": "sha1"},
+	}, got)
+	argoCDServiceMock.AssertNotCalled(t, "GetRevision", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGitGenerateParamsInvalidBranchRegex(t *testing.T) {
+	argoCDServiceMock := &argoCDServiceMock{}
+
+	var gitGenerator = NewGitGenerator(argoCDServiceMock)
+	_, err := gitGenerator.GenerateParams(context.TODO(), &argoprojiov1alpha1.ApplicationSetGenerator{
+		Git: &argoprojiov1alpha1.GitGenerator{
+			RepoURL:  "RepoURL",
+			Branches: []argoprojiov1alpha1.GitBranchGeneratorItem{{Regex: "feature/("}},
+		},
+	})
+
+	assert.Error(t, err)
+	argoCDServiceMock.AssertNotCalled(t, "GetBranches", mock.Anything, mock.Anything)
+}
+
+func slugHash(branch string) string {
+	hash := sha256.Sum256([]byte(branch))
+	return hex.EncodeToString(hash[:])[:8]
+}
+
+func TestDisambiguateSlugs(t *testing.T) {
+	long := "feature/" + strings.Repeat("a", 60)
+	params := []map[string]interface{}{
+		{"branch": long + "_1", "branch.slug": slugify(long + "_1")},
+		{"branch": long + "_2", "branch.slug": slugify(long + "_2")},
+	}
+	disambiguateSlugs(params)
+
+	for _, p := range params {
+		slug := p["branch.slug"].(string)
+		assert.Len(t, slug, 63)
+		assert.True(t, strings.HasSuffix(slug, "-"+slugHash(p["branch"].(string))), slug)
+	}
+	assert.NotEqual(t, params[0]["branch.slug"], params[1]["branch.slug"])
+}
+
+func TestDisambiguateSlugsUnique(t *testing.T) {
+	// The slug suffixed with a hash is the slug of another branch
+	params := []map[string]interface{}{
+		{"branch": "feature/a_b", "branch.slug": slugify("feature/a_b")},
+		{"branch": "feature/a-b", "branch.slug": slugify("feature/a-b")},
+		{"branch": "feature/a-b-" + slugHash("feature/a_b"), "branch.slug": slugify("feature/a-b-" + slugHash("feature/a_b"))},
+		// Branches without any allowed character
+		{"branch": "///", "branch.slug": slugify("///")},
+		{"branch": slugHash("///"), "branch.slug": slugify(slugHash("///"))},
+	}
+	disambiguateSlugs(params)
+
+	slugs := map[string]bool{}
+	for _, p := range params {
+		slug := p["branch.slug"].(string)
+		assert.NotEmpty(t, slug)
+		assert.LessOrEqual(t, len(slug), 63)
+		assert.False(t, slugs[slug], "duplicate slug %s", slug)
+		slugs[slug] = true
+	}
+	// The slug of the branch named after the suffixed slug is kept
+	assert.Equal(t, "feature-a-b-"+slugHash("feature/a_b"), params[2]["branch.slug"])
+	assert.Equal(t, "feature-a-b-"+slugHash("feature/a-b"), params[1]["branch.slug"])
+}
+
+func TestSlugify(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		expected string
+	}{
+		{"master", "master"},
+		{"feature/JIRA_123", "feature-jira-123"},
+		{"-release/1.0-", "release-1-0"},
+		{"feature/" + strings.Repeat("a", 60), "feature-" + strings.Repeat("a", 55)},
+		{"///", slugHash("///")},
+		{"功能/登录", slugHash("功能/登录")},
+	} {
+		assert.Equal(t, c.expected, slugify(c.name))
+	}
+}
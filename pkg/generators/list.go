@@ -1,6 +1,9 @@
 package generators
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
 	"github.com/argoproj-labs/applicationset/pkg/utils"
 	"time"
@@ -21,7 +24,7 @@ func (g * ListGenerator) GetRequeueAfter(appSetGenerator *argoprojiov1alpha1.App
 	return NoRequeueAfter
 }
 
-func (g *ListGenerator) GenerateParams(appSetGenerator *argoprojiov1alpha1.ApplicationSetGenerator) ([]map[string]string, error) {
+func (g *ListGenerator) GenerateParams(ctx context.Context, appSetGenerator *argoprojiov1alpha1.ApplicationSetGenerator) ([]map[string]interface{}, error) {
 	if appSetGenerator == nil {
 		return nil, EmptyAppSetGeneratorError
 	}
@@ -30,12 +33,23 @@ func (g *ListGenerator) GenerateParams(appSetGenerator *argoprojiov1alpha1.Appli
 		return nil, nil
 	}
 
-	res := make([]map[string]string, len(appSetGenerator.List.Elements))
+	res := make([]map[string]interface{}, len(appSetGenerator.List.Elements))
 
 	for i, tmpItem := range appSetGenerator.List.Elements {
-		params := make(map[string]string, 2)
+		params := make(map[string]interface{}, 3)
 		params[utils.ClusterListGeneratorKeyName] = tmpItem.Cluster
 		params[utils.UrlGeneratorKeyName] = tmpItem.Url
+		if len(tmpItem.Values) > 0 {
+			values := make(map[string]interface{}, len(tmpItem.Values))
+			for key, value := range tmpItem.Values {
+				var v interface{}
+				if err := json.Unmarshal(value.Raw, &v); err != nil {
+					return nil, fmt.Errorf("invalid value %s of element %s: %v", key, tmpItem.Cluster, err)
+				}
+				values[key] = v
+			}
+			params[utils.ValuesListGeneratorKeyName] = values
+		}
 		res[i] = params
 	}
 
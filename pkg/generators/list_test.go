@@ -0,0 +1,72 @@
+package generators
+
+import (
+	"context"
+	"testing"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func TestGenerateListParams(t *testing.T) {
+	testCases := []struct {
+		name          string
+		elements      []argoprojiov1alpha1.ListGeneratorElement
+		expected      []map[string]interface{}
+		expectedError bool
+	}{
+		{
+			name:     "cluster and url",
+			elements: []argoprojiov1alpha1.ListGeneratorElement{{Cluster: "cluster", Url: "url"}},
+			expected: []map[string]interface{}{{"cluster": "cluster", "url": "url"}},
+		},
+		{
+			name: "typed values",
+			elements: []argoprojiov1alpha1.ListGeneratorElement{{
+				Cluster: "cluster",
+				Url:     "url",
+				Values: map[string]apiextensionsv1.JSON{
+					"prune":    {Raw: []byte(`true`)},
+					"replicas": {Raw: []byte(`3`)},
+					"image":    {Raw: []byte(`{"tag": "v1"}`)},
+				},
+			}},
+			expected: []map[string]interface{}{{
+				"cluster": "cluster",
+				"url":     "url",
+				"values": map[string]interface{}{
+					"prune":    true,
+					"replicas": float64(3),
+					"image":    map[string]interface{}{"tag": "v1"},
+				},
+			}},
+		},
+		{
+			name: "invalid value",
+			elements: []argoprojiov1alpha1.ListGeneratorElement{{
+				Cluster: "cluster",
+				Values:  map[string]apiextensionsv1.JSON{"prune": {Raw: []byte(`{`)}},
+			}},
+			expectedError: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		cc := testCase
+		t.Run(cc.name, func(t *testing.T) {
+			var listGenerator = NewListGenerator()
+
+			got, err := listGenerator.GenerateParams(context.TODO(), &argoprojiov1alpha1.ApplicationSetGenerator{
+				List: &argoprojiov1alpha1.ListGenerator{Elements: cc.elements},
+			})
+
+			if cc.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, cc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	argogit "github.com/argoproj/argo-cd/util/git"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var cacheRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "applicationset_repo_cache_requests_total",
+		Help: "Number of repository requests served by the cache, by method and result (hit or miss)",
+	},
+	[]string{"method", "result"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(cacheRequests)
+}
+
+var _ Apps = (*cachedApps)(nil)
+
+// defaultLoadTimeout is the maximum duration of a request made on a cache miss. The request is shared by all the
+// callers waiting for it, so it doesn't run with the context, and timeout, of any of them.
+const defaultLoadTimeout = 5 * time.Minute
+
+// cachedApps wraps an Apps, caching the results of the requests made for a commit SHA. As the content of
+// a commit never changes, these results can be shared by all the ApplicationSets using the same repository,
+// until the revision they track moves to another commit.
+// Requests for branches, tags or HEAD are not cached, except for GetRevision, which resolves them to a commit SHA
+// first, so that only the metadata of the commit is cached.
+type cachedApps struct {
+	Apps
+	ttl  time.Duration
+	size int
+	// loadTimeout is the maximum duration of a request made on a cache miss
+	loadTimeout time.Duration
+	// now returns the current time, and is overridden in tests
+	now func() time.Time
+
+	// group de-duplicates concurrent identical requests
+	group singleflight.Group
+
+	lock sync.Mutex
+	// lru holds the entries, the most recently used first
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type cachedAppsEntry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// NewCachedApps returns an Apps caching the results of apps for at most ttl. At most size results are
+// cached, the least recently used ones being evicted first.
+func NewCachedApps(apps Apps, ttl time.Duration, size int) Apps {
+	return &cachedApps{
+		Apps:        apps,
+		ttl:         ttl,
+		size:        size,
+		loadTimeout: defaultLoadTimeout,
+		now:         time.Now,
+		lru:         list.New(),
+		entries:     map[string]*list.Element{},
+	}
+}
+
+func (c *cachedApps) GetApps(ctx context.Context, repoURL string, revision string) ([]string, error) {
+	if !argogit.IsCommitSHA(revision) {
+		return c.Apps.GetApps(ctx, repoURL, revision)
+	}
+
+	value, err := c.getOrLoad(ctx, "GetApps", repoURL, revision, func(ctx context.Context) (interface{}, error) {
+		return c.Apps.GetApps(ctx, repoURL, revision)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Return a copy, so that callers can't modify the cached value
+	return append([]string{}, value.([]string)...), nil
+}
+
+func (c *cachedApps) GetRevision(ctx context.Context, repoURL string, revision string) (*Revision, error) {
+	sha := revision
+	if !argogit.IsCommitSHA(revision) {
+		var err error
+		sha, err = c.Apps.ResolveRevision(ctx, repoURL, revision)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	value, err := c.getOrLoad(ctx, "GetRevision", repoURL, sha, func(ctx context.Context) (interface{}, error) {
+		return c.Apps.GetRevision(ctx, repoURL, sha)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := *value.(*Revision)
+	return &res, nil
+}
+
+func (c *cachedApps) GetFileContent(ctx context.Context, repoURL string, revision string, path string) ([]byte, error) {
+	if !argogit.IsCommitSHA(revision) {
+		return c.Apps.GetFileContent(ctx, repoURL, revision, path)
+	}
+
+	value, err := c.getOrLoad(ctx, "GetFileContent", repoURL, revision+"|"+path, func(ctx context.Context) (interface{}, error) {
+		return c.Apps.GetFileContent(ctx, repoURL, revision, path)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{}, value.([]byte)...), nil
+}
+
+// getOrLoad returns the cached result of method for the repository and sha, calling load on a cache miss.
+// Errors are not cached. The concurrent callers share the same load, which runs with its own context, bounded by
+// loadTimeout, so that the timeout or cancellation of the context of a caller is not returned to the others.
+func (c *cachedApps) getOrLoad(ctx context.Context, method string, repoURL string, sha string, load func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	key := method + "|" + argogit.NormalizeGitURL(repoURL) + "|" + sha
+
+	if value, ok := c.get(key); ok {
+		cacheRequests.WithLabelValues(method, "hit").Inc()
+		return value, nil
+	}
+	cacheRequests.WithLabelValues(method, "miss").Inc()
+
+	res := c.group.DoChan(key, func() (interface{}, error) {
+		loadCtx, cancel := context.WithTimeout(context.Background(), c.loadTimeout)
+		defer cancel()
+
+		value, err := load(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+		c.set(key, value)
+		return value, nil
+	})
+
+	select {
+	case r := <-res:
+		return r.Val, r.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *cachedApps) get(key string) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cachedAppsEntry)
+	if c.now().After(entry.expiresAt) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	return entry.value, true
+}
+
+func (c *cachedApps) set(key string, value interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry := &cachedAppsEntry{key: key, value: value, expiresAt: c.now().Add(c.ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+
+	for c.lru.Len() > c.size {
+		evicted := c.lru.Remove(c.lru.Back()).(*cachedAppsEntry)
+		delete(c.entries, evicted.key)
+	}
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	sha1 = "a67038ae2e9cb9b9b16423702f98b41e36601001"
+	sha2 = "b67038ae2e9cb9b9b16423702f98b41e36601002"
+)
+
+// countingApps is a fake Apps which counts the calls it receives
+type countingApps struct {
+	calls int32
+	// resolves counts the calls to ResolveRevision, which resolves any revision to sha1
+	resolves int32
+	err   error
+	// release, if set, blocks calls until it's closed, or their context is done
+	release chan struct{}
+}
+
+func (a *countingApps) GetApps(ctx context.Context, repoURL string, revision string) ([]string, error) {
+	atomic.AddInt32(&a.calls, 1)
+	if a.release != nil {
+		select {
+		case <-a.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if a.err != nil {
+		return nil, a.err
+	}
+	return []string{repoURL + "/" + revision}, nil
+}
+
+func (a *countingApps) GetBranches(ctx context.Context, repoURL string) ([]Branch, error) {
+	atomic.AddInt32(&a.calls, 1)
+	return []Branch{}, nil
+}
+
+func (a *countingApps) GetRevision(ctx context.Context, repoURL string, revision string) (*Revision, error) {
+	atomic.AddInt32(&a.calls, 1)
+	return &Revision{SHA: revision}, nil
+}
+
+func (a *countingApps) ResolveRevision(ctx context.Context, repoURL string, revision string) (string, error) {
+	atomic.AddInt32(&a.resolves, 1)
+	return sha1, nil
+}
+
+func (a *countingApps) GetFileContent(ctx context.Context, repoURL string, revision string, path string) ([]byte, error) {
+	atomic.AddInt32(&a.calls, 1)
+	return []byte(path), nil
+}
+
+func TestCachedAppsGetApps(t *testing.T) {
+	apps := &countingApps{}
+	cache := NewCachedApps(apps, time.Minute, 10)
+
+	hits := testutil.ToFloat64(cacheRequests.WithLabelValues("GetApps", "hit"))
+	misses := testutil.ToFloat64(cacheRequests.WithLabelValues("GetApps", "miss"))
+
+	got, err := cache.GetApps(context.TODO(), "https://github.com/argoproj/repo.git", sha1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://github.com/argoproj/repo.git/" + sha1}, got)
+
+	// Equivalent URLs share the same cache entries
+	got, err = cache.GetApps(context.TODO(), "https://github.com/argoproj/REPO.git", sha1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://github.com/argoproj/repo.git/" + sha1}, got)
+	assert.Equal(t, int32(1), apps.calls)
+
+	// Modifying the result does not modify the cached value
+	got[0] = "modified"
+	got, _ = cache.GetApps(context.TODO(), "https://github.com/argoproj/repo.git", sha1)
+	assert.Equal(t, []string{"https://github.com/argoproj/repo.git/" + sha1}, got)
+
+	_, _ = cache.GetApps(context.TODO(), "https://github.com/argoproj/repo.git", sha2)
+	assert.Equal(t, int32(2), apps.calls)
+
+	assert.Equal(t, hits+2, testutil.ToFloat64(cacheRequests.WithLabelValues("GetApps", "hit")))
+	assert.Equal(t, misses+2, testutil.ToFloat64(cacheRequests.WithLabelValues("GetApps", "miss")))
+}
+
+func TestCachedAppsSkipsMovingRevisions(t *testing.T) {
+	apps := &countingApps{}
+	cache := NewCachedApps(apps, time.Minute, 10)
+
+	for _, revision := range []string{"HEAD", "HEAD"} {
+		_, _ = cache.GetApps(context.TODO(), "repo", revision)
+		_, _ = cache.GetFileContent(context.TODO(), "repo", revision, "a.yaml")
+	}
+	_, _ = cache.GetBranches(context.TODO(), "repo")
+	_, _ = cache.GetBranches(context.TODO(), "repo")
+
+	assert.Equal(t, int32(6), apps.calls)
+}
+
+func TestCachedAppsGetRevisionResolvesMovingRevisions(t *testing.T) {
+	apps := &countingApps{}
+	cache := NewCachedApps(apps, time.Minute, 10)
+
+	for i := 0; i < 2; i++ {
+		got, err := cache.GetRevision(context.TODO(), "repo", "HEAD")
+		assert.NoError(t, err)
+		assert.Equal(t, &Revision{SHA: sha1}, got)
+	}
+	// The revision is resolved every time, but the metadata of the commit is only read once, and is shared with
+	// the requests for the commit SHA itself
+	_, _ = cache.GetRevision(context.TODO(), "repo", sha1)
+
+	assert.Equal(t, int32(2), apps.resolves)
+	assert.Equal(t, int32(1), apps.calls)
+}
+
+func TestCachedAppsGetRevision(t *testing.T) {
+	apps := &countingApps{}
+	cache := NewCachedApps(apps, time.Minute, 10)
+
+	got, err := cache.GetRevision(context.TODO(), "repo", sha1)
+	assert.NoError(t, err)
+	assert.Equal(t, &Revision{SHA: sha1}, got)
+
+	got.SHA = "modified"
+	got, err = cache.GetRevision(context.TODO(), "repo", sha1)
+	assert.NoError(t, err)
+	assert.Equal(t, &Revision{SHA: sha1}, got)
+	assert.Equal(t, int32(1), apps.calls)
+}
+
+func TestCachedAppsGetFileContent(t *testing.T) {
+	apps := &countingApps{}
+	cache := NewCachedApps(apps, time.Minute, 10)
+
+	got, err := cache.GetFileContent(context.TODO(), "repo", sha1, "a.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a.yaml"), got)
+
+	got[0] = 'b'
+	got, _ = cache.GetFileContent(context.TODO(), "repo", sha1, "a.yaml")
+	assert.Equal(t, []byte("a.yaml"), got)
+	assert.Equal(t, int32(1), apps.calls)
+
+	// Files of the same commit are cached separately
+	got, _ = cache.GetFileContent(context.TODO(), "repo", sha1, "b.yaml")
+	assert.Equal(t, []byte("b.yaml"), got)
+	assert.Equal(t, int32(2), apps.calls)
+}
+
+func TestCachedAppsErrorsAreNotCached(t *testing.T) {
+	apps := &countingApps{err: errors.New("error")}
+	cache := NewCachedApps(apps, time.Minute, 10)
+
+	_, err := cache.GetApps(context.TODO(), "repo", sha1)
+	assert.EqualError(t, err, "error")
+	_, err = cache.GetApps(context.TODO(), "repo", sha1)
+	assert.EqualError(t, err, "error")
+
+	assert.Equal(t, int32(2), apps.calls)
+}
+
+func TestCachedAppsTTL(t *testing.T) {
+	apps := &countingApps{}
+	cache := NewCachedApps(apps, time.Minute, 10).(*cachedApps)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	_, _ = cache.GetApps(context.TODO(), "repo", sha1)
+	now = now.Add(59 * time.Second)
+	_, _ = cache.GetApps(context.TODO(), "repo", sha1)
+	assert.Equal(t, int32(1), apps.calls)
+
+	now = now.Add(2 * time.Second)
+	_, _ = cache.GetApps(context.TODO(), "repo", sha1)
+	assert.Equal(t, int32(2), apps.calls)
+}
+
+func TestCachedAppsSize(t *testing.T) {
+	apps := &countingApps{}
+	cache := NewCachedApps(apps, time.Minute, 2).(*cachedApps)
+
+	_, _ = cache.GetApps(context.TODO(), "repo1", sha1)
+	_, _ = cache.GetApps(context.TODO(), "repo2", sha1)
+	// repo2 becomes the least recently used
+	_, _ = cache.GetApps(context.TODO(), "repo1", sha1)
+	_, _ = cache.GetApps(context.TODO(), "repo3", sha1)
+	assert.Equal(t, 2, cache.lru.Len())
+	assert.Equal(t, int32(3), apps.calls)
+
+	_, _ = cache.GetApps(context.TODO(), "repo1", sha1)
+	assert.Equal(t, int32(3), apps.calls)
+	_, _ = cache.GetApps(context.TODO(), "repo2", sha1)
+	assert.Equal(t, int32(4), apps.calls)
+}
+
+func TestCachedAppsDeduplicatesConcurrentRequests(t *testing.T) {
+	apps := &countingApps{release: make(chan struct{})}
+	cache := NewCachedApps(apps, time.Minute, 10)
+
+	misses := testutil.ToFloat64(cacheRequests.WithLabelValues("GetApps", "miss"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := cache.GetApps(context.TODO(), "repo", sha1)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"repo/" + sha1}, got)
+		}()
+	}
+
+	// Wait for all the requests to miss the cache before letting the first one complete
+	for testutil.ToFloat64(cacheRequests.WithLabelValues("GetApps", "miss")) < misses+5 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(apps.release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), apps.calls)
+}
+
+func TestCachedAppsLoadIsNotCancelledByCaller(t *testing.T) {
+	apps := &countingApps{release: make(chan struct{})}
+	cache := NewCachedApps(apps, time.Minute, 10)
+
+	misses := testutil.ToFloat64(cacheRequests.WithLabelValues("GetApps", "miss"))
+
+	// The first caller gives up, e.g. after the timeout of its generator
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancelled := make(chan error)
+	go func() {
+		_, err := cache.GetApps(ctx, "repo", sha1)
+		cancelled <- err
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		got, err := cache.GetApps(context.TODO(), "repo", sha1)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"repo/" + sha1}, got)
+	}()
+
+	for testutil.ToFloat64(cacheRequests.WithLabelValues("GetApps", "miss")) < misses+2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	assert.Equal(t, context.Canceled, <-cancelled)
+
+	// The other caller still gets the result of the shared request
+	close(apps.release)
+	wg.Wait()
+	assert.Equal(t, int32(1), apps.calls)
+}
@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	certutil "github.com/argoproj/argo-cd/util/cert"
+	argogit "github.com/argoproj/argo-cd/util/git"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/protocol/packp"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// Branch is a head of a remote git repository
+type Branch struct {
+	// Name is the short name of the branch, e.g. 'feature/foo'
+	Name string
+	// SHA is the commit the branch currently points to
+	SHA string
+}
+
+// Revision is a git revision resolved to a commit
+type Revision struct {
+	// SHA is the full commit SHA the revision resolved to
+	SHA string
+	// Date is the time the commit was authored
+	Date time.Time
+}
+
+// lsRemote lists the refs of a remote repository, along with the peeled refs of its annotated tags, named like
+// 'refs/tags/v1^{}' as by git ls-remote. It doesn't use any storage, so the repository is never cloned.
+// It returns once ctx is done, even if the remote doesn't answer.
+func lsRemote(ctx context.Context, repo *v1alpha1.Repository) ([]*plumbing.Reference, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrap(err, "Error in listing remote refs")
+	}
+
+	auth, err := newAuth(repo)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in creating git credentials")
+	}
+
+	// The refs are read from an upload-pack session, as git.Remote.List drops the peeled refs
+	ep, err := transport.NewEndpoint(repo.Repo)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in listing remote refs")
+	}
+	c, err := client.NewClient(ep)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in listing remote refs")
+	}
+	session, err := c.NewUploadPackSession(ep, auth)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in listing remote refs")
+	}
+	defer session.Close()
+
+	// AdvertisedReferences doesn't take a context, so it isn't waited for once ctx is done. The deferred Close
+	// then ends the session, which interrupts the git command of the ssh and file transports.
+	done := make(chan advertisedRefsResult, 1)
+	go func() {
+		advRefs, err := session.AdvertisedReferences()
+		done <- advertisedRefsResult{advRefs: advRefs, err: err}
+	}()
+
+	var advRefs *packp.AdvRefs
+	select {
+	case res := <-done:
+		advRefs, err = res.advRefs, res.err
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in listing remote refs")
+	}
+	allRefs, err := advRefs.AllReferences()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in listing remote refs")
+	}
+
+	var refs []*plumbing.Reference
+	for _, ref := range allRefs {
+		refs = append(refs, ref)
+	}
+	for name, hash := range advRefs.Peeled {
+		refs = append(refs, plumbing.NewHashReference(plumbing.ReferenceName(name+peeledSuffix), hash))
+	}
+
+	return refs, nil
+}
+
+type advertisedRefsResult struct {
+	advRefs *packp.AdvRefs
+	err     error
+}
+
+// peeledSuffix is the suffix of the name of the peeled refs, pointing to the commit of an annotated tag
+const peeledSuffix = "^{}"
+
+// resolveRevision resolves a branch, tag or HEAD of a remote repository to a full commit SHA.
+// A revision which already is a full commit SHA is returned unchanged. A branch is preferred to a tag of the same
+// name, and annotated tags are resolved to the commit they point to rather than to the tag object.
+func resolveRevision(ctx context.Context, repo *v1alpha1.Repository, revision string) (string, error) {
+	if argogit.IsCommitSHA(revision) {
+		return revision, nil
+	}
+	if revision == "" {
+		revision = "HEAD"
+	}
+
+	refs, err := lsRemote(ctx, repo)
+	if err != nil {
+		return "", err
+	}
+
+	// refToHash keeps a map of remote refs to their hash, and refToTarget of symbolic refs (e.g. HEAD) to the
+	// ref they point to
+	refToHash := make(map[plumbing.ReferenceName]string)
+	refToTarget := make(map[plumbing.ReferenceName]plumbing.ReferenceName)
+	for _, ref := range refs {
+		if ref.Type() == plumbing.HashReference {
+			refToHash[ref.Name()] = ref.Hash().String()
+		} else {
+			refToTarget[ref.Name()] = ref.Target()
+		}
+	}
+
+	for _, name := range []plumbing.ReferenceName{
+		plumbing.ReferenceName(revision),
+		plumbing.NewBranchReferenceName(revision),
+		plumbing.NewTagReferenceName(revision),
+	} {
+		if target, ok := refToTarget[name]; ok {
+			name = target
+		}
+		if hash, ok := refToHash[name+peeledSuffix]; ok {
+			return hash, nil
+		}
+		if hash, ok := refToHash[name]; ok {
+			return hash, nil
+		}
+	}
+
+	return "", fmt.Errorf("Unable to resolve '%s' to a commit SHA", revision)
+}
+
+// lsRemoteHeads lists the branches of a remote repository, sorted by name.
+func lsRemoteHeads(ctx context.Context, repo *v1alpha1.Repository) ([]Branch, error) {
+	refs, err := lsRemote(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []Branch{}
+	for _, ref := range refs {
+		if !ref.Name().IsBranch() || ref.Type() != plumbing.HashReference {
+			continue
+		}
+		res = append(res, Branch{
+			Name: ref.Name().Short(),
+			SHA:  ref.Hash().String(),
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+
+	return res, nil
+}
+
+// newAuth returns the go-git authentication method matching the credentials of an Argo CD repository,
+// or nil when the repository is accessed anonymously.
+func newAuth(repo *v1alpha1.Repository) (transport.AuthMethod, error) {
+	if repo.SSHPrivateKey != "" {
+		var sshUser string
+		if isSSH, user := argogit.IsSSHURL(repo.Repo); isSSH {
+			sshUser = user
+		}
+		signer, err := ssh.ParsePrivateKey([]byte(repo.SSHPrivateKey))
+		if err != nil {
+			return nil, err
+		}
+		auth := &gitssh.PublicKeys{User: sshUser, Signer: signer}
+		if repo.IsInsecure() {
+			auth.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+		} else {
+			auth.HostKeyCallback, err = knownhosts.New(certutil.GetSSHKnownHostsDataPath())
+			if err != nil {
+				log.WithError(err).Error("could not set-up SSH known hosts callback")
+			}
+		}
+		return auth, nil
+	}
+
+	if repo.Username != "" || repo.Password != "" {
+		return &githttp.BasicAuth{Username: repo.Username, Password: repo.Password}, nil
+	}
+
+	return nil, nil
+}
+
+// fetchFile returns the content of a file of a remote repository at the commit sha.
+func fetchFile(ctx context.Context, repo *v1alpha1.Repository, sha string, filePath string) ([]byte, error) {
+	gitRepo, err := fetchCommit(ctx, repo, sha)
+	if err != nil {
+		return nil, err
+	}
+
+	return readFile(gitRepo, sha, filePath)
+}
+
+// fetchCommit fetches the commit sha of a remote repository with in-memory storage, so nothing is written to disk.
+// Only the commit is fetched, without its history, from a branch or tag pointing to it. go-git can't fetch a commit
+// by its SHA, so a commit which isn't the tip of any branch or tag, e.g. an older pinned commit, is fetched along
+// with the history of all of them instead.
+func fetchCommit(ctx context.Context, repo *v1alpha1.Repository, sha string) (*git.Repository, error) {
+	refs, err := lsRemote(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	gitRepo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return nil, err
+	}
+	_, err = gitRepo.CreateRemote(&config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{repo.Repo},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := newAuth(repo)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in creating git credentials")
+	}
+
+	options := &git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		Auth:       auth,
+		RefSpecs: []config.RefSpec{
+			"+refs/heads/*:refs/remotes/origin/*",
+			"+refs/tags/*:refs/tags/*",
+		},
+	}
+	if ref := refPointingTo(refs, sha); ref != "" {
+		options.RefSpecs = []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", ref, ref))}
+		options.Depth = 1
+		options.Tags = git.NoTags
+	}
+
+	err = gitRepo.FetchContext(ctx, options)
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, errors.Wrapf(err, "Error in fetching %s", repo.Repo)
+	}
+
+	return gitRepo, nil
+}
+
+// refPointingTo returns the name of the first branch, or else tag, pointing to the commit sha, or an empty name if
+// there is none
+func refPointingTo(refs []*plumbing.Reference, sha string) plumbing.ReferenceName {
+	var branch, tag plumbing.ReferenceName
+	for _, ref := range refs {
+		if ref.Type() != plumbing.HashReference || ref.Hash().String() != sha {
+			continue
+		}
+		// An annotated tag is fetched by its name, along with the commit it points to
+		name := plumbing.ReferenceName(strings.TrimSuffix(ref.Name().String(), peeledSuffix))
+		switch {
+		case name.IsBranch() && (branch == "" || name < branch):
+			branch = name
+		case name.IsTag() && (tag == "" || name < tag):
+			tag = name
+		}
+	}
+	if branch != "" {
+		return branch
+	}
+	return tag
+}
+
+// IsFileNotFound returns whether the error was returned for a file which doesn't exist at the revision
+func IsFileNotFound(err error) bool {
+	return errors.Cause(err) == object.ErrFileNotFound
+}
+
+// readFile returns the content of a file of a repository at the commit sha
+func readFile(gitRepo *git.Repository, sha string, filePath string) ([]byte, error) {
+	commit, err := gitRepo.CommitObject(plumbing.NewHash(sha))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error in reading commit %s", sha)
+	}
+
+	file, err := commit.File(strings.TrimPrefix(path.Clean("/"+filePath), "/"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error in reading file %s", filePath)
+	}
+
+	content, err := file.Contents()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error in reading file %s", filePath)
+	}
+
+	return []byte(content), nil
+}
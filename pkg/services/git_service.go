@@ -0,0 +1,351 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/argo-cd/util/app/discovery"
+	"github.com/argoproj/argo-cd/util/db"
+	argogit "github.com/argoproj/argo-cd/util/git"
+	"github.com/argoproj/argo-cd/util/settings"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"k8s.io/client-go/kubernetes"
+)
+
+// gitService implements Apps by cloning the repositories itself with go-git, so that it does not
+// depend on a running argocd-repo-server. Credentials are still read from the Argo CD repository Secrets.
+type gitService struct {
+	repositoriesDB RepositoryDB
+	cache          *repoCache
+}
+
+// NewGitService returns an Apps backed by local clones of the repositories, kept in cacheDir.
+// At most cacheSize repositories are kept on disk, the least recently used ones being removed first.
+func NewGitService(ctx context.Context, clientset kubernetes.Interface, namespace string, cacheDir string, cacheSize int) (Apps, error) {
+	settingsMgr := settings.NewSettingsManager(ctx, clientset, namespace)
+
+	cache, err := newRepoCache(cacheDir, cacheSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gitService{
+		repositoriesDB: db.NewDB(namespace, settingsMgr, clientset).(RepositoryDB),
+		cache:          cache,
+	}, nil
+}
+
+func (g *gitService) GetApps(ctx context.Context, repoURL string, revision string) ([]string, error) {
+	repo, err := g.repositoriesDB.GetRepository(ctx, repoURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in GetRepository")
+	}
+
+	sha, err := resolveRevision(ctx, repo, revision)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in resolving revision")
+	}
+
+	entry := g.cache.acquire(repo.Repo)
+	defer entry.Unlock()
+
+	gitRepo, err := fetch(ctx, entry.path, repo, sha)
+	if err != nil {
+		return nil, err
+	}
+
+	worktree, err := gitRepo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	err = worktree.Checkout(&git.CheckoutOptions{Hash: plumbing.NewHash(sha), Force: true})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error in checking out %s", sha)
+	}
+
+	apps, err := discovery.Discover(entry.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in discovering apps")
+	}
+
+	res := []string{}
+	for name := range apps {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+
+	return res, nil
+}
+
+func (g *gitService) GetBranches(ctx context.Context, repoURL string) ([]Branch, error) {
+	repo, err := g.repositoriesDB.GetRepository(ctx, repoURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in GetRepository")
+	}
+
+	return lsRemoteHeads(ctx, repo)
+}
+
+func (g *gitService) GetRevision(ctx context.Context, repoURL string, revision string) (*Revision, error) {
+	repo, err := g.repositoriesDB.GetRepository(ctx, repoURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in GetRepository")
+	}
+
+	sha, err := resolveRevision(ctx, repo, revision)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in resolving revision")
+	}
+
+	entry := g.cache.acquire(repo.Repo)
+	defer entry.Unlock()
+
+	gitRepo, err := fetch(ctx, entry.path, repo, sha)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := gitRepo.CommitObject(plumbing.NewHash(sha))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Revision{
+		SHA:  sha,
+		Date: commit.Author.When,
+	}, nil
+}
+
+func (g *gitService) ResolveRevision(ctx context.Context, repoURL string, revision string) (string, error) {
+	repo, err := g.repositoriesDB.GetRepository(ctx, repoURL)
+	if err != nil {
+		return "", errors.Wrap(err, "Error in GetRepository")
+	}
+
+	sha, err := resolveRevision(ctx, repo, revision)
+	if err != nil {
+		return "", errors.Wrap(err, "Error in resolving revision")
+	}
+
+	return sha, nil
+}
+
+func (g *gitService) GetFileContent(ctx context.Context, repoURL string, revision string, path string) ([]byte, error) {
+	repo, err := g.repositoriesDB.GetRepository(ctx, repoURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in GetRepository")
+	}
+
+	sha, err := resolveRevision(ctx, repo, revision)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in resolving revision")
+	}
+
+	entry := g.cache.acquire(repo.Repo)
+	defer entry.Unlock()
+
+	gitRepo, err := fetch(ctx, entry.path, repo, sha)
+	if err != nil {
+		return nil, err
+	}
+
+	return readFile(gitRepo, sha, path)
+}
+
+// fetch opens the local clone of repo at path, creating it if needed, and fetches from the remote
+// unless it already contains the commit sha.
+func fetch(ctx context.Context, path string, repo *v1alpha1.Repository, sha string) (*git.Repository, error) {
+	gitRepo, err := git.PlainOpen(path)
+	if err == git.ErrRepositoryNotExists {
+		gitRepo, err = git.PlainInit(path, false)
+		if err != nil {
+			return nil, err
+		}
+		_, err = gitRepo.CreateRemote(&config.RemoteConfig{
+			Name: git.DefaultRemoteName,
+			URLs: []string{repo.Repo},
+		})
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error in opening local clone of %s", repo.Repo)
+	}
+
+	if _, err := gitRepo.CommitObject(plumbing.NewHash(sha)); err == nil {
+		return gitRepo, nil
+	}
+
+	auth, err := newAuth(repo)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in creating git credentials")
+	}
+
+	log.WithFields(log.Fields{"repoURL": repo.Repo, "sha": sha}).Info("fetching repository")
+	err = gitRepo.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		Auth:       auth,
+		RefSpecs: []config.RefSpec{
+			"+refs/heads/*:refs/remotes/origin/*",
+			"+refs/tags/*:refs/tags/*",
+		},
+		Force: true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, errors.Wrapf(err, "Error in fetching %s", repo.Repo)
+	}
+
+	return gitRepo, nil
+}
+
+// repoCacheDirRegex matches the directories created by repoCache
+var repoCacheDirRegex = regexp.MustCompile("^[0-9a-f]{16}$")
+
+// repoCache keeps track of the local clones of repositories, and removes the least recently used ones
+// when there are more than size of them.
+type repoCache struct {
+	root string
+	size int
+
+	lock sync.Mutex
+	// lru holds the entries, the most recently used first
+	lru     *list.List
+	entries map[string]*list.Element
+	// removing holds the last evicted entry of each key whose clone is being removed
+	removing map[string]*repoCacheEntry
+}
+
+// repoCacheEntry is the local clone of a repository. It must be locked while the clone is used.
+type repoCacheEntry struct {
+	sync.Mutex
+	key  string
+	path string
+	// evicted is set once the clone has been removed from the cache, and must not be used anymore
+	evicted bool
+	// removed is closed once the clone of the previous entry with the same path is removed, nil if there is none
+	removed chan struct{}
+	// done is closed once the clone of the entry is removed, after it's evicted
+	done chan struct{}
+}
+
+func newRepoCache(root string, size int) (*repoCache, error) {
+	if size < 1 {
+		return nil, errors.Errorf("git cache size must be at least 1, got %d", size)
+	}
+
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, err
+	}
+
+	// Clones left over by a previous run can't be tracked, so they are removed to keep the cache bounded
+	files, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.IsDir() && repoCacheDirRegex.MatchString(f.Name()) {
+			if err := os.RemoveAll(filepath.Join(root, f.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &repoCache{
+		root:     root,
+		size:     size,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		removing: map[string]*repoCacheEntry{},
+	}, nil
+}
+
+// get returns the cache entry of the repository, evicting the least recently used entries if needed.
+// The returned entry is not locked.
+func (c *repoCache) get(repoURL string) *repoCacheEntry {
+	hash := sha256.Sum256([]byte(argogit.NormalizeGitURL(repoURL)))
+	key := hex.EncodeToString(hash[:])[:16]
+
+	entry, evicted := c.getEntry(key)
+	for _, e := range evicted {
+		c.remove(e)
+	}
+	return entry
+}
+
+// getEntry returns the cache entry of the key, along with the entries it evicted, which must be removed
+func (c *repoCache) getEntry(key string) (*repoCacheEntry, []*repoCacheEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(elem)
+		return elem.Value.(*repoCacheEntry), nil
+	}
+
+	entry := &repoCacheEntry{key: key, path: filepath.Join(c.root, key), done: make(chan struct{})}
+	// The clone of a previous entry with the same key may still be being removed
+	if previous, ok := c.removing[key]; ok {
+		entry.removed = previous.done
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+
+	var evicted []*repoCacheEntry
+	for c.lru.Len() > c.size {
+		e := c.lru.Remove(c.lru.Back()).(*repoCacheEntry)
+		delete(c.entries, e.key)
+		c.removing[e.key] = e
+		evicted = append(evicted, e)
+	}
+
+	return entry, evicted
+}
+
+// remove removes the clone of an evicted entry, once it's released. The cache lock isn't held meanwhile, so that
+// the other repositories can be used while the clone is being fetched or checked out.
+func (c *repoCache) remove(evicted *repoCacheEntry) {
+	// The clones of the entries with the same path are removed in order
+	if evicted.removed != nil {
+		<-evicted.removed
+	}
+	evicted.Lock()
+	evicted.evicted = true
+	if err := os.RemoveAll(evicted.path); err != nil {
+		log.WithError(err).WithField("path", evicted.path).Error("failed to remove cached repository")
+	}
+	evicted.Unlock()
+
+	c.lock.Lock()
+	if c.removing[evicted.key] == evicted {
+		delete(c.removing, evicted.key)
+	}
+	c.lock.Unlock()
+	close(evicted.done)
+}
+
+// acquire returns the locked cache entry of the repository.
+func (c *repoCache) acquire(repoURL string) *repoCacheEntry {
+	for {
+		entry := c.get(repoURL)
+		// The path of the entry is only used once the clone of the previous entry with the same path is removed
+		if entry.removed != nil {
+			<-entry.removed
+		}
+		entry.Lock()
+		// The entry may have been evicted between get and Lock
+		if !entry.evicted {
+			return entry
+		}
+		entry.Unlock()
+	}
+}
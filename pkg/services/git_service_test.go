@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func newTestGitService(t *testing.T, repoURL string, cacheSize int) (*gitService, string) {
+	cacheDir, err := ioutil.TempDir("", "applicationset-cache")
+	require.NoError(t, err)
+
+	cache, err := newRepoCache(cacheDir, cacheSize)
+	require.NoError(t, err)
+
+	argocdRepositoryMock := &ArgocdRepositoryMock{}
+	argocdRepositoryMock.On("GetRepository", mock.Anything, repoURL).Return(&v1alpha1.Repository{Repo: repoURL}, nil)
+
+	return &gitService{
+		repositoriesDB: argocdRepositoryMock,
+		cache:          cache,
+	}, cacheDir
+}
+
+func TestGitServiceGetApps(t *testing.T) {
+	dir, commits := initTestRepo(t, "app1/kustomization.yaml", "p1/app2/Chart.yaml", "app3/kustomization.yaml", "README.md")
+	defer os.RemoveAll(dir)
+	repoURL := "file://" + dir
+
+	g, cacheDir := newTestGitService(t, repoURL, 1)
+	defer os.RemoveAll(cacheDir)
+
+	got, err := g.GetApps(context.TODO(), repoURL, "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app1", "app3", "p1/app2"}, got)
+
+	// Older commits are checked out from the same clone
+	got, err = g.GetApps(context.TODO(), repoURL, commits[1].String())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app1", "p1/app2"}, got)
+
+	_, err = g.GetApps(context.TODO(), repoURL, "does-not-exist")
+	assert.Error(t, err)
+}
+
+func TestGitServiceGetRevision(t *testing.T) {
+	dir, commits := initTestRepo(t, "app1/kustomization.yaml", "app2/kustomization.yaml")
+	defer os.RemoveAll(dir)
+	repoURL := "file://" + dir
+
+	g, cacheDir := newTestGitService(t, repoURL, 1)
+	defer os.RemoveAll(cacheDir)
+
+	got, err := g.GetRevision(context.TODO(), repoURL, "master")
+
+	assert.NoError(t, err)
+	assert.Equal(t, commits[1].String(), got.SHA)
+	assert.True(t, time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC).Equal(got.Date))
+}
+
+func TestGitServiceGetBranches(t *testing.T) {
+	dir, commits := initTestRepo(t, "app1/kustomization.yaml")
+	defer os.RemoveAll(dir)
+	repoURL := "file://" + dir
+
+	g, cacheDir := newTestGitService(t, repoURL, 1)
+	defer os.RemoveAll(cacheDir)
+
+	got, err := g.GetBranches(context.TODO(), repoURL)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Branch{{Name: "master", SHA: commits[0].String()}}, got)
+}
+
+func TestGitServiceGetFileContent(t *testing.T) {
+	dir, commits := initTestRepo(t, "templates/app.yaml", "README.md")
+	defer os.RemoveAll(dir)
+	repoURL := "file://" + dir
+
+	g, cacheDir := newTestGitService(t, repoURL, 1)
+	defer os.RemoveAll(cacheDir)
+
+	got, err := g.GetFileContent(context.TODO(), repoURL, "HEAD", "/templates/app.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("templates/app.yaml"), got)
+
+	_, err = g.GetFileContent(context.TODO(), repoURL, commits[0].String(), "README.md")
+	assert.True(t, IsFileNotFound(err))
+
+	_, err = g.GetFileContent(context.TODO(), repoURL, "0000000000000000000000000000000000000000", "README.md")
+	assert.Error(t, err)
+	assert.False(t, IsFileNotFound(err))
+}
+
+func TestFetchFile(t *testing.T) {
+	dir, commits := initTestRepo(t, "templates/app.yaml", "README.md")
+	defer os.RemoveAll(dir)
+
+	got, err := fetchFile(context.TODO(), &v1alpha1.Repository{Repo: "file://" + dir}, commits[1].String(), "README.md")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("README.md"), got)
+
+	_, err = fetchFile(context.TODO(), &v1alpha1.Repository{Repo: "file://" + dir}, commits[1].String(), "does-not-exist")
+	assert.True(t, IsFileNotFound(err))
+}
+
+func TestFetchCommit(t *testing.T) {
+	dir, commits := initTestRepo(t, "app1/config.yaml", "app2/config.yaml", "app3/config.yaml")
+	defer os.RemoveAll(dir)
+
+	repo, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+	_, err = repo.CreateTag("v1", commits[1], &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)},
+		Message: "v1",
+	})
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		name string
+		sha  plumbing.Hash
+		// fetched are the commits expected to be fetched along with sha, the others must not be
+		fetched []plumbing.Hash
+	}{
+		{"only the commit of a branch is fetched", commits[2], nil},
+		{"only the commit of an annotated tag is fetched", commits[1], nil},
+		{"a commit which isn't the tip of any ref is fetched with the history", commits[0], commits[1:]},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			got, err := fetchCommit(context.TODO(), &v1alpha1.Repository{Repo: "file://" + dir}, cc.sha.String())
+			require.NoError(t, err)
+
+			_, err = got.CommitObject(cc.sha)
+			assert.NoError(t, err)
+			for _, commit := range commits {
+				if commit == cc.sha {
+					continue
+				}
+				_, err = got.CommitObject(commit)
+				assert.Equal(t, containsHash(cc.fetched, commit), err == nil, "commit %s", commit)
+			}
+		})
+	}
+}
+
+func containsHash(hashes []plumbing.Hash, hash plumbing.Hash) bool {
+	for _, h := range hashes {
+		if h == hash {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRepoCache(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "applicationset-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	// Clones left over by a previous run are removed, other files are kept
+	leftOver := filepath.Join(cacheDir, "0123456789abcdef")
+	require.NoError(t, os.MkdirAll(leftOver, 0700))
+	other := filepath.Join(cacheDir, "other")
+	require.NoError(t, os.MkdirAll(other, 0700))
+
+	cache, err := newRepoCache(cacheDir, 2)
+	require.NoError(t, err)
+	assert.NoDirExists(t, leftOver)
+	assert.DirExists(t, other)
+
+	repo1 := cache.get("https://github.com/argoproj/repo1.git")
+	require.NoError(t, os.MkdirAll(repo1.path, 0700))
+	repo2 := cache.get("https://github.com/argoproj/repo2.git")
+	require.NoError(t, os.MkdirAll(repo2.path, 0700))
+
+	// Equivalent URLs share the same entry, and using repo1 makes repo2 the least recently used
+	assert.Equal(t, repo1, cache.get("https://github.com/argoproj/REPO1.git"))
+
+	repo3 := cache.get("https://github.com/argoproj/repo3.git")
+	assert.NotEqual(t, repo1.path, repo3.path)
+	assert.DirExists(t, repo1.path)
+	assert.NoDirExists(t, repo2.path)
+	assert.Equal(t, 2, cache.lru.Len())
+
+	_, err = newRepoCache(cacheDir, 0)
+	assert.Error(t, err)
+}
+
+func TestRepoCacheAcquireEvicted(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "applicationset-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	cache, err := newRepoCache(cacheDir, 1)
+	require.NoError(t, err)
+
+	evicted := cache.get("https://github.com/argoproj/repo1.git")
+	cache.get("https://github.com/argoproj/repo2.git")
+	assert.True(t, evicted.evicted)
+
+	// Acquiring the repository again returns a new entry for the same path
+	got := cache.acquire("https://github.com/argoproj/repo1.git")
+	defer got.Unlock()
+	assert.False(t, got.evicted)
+	assert.Equal(t, evicted.path, got.path)
+}
+
+func TestRepoCacheEvictionDoesNotBlockLookups(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "applicationset-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	cache, err := newRepoCache(cacheDir, 1)
+	require.NoError(t, err)
+
+	// repo1 is in use, e.g. being fetched, while repo2 evicts it
+	held := cache.acquire("https://github.com/argoproj/repo1.git")
+	evicting := make(chan struct{})
+	go func() {
+		cache.get("https://github.com/argoproj/repo2.git")
+		close(evicting)
+	}()
+	assert.Eventually(t, func() bool {
+		cache.lock.Lock()
+		defer cache.lock.Unlock()
+		_, ok := cache.removing[held.key]
+		return ok
+	}, time.Second, time.Millisecond)
+
+	// The other repositories are still looked up while the eviction waits for repo1 to be released
+	got := make(chan *repoCacheEntry)
+	go func() {
+		got <- cache.get("https://github.com/argoproj/repo2.git")
+	}()
+	select {
+	case entry := <-got:
+		assert.NotEqual(t, held.path, entry.path)
+	case <-time.After(time.Second):
+		t.Fatal("lookup blocked by the eviction of a repository in use")
+	}
+
+	// Acquiring repo1 again waits for its previous clone to be removed
+	acquired := make(chan *repoCacheEntry)
+	go func() {
+		acquired <- cache.acquire("https://github.com/argoproj/repo1.git")
+	}()
+	held.Unlock()
+	<-evicting
+	entry := <-acquired
+	defer entry.Unlock()
+	assert.True(t, held.evicted)
+	assert.False(t, entry.evicted)
+	assert.Equal(t, held.path, entry.path)
+}
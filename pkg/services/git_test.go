@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// initTestRepo creates a git repository in a temporary directory containing one commit per file,
+// and returns its path along with the commit hashes.
+func initTestRepo(t *testing.T, files ...string) (string, []plumbing.Hash) {
+	dir, err := ioutil.TempDir("", "applicationset-git")
+	require.NoError(t, err)
+
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+
+	var commits []plumbing.Hash
+	for i, file := range files {
+		path := filepath.Join(dir, file)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(file), 0644))
+		_, err = worktree.Add(file)
+		require.NoError(t, err)
+		hash, err := worktree.Commit(file, &git.CommitOptions{
+			Author: &object.Signature{
+				Name:  "test",
+				Email: "test@example.com",
+				When:  time.Date(2020, 1, i+1, 0, 0, 0, 0, time.UTC),
+			},
+		})
+		require.NoError(t, err)
+		commits = append(commits, hash)
+	}
+
+	return dir, commits
+}
+
+func TestLsRemoteHeads(t *testing.T) {
+	dir, commits := initTestRepo(t, "app1/config.yaml", "app2/config.yaml")
+	defer os.RemoveAll(dir)
+
+	repo, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+	require.NoError(t, repo.Storer.SetReference(plumbing.NewHashReference("refs/heads/feature/foo", commits[0])))
+	require.NoError(t, repo.Storer.SetReference(plumbing.NewHashReference("refs/tags/v1", commits[0])))
+
+	got, err := lsRemoteHeads(context.TODO(), &v1alpha1.Repository{Repo: "file://" + dir})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Branch{
+		{Name: "feature/foo", SHA: commits[0].String()},
+		{Name: "master", SHA: commits[1].String()},
+	}, got)
+}
+
+func TestLsRemoteHeadsError(t *testing.T) {
+	_, err := lsRemoteHeads(context.TODO(), &v1alpha1.Repository{Repo: "file:///does/not/exist"})
+
+	assert.Error(t, err)
+}
+
+func TestLsRemoteContextDone(t *testing.T) {
+	dir, _ := initTestRepo(t, "app1/config.yaml")
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := lsRemote(ctx, &v1alpha1.Repository{Repo: "file://" + dir})
+
+	assert.Error(t, err)
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+}
+
+func TestResolveRevision(t *testing.T) {
+	dir, commits := initTestRepo(t, "app1/config.yaml", "app2/config.yaml")
+	defer os.RemoveAll(dir)
+
+	repo, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+	require.NoError(t, repo.Storer.SetReference(plumbing.NewHashReference("refs/tags/v1", commits[0])))
+	annotated, err := repo.CreateTag("v2", commits[0], &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "test", Email: "test@example.com", When: time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)},
+		Message: "v2",
+	})
+	require.NoError(t, err)
+	require.NotEqual(t, commits[0], annotated.Hash())
+	// A branch and a tag with the same name
+	require.NoError(t, repo.Storer.SetReference(plumbing.NewHashReference("refs/heads/release", commits[1])))
+	require.NoError(t, repo.Storer.SetReference(plumbing.NewHashReference("refs/tags/release", commits[0])))
+
+	for _, c := range []struct {
+		name          string
+		revision      string
+		expected      string
+		expectedError bool
+	}{
+		{"HEAD", "HEAD", commits[1].String(), false},
+		{"empty revision defaults to HEAD", "", commits[1].String(), false},
+		{"branch", "master", commits[1].String(), false},
+		{"tag", "v1", commits[0].String(), false},
+		{"annotated tag resolves to its commit", "v2", commits[0].String(), false},
+		{"full tag ref", "refs/tags/v2", commits[0].String(), false},
+		{"branch is preferred to a tag of the same name", "release", commits[1].String(), false},
+		{"tag of the same name as a branch", "refs/tags/release", commits[0].String(), false},
+		{"commit SHA", commits[0].String(), commits[0].String(), false},
+		{"unknown revision", "does-not-exist", "", true},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			got, err := resolveRevision(context.TODO(), &v1alpha1.Repository{Repo: "file://" + dir}, cc.revision)
+
+			if cc.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, cc.expected, got)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"sort"
 	"github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
 	"github.com/argoproj/argo-cd/reposerver/apiclient"
 	"github.com/argoproj/argo-cd/util/db"
@@ -25,6 +26,12 @@ type argoCDService struct {
 
 type Apps interface {
 	GetApps(ctx context.Context, repoURL string, revision string) ([]string, error)
+	GetBranches(ctx context.Context, repoURL string) ([]Branch, error)
+	GetRevision(ctx context.Context, repoURL string, revision string) (*Revision, error)
+	// ResolveRevision resolves a branch, tag or HEAD of the repository to a commit SHA, without reading the commit
+	ResolveRevision(ctx context.Context, repoURL string, revision string) (string, error)
+	// GetFileContent returns the content of a file of the repository at the revision
+	GetFileContent(ctx context.Context, repoURL string, revision string, path string) ([]byte, error)
 }
 
 func NewArgoCDService(ctx context.Context, clientset kubernetes.Interface, namespace string, repoServerAddress string) Apps {
@@ -63,6 +70,81 @@ func (a *argoCDService) GetApps(ctx context.Context, repoURL string, revision st
 	for name, _ := range apps.Apps {
 		res = append(res, name)
 	}
+	sort.Strings(res)
 
 	return res, nil
 }
+
+func (a *argoCDService) GetBranches(ctx context.Context, repoURL string) ([]Branch, error) {
+	repo, err := a.repositoriesDB.GetRepository(ctx, repoURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in GetRepository")
+	}
+
+	branches, err := lsRemoteHeads(ctx, repo)
+	log.Debugf("branches - %#v", branches)
+	if err != nil {
+		return nil, err
+	}
+
+	return branches, nil
+}
+
+func (a *argoCDService) GetRevision(ctx context.Context, repoURL string, revision string) (*Revision, error) {
+	repo, err := a.repositoriesDB.GetRepository(ctx, repoURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in GetRepository")
+	}
+
+	sha, err := resolveRevision(ctx, repo, revision)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in resolving revision")
+	}
+
+	conn, repoClient, err := a.repoClientset.NewRepoServerClient()
+	defer io.Close(conn)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in creating repo service client")
+	}
+
+	metadata, err := repoClient.GetRevisionMetadata(ctx, &apiclient.RepoServerRevisionMetadataRequest{
+		Repo:     repo,
+		Revision: sha,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in GetRevisionMetadata")
+	}
+
+	return &Revision{
+		SHA:  sha,
+		Date: metadata.Date.Time,
+	}, nil
+}
+
+func (a *argoCDService) ResolveRevision(ctx context.Context, repoURL string, revision string) (string, error) {
+	repo, err := a.repositoriesDB.GetRepository(ctx, repoURL)
+	if err != nil {
+		return "", errors.Wrap(err, "Error in GetRepository")
+	}
+
+	sha, err := resolveRevision(ctx, repo, revision)
+	if err != nil {
+		return "", errors.Wrap(err, "Error in resolving revision")
+	}
+
+	return sha, nil
+}
+
+func (a *argoCDService) GetFileContent(ctx context.Context, repoURL string, revision string, path string) ([]byte, error) {
+	repo, err := a.repositoriesDB.GetRepository(ctx, repoURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in GetRepository")
+	}
+
+	sha, err := resolveRevision(ctx, repo, revision)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in resolving revision")
+	}
+
+	return fetchFile(ctx, repo, sha, path)
+}
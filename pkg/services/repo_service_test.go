@@ -3,20 +3,23 @@ package services
 import (
 	"context"
 	"errors"
+	"os"
 	"github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
 	"github.com/argoproj/argo-cd/reposerver/apiclient"
 	"github.com/argoproj/gitops-engine/pkg/utils/io"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"google.golang.org/grpc"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"testing"
+	"time"
 )
 
 type ArgocdRepositoryMock struct {
 	mock.Mock
 }
 
-func (a ArgocdRepositoryMock) GetRepository(ctx context.Context, url string) (*v1alpha1.Repository, error) {
+func (a *ArgocdRepositoryMock) GetRepository(ctx context.Context, url string) (*v1alpha1.Repository, error) {
 	args := a.Called(ctx, url)
 
 	return args.Get(0).(*v1alpha1.Repository), args.Error(1)
@@ -27,21 +30,27 @@ type repoServerClientMock struct {
 	mock.Mock
 }
 
-func (r repoServerClientMock) GenerateManifest(ctx context.Context, in *apiclient.ManifestRequest, opts ...grpc.CallOption) (*apiclient.ManifestResponse, error) {
+func (r *repoServerClientMock) GenerateManifest(ctx context.Context, in *apiclient.ManifestRequest, opts ...grpc.CallOption) (*apiclient.ManifestResponse, error) {
 	return nil, nil
 }
-func (r repoServerClientMock) ListApps(ctx context.Context, in *apiclient.ListAppsRequest, opts ...grpc.CallOption) (*apiclient.AppList, error) {
+func (r *repoServerClientMock) ListApps(ctx context.Context, in *apiclient.ListAppsRequest, opts ...grpc.CallOption) (*apiclient.AppList, error) {
 	args := r.Called(ctx, in)
 
 	return args.Get(0).(*apiclient.AppList), args.Error(1)
 }
-func (r repoServerClientMock) GetAppDetails(ctx context.Context, in *apiclient.RepoServerAppDetailsQuery, opts ...grpc.CallOption) (*apiclient.RepoAppDetailsResponse, error) {
+func (r *repoServerClientMock) GetAppDetails(ctx context.Context, in *apiclient.RepoServerAppDetailsQuery, opts ...grpc.CallOption) (*apiclient.RepoAppDetailsResponse, error) {
 	return nil, nil
 }
-func (r repoServerClientMock) GetRevisionMetadata(ctx context.Context, in *apiclient.RepoServerRevisionMetadataRequest, opts ...grpc.CallOption) (*v1alpha1.RevisionMetadata, error) {
-	return nil, nil
+func (r *repoServerClientMock) GetRevisionMetadata(ctx context.Context, in *apiclient.RepoServerRevisionMetadataRequest, opts ...grpc.CallOption) (*v1alpha1.RevisionMetadata, error) {
+	args := r.Called(ctx, in)
+
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+
+	return args.Get(0).(*v1alpha1.RevisionMetadata), args.Error(1)
 }
-func (r repoServerClientMock) GetHelmCharts(ctx context.Context, in *apiclient.HelmChartsRequest, opts ...grpc.CallOption) (*apiclient.HelmChartsResponse, error) {
+func (r *repoServerClientMock) GetHelmCharts(ctx context.Context, in *apiclient.HelmChartsRequest, opts ...grpc.CallOption) (*apiclient.HelmChartsResponse, error) {
 	return nil, nil
 }
 
@@ -49,7 +58,7 @@ type closer struct {
 	mock.Mock
 }
 
-func (c closer) Close() error{
+func (c *closer) Close() error{
 	return nil
 }
 
@@ -57,10 +66,10 @@ type repoClientsetMock struct {
 	mock.Mock
 }
 
-func (r repoClientsetMock) NewRepoServerClient() (io.Closer, apiclient.RepoServerServiceClient, error) {
+func (r *repoClientsetMock) NewRepoServerClient() (io.Closer, apiclient.RepoServerServiceClient, error) {
 	args := r.Called()
 
-	return closer{}, args.Get(0).(apiclient.RepoServerServiceClient), args.Error(1)
+	return &closer{}, args.Get(0).(apiclient.RepoServerServiceClient), args.Error(1)
 }
 
 
@@ -131,9 +140,9 @@ func TestGetApps(t *testing.T) {
 	}{
 		cc := c
 		t.Run(cc.name, func(t *testing.T) {
-			argocdRepositoryMock := ArgocdRepositoryMock{}
-			repoServerClientMock := repoServerClientMock{}
-			repoClientsetMock := repoClientsetMock{}
+			argocdRepositoryMock := &ArgocdRepositoryMock{}
+			repoServerClientMock := &repoServerClientMock{}
+			repoClientsetMock := &repoClientsetMock{}
 
 			argocdRepositoryMock.On("GetRepository", mock.Anything, cc.repoURL).Return(cc.repoRes, cc.repoErr)
 
@@ -159,3 +168,82 @@ func TestGetApps(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRevision(t *testing.T) {
+	sha := "a67038ae2e9cb9b9b16423702f98b41e36601001"
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, c := range []struct {
+		name          string
+		repoErr       error
+		metadataRes   *v1alpha1.RevisionMetadata
+		metadataErr   error
+		expected      *Revision
+		expectedError error
+	}{
+		{
+			name:        "Happy Flow",
+			metadataRes: &v1alpha1.RevisionMetadata{Date: metav1.NewTime(date)},
+			expected:    &Revision{SHA: sha, Date: date},
+		},
+		{
+			name:          "handles GetRepository error",
+			repoErr:       errors.New("error"),
+			expectedError: errors.New("Error in GetRepository: error"),
+		},
+		{
+			name:          "handles GetRevisionMetadata error",
+			metadataErr:   errors.New("error"),
+			expectedError: errors.New("Error in GetRevisionMetadata: error"),
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			argocdRepositoryMock := &ArgocdRepositoryMock{}
+			repoServerClientMock := &repoServerClientMock{}
+			repoClientsetMock := &repoClientsetMock{}
+
+			repo := &v1alpha1.Repository{Repo: "repoURL"}
+			argocdRepositoryMock.On("GetRepository", mock.Anything, "repoURL").Return(repo, cc.repoErr)
+
+			repoServerClientMock.On("GetRevisionMetadata", mock.Anything, &apiclient.RepoServerRevisionMetadataRequest{
+				Repo:     repo,
+				Revision: sha,
+			}).Return(cc.metadataRes, cc.metadataErr)
+
+			repoClientsetMock.On("NewRepoServerClient").Return(repoServerClientMock, nil)
+
+			argocd := argoCDService{
+				repositoriesDB: argocdRepositoryMock,
+				repoClientset:  repoClientsetMock,
+			}
+			got, err := argocd.GetRevision(context.TODO(), "repoURL", sha)
+
+			if cc.expectedError != nil {
+				assert.EqualError(t, err, cc.expectedError.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, cc.expected, got)
+			}
+		})
+	}
+}
+
+func TestArgoCDServiceResolveRevision(t *testing.T) {
+	dir, commits := initTestRepo(t, "app1/config.yaml", "app2/config.yaml")
+	defer os.RemoveAll(dir)
+	repoURL := "file://" + dir
+
+	argocdRepositoryMock := &ArgocdRepositoryMock{}
+	argocdRepositoryMock.On("GetRepository", mock.Anything, repoURL).Return(&v1alpha1.Repository{Repo: repoURL}, nil)
+	argocd := argoCDService{
+		repositoriesDB: argocdRepositoryMock,
+	}
+
+	got, err := argocd.ResolveRevision(context.TODO(), repoURL, "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, commits[1].String(), got)
+
+	_, err = argocd.ResolveRevision(context.TODO(), repoURL, "does-not-exist")
+	assert.Error(t, err)
+}
@@ -3,4 +3,31 @@ package utils
 const (
 	ClusterListGeneratorKeyName = "cluster"
 	UrlGeneratorKeyName         = "url"
+	ValuesListGeneratorKeyName  = "values"
+	RevisionSHAKeyName          = "revision.sha"
+	RevisionDateKeyName         = "revision.date"
+
+	// RevisionAnnotation records the git commit a generated Application was rendered from
+	RevisionAnnotation = "applicationset.argoproj.io/revision"
+
+	// LastAppliedMetadataAnnotation records the keys of the labels and annotations, and the finalizers, the
+	// controller set on a generated Application, so that those removed from the template are removed from it
+	LastAppliedMetadataAnnotation = "applicationset.argoproj.io/last-applied-metadata"
+
+	// AllowDeletionsAnnotation acknowledges the deletions of Applications blocked by the maxDeletions of an
+	// ApplicationSet, when it's set to their hash. It's removed once they are done.
+	AllowDeletionsAnnotation = "applicationset.argoproj.io/allow-deletions"
+
+	// ReleasedByAnnotation records the ApplicationSet which released an Application to the ApplicationSet adopting
+	// its Applications, until it's adopted
+	ReleasedByAnnotation = "applicationset.argoproj.io/released-by"
+
+	// ResourcesFinalizerName is the Argo CD finalizer deleting the resources of an Application along with it.
+	// Argo CD v1.7 only handles this exact name: an Application with a variant of it, e.g. suffixed with
+	// '/foreground' as supported by later versions, is never deleted.
+	ResourcesFinalizerName = "resources-finalizer.argocd.argoproj.io"
+
+	// OrphanApplicationsFinalizerName is the finalizer of the ApplicationSets with skipPrune, which releases
+	// their Applications before they are deleted, so that the Applications are not garbage collected with them
+	OrphanApplicationsFinalizerName = "applicationset.argoproj.io/orphan-applications"
 )
@@ -17,6 +17,8 @@ import (
 
 // override "sigs.k8s.io/controller-runtime" CreateOrUpdate function to add equity function for argov1alpha1.ApplicationDestination
 // argov1alpha1.ApplicationDestination has a private variable, so the default implementation fails to compare it
+// The mutate function is expected to leave the ignored fields of the Application (see PreserveIgnoredFields) to their
+// live value, so that an Application differing only in these fields is not updated
 func CreateOrUpdate(ctx context.Context, c client.Client, obj runtime.Object, f controllerutil.MutateFn) (controllerutil.OperationResult, error) {
 	key, err := client.ObjectKeyFromObject(obj)
 	if err != nil {
@@ -41,32 +43,7 @@ func CreateOrUpdate(ctx context.Context, c client.Client, obj runtime.Object, f
 		return controllerutil.OperationResultNone, err
 	}
 
-	equality := conversion.EqualitiesOrDie(
-		func(a, b resource.Quantity) bool {
-			// Ignore formatting, only care that numeric value stayed the same.
-			// TODO: if we decide it's important, it should be safe to start comparing the format.
-			//
-			// Uninitialized quantities are equivalent to 0 quantities.
-			return a.Cmp(b) == 0
-		},
-		func(a, b metav1.MicroTime) bool {
-			return a.UTC() == b.UTC()
-		},
-		func(a, b metav1.Time) bool {
-			return a.UTC() == b.UTC()
-		},
-		func(a, b labels.Selector) bool {
-			return a.String() == b.String()
-		},
-		func(a, b fields.Selector) bool {
-			return a.String() == b.String()
-		},
-		func (a,b argov1alpha1.ApplicationDestination) bool {
-			return a.Namespace == b.Namespace && a.Name == b.Name && a.Server == b.Server
-		},
-	)
-
-	if equality.DeepEqual(existing, obj) {
+	if Equal(existing, obj) {
 		return controllerutil.OperationResultNone, nil
 	}
 
@@ -76,6 +53,38 @@ func CreateOrUpdate(ctx context.Context, c client.Client, obj runtime.Object, f
 	return controllerutil.OperationResultUpdated, nil
 }
 
+// equality compares the objects ignoring the formatting of their quantities, times and selectors, and the private
+// variable of argov1alpha1.ApplicationDestination
+var equality = conversion.EqualitiesOrDie(
+	func(a, b resource.Quantity) bool {
+		// Ignore formatting, only care that numeric value stayed the same.
+		// TODO: if we decide it's important, it should be safe to start comparing the format.
+		//
+		// Uninitialized quantities are equivalent to 0 quantities.
+		return a.Cmp(b) == 0
+	},
+	func(a, b metav1.MicroTime) bool {
+		return a.UTC() == b.UTC()
+	},
+	func(a, b metav1.Time) bool {
+		return a.UTC() == b.UTC()
+	},
+	func(a, b labels.Selector) bool {
+		return a.String() == b.String()
+	},
+	func(a, b fields.Selector) bool {
+		return a.String() == b.String()
+	},
+	func (a,b argov1alpha1.ApplicationDestination) bool {
+		return a.Namespace == b.Namespace && a.Name == b.Name && a.Server == b.Server
+	},
+)
+
+// Equal returns whether the objects are equal, as compared by CreateOrUpdate to decide whether to update an object
+func Equal(a, b interface{}) bool {
+	return equality.DeepEqual(a, b)
+}
+
 // mutate wraps a MutateFn and applies validation to its result
 func mutate(f controllerutil.MutateFn, key client.ObjectKey, obj runtime.Object) error {
 	if err := f(); err != nil {
@@ -0,0 +1,320 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/Masterminds/sprig/v3"
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/pkg/errors"
+)
+
+var _ Renderer = (*GoTemplateRender)(nil)
+
+// goTemplateOptions are the text/template options which may be set in goTemplateOptions
+var goTemplateOptions = map[string]bool{
+	"missingkey=default": true,
+	"missingkey=invalid": true,
+	"missingkey=zero":    true,
+	"missingkey=error":   true,
+}
+
+// goTemplateFuncNames are the sprig functions available to the templates. Only deterministic functions are
+// allowed, as a function returning a different value on each call, e.g. now, randAlpha, uuidv4 or genPrivateKey,
+// would update the generated Applications on every reconciliation. Those giving access to the environment of the
+// controller, e.g. env or getHostByName, are not allowed either.
+var goTemplateFuncNames = []string{
+	// Strings
+	"abbrev", "abbrevboth", "camelcase", "cat", "contains", "hasPrefix", "hasSuffix", "indent", "initials",
+	"kebabcase", "lower", "nindent", "nospace", "plural", "quote", "repeat", "replace", "snakecase",
+	"squote", "substr", "swapcase", "title", "trim", "trimAll", "trimall", "trimPrefix", "trimSuffix", "trunc",
+	"untitle", "upper", "wrap", "wrapWith",
+	// String lists
+	"join", "sortAlpha", "split", "splitList", "splitn", "toStrings",
+	// Regular expressions
+	"regexFind", "regexFindAll", "regexMatch", "regexReplaceAll", "regexReplaceAllLiteral", "regexSplit",
+	"mustRegexFind", "mustRegexFindAll", "mustRegexMatch", "mustRegexReplaceAll", "mustRegexReplaceAllLiteral",
+	"mustRegexSplit",
+	// Conversions
+	"atoi", "float64", "int", "int64", "toDecimal", "toString",
+	// Math
+	"add", "add1", "biggest", "ceil", "div", "floor", "max", "min", "mod", "mul", "round", "seq", "sub", "until",
+	"untilStep",
+	// Defaults and flow control
+	"coalesce", "default", "empty", "fail", "ternary",
+	// Encoding
+	"b32dec", "b32enc", "b64dec", "b64enc", "mustToJson", "mustToPrettyJson",
+	"mustToRawJson", "toJson", "toPrettyJson", "toRawJson",
+	// Hashes
+	"adler32sum", "sha1sum", "sha256sum",
+	// Lists
+	"append", "compact", "concat", "first", "has", "initial", "last", "list", "prepend", "push", "rest", "reverse",
+	"slice", "tuple", "uniq", "without", "mustAppend", "mustCompact", "mustFirst", "mustHas", "mustInitial",
+	"mustLast", "mustPrepend", "mustPush", "mustRest", "mustReverse", "mustSlice", "mustUniq", "mustWithout",
+	// Dictionaries
+	"deepCopy", "dict", "get", "hasKey", "keys", "merge", "mergeOverwrite", "mustDeepCopy", "mustMerge",
+	"mustMergeOverwrite", "omit", "pick", "pluck", "set", "unset", "values",
+	// Types and reflection
+	"deepEqual", "kindIs", "kindOf", "typeIs", "typeIsLike", "typeOf",
+	// Paths and URLs
+	"base", "clean", "dir", "ext", "isAbs", "urlJoin", "urlParse",
+	// Semantic versions
+	"semver", "semverCompare",
+}
+
+// goTemplateFuncs are the allowed sprig functions
+var goTemplateFuncs = func() template.FuncMap {
+	sprigFuncs := sprig.TxtFuncMap()
+	funcs := template.FuncMap{}
+	for _, name := range goTemplateFuncNames {
+		if f, ok := sprigFuncs[name]; ok {
+			funcs[name] = f
+		}
+	}
+	return funcs
+}()
+
+// GoTemplateRender renders each string of the template, including map keys, as a Go text/template,
+// with the params as data. Params with dots in their name, e.g. 'metadata.labels.env', are also available
+// nested ({{ .metadata.labels.env }}) unless the prefix is itself a param, as is 'path' of the Git generator;
+// they can always be accessed with index, e.g. {{ index . "path.basename" }}.
+type GoTemplateRender struct {
+	// Options are the text/template options, e.g. 'missingkey=error'
+	Options []string
+}
+
+func (r *GoTemplateRender) RenderTemplateParams(tmpl *argoprojiov1alpha1.ApplicationSetTemplate, params map[string]interface{}) (*argov1alpha1.Application, error) {
+	if err := r.checkOptions(); err != nil {
+		return nil, err
+	}
+
+	data := nestParams(params)
+	// unresolved collects the missing keys of all the strings, so that they are all reported at once
+	unresolved := &UnresolvedParamsError{}
+	res, err := renderTemplate(tmpl, func(s string) (interface{}, error) {
+		rendered, err := r.execute(s, data)
+		if unresolvedErr, ok := err.(*UnresolvedParamsError); ok {
+			for _, key := range unresolvedErr.Keys {
+				unresolved.add(key)
+			}
+			return s, nil
+		}
+		return rendered, err
+	})
+	if len(unresolved.Keys) > 0 {
+		return nil, unresolved
+	}
+	return res, err
+}
+
+// RenderYAML renders the YAML document as a whole, so that its structure may depend on the params, e.g. with
+// '{{ if }}' actions. The values printed by the actions are inserted once the document is parsed.
+func (r *GoTemplateRender) RenderYAML(s string, params map[string]interface{}) (interface{}, error) {
+	if err := r.checkOptions(); err != nil {
+		return nil, err
+	}
+	data := nestParams(params)
+	return renderYAML(func(format func(value interface{}) string) (string, error) {
+		return r.executeWith(s, data, func(value interface{}) string {
+			return format(fmt.Sprint(value))
+		})
+	})
+}
+
+func (r *GoTemplateRender) checkOptions() error {
+	for _, option := range r.Options {
+		if !goTemplateOptions[option] {
+			return fmt.Errorf("unsupported goTemplateOptions %q", option)
+		}
+	}
+	return nil
+}
+
+// missingKeyRegex matches the error of text/template for a missing key with missingkey=error, capturing the
+// field chain of the key from the root of the data, e.g. '.values.tag' or '$.values.tag'
+var missingKeyRegex = regexp.MustCompile(`at <\$?((?:\.[^.\s<>]+)+)>: map has no entry for key`)
+
+// execute renders the string s as a Go template with data. With missingkey=error, text/template stops at the
+// first missing key: it's set to an empty value and the template executed again, so that an UnresolvedParamsError
+// reports all the missing keys at once.
+func (r *GoTemplateRender) execute(s string, data map[string]interface{}) (string, error) {
+	return r.executeWith(s, data, nil)
+}
+
+// formatFuncName is the function through which the output of the actions is piped when it's formatted
+const formatFuncName = "__applicationset_format"
+
+// executeWith is execute, formatting the output of the actions with format when it's set
+func (r *GoTemplateRender) executeWith(s string, data map[string]interface{}, format func(value interface{}) string) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+
+	t, err := template.New("").Option(r.Options...).Funcs(goTemplateFuncs).Parse(s)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse template %q", s)
+	}
+	if format != nil {
+		t.Funcs(template.FuncMap{formatFuncName: format})
+		for _, tmpl := range t.Templates() {
+			if tmpl.Tree != nil {
+				formatActions(tmpl.Tree, tmpl.Tree.Root)
+			}
+		}
+	}
+
+	unresolved := &UnresolvedParamsError{}
+	for {
+		var buf bytes.Buffer
+		err := t.Execute(&buf, data)
+		if err == nil && len(unresolved.Keys) == 0 {
+			return buf.String(), nil
+		}
+
+		// The keys which are not relative to the root of the data, e.g. within a range, can't be set, and are
+		// reported as soon as they are missing again
+		match := missingKeyRegex.FindStringSubmatch(fmt.Sprint(err))
+		if match == nil || containsKey(unresolved.Keys, match[1][1:]) {
+			if len(unresolved.Keys) > 0 {
+				return "", unresolved
+			}
+			return "", errors.Wrapf(err, "failed to execute template %q", s)
+		}
+		unresolved.add(match[1][1:])
+		data = withEmptyKey(data, strings.Split(match[1][1:], "."))
+	}
+}
+
+// formatActions pipes the output of the actions of the node, and of the nodes it contains, through the
+// formatFuncName function. Actions which declare or assign variables print nothing and are left as is.
+func formatActions(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			formatActions(tree, child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		format := &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{parse.NewIdentifier(formatFuncName).SetTree(tree).SetPos(n.Pos)},
+		}
+		n.Pipe.Cmds = append(n.Pipe.Cmds, format)
+	case *parse.IfNode:
+		formatActions(tree, n.List)
+		formatActions(tree, n.ElseList)
+	case *parse.RangeNode:
+		formatActions(tree, n.List)
+		formatActions(tree, n.ElseList)
+	case *parse.WithNode:
+		formatActions(tree, n.List)
+		formatActions(tree, n.ElseList)
+	}
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// withEmptyKey returns a copy of the data in which the nested key is set to an empty string. The maps on the path
+// of the key are copied, so that the data isn't modified.
+func withEmptyKey(data map[string]interface{}, key []string) map[string]interface{} {
+	res := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		res[k] = v
+	}
+
+	if len(key) == 1 {
+		res[key[0]] = ""
+		return res
+	}
+	nested, ok := res[key[0]].(map[string]interface{})
+	if !ok {
+		nested = map[string]interface{}{}
+	}
+	res[key[0]] = withEmptyKey(nested, key[1:])
+	return res
+}
+
+// nestParams returns the params along with their nested form, e.g. 'metadata.labels.env' is also made
+// available as metadata: {labels: {env: ...}}. The params themselves take precedence on conflicts.
+// The params are shared by all the Applications of a generator, so the maps they hold are copied before other
+// params are nested into them. The keys are nested in order, so that the params nested into a map are always added to it.
+func nestParams(params map[string]interface{}) map[string]interface{} {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	nested := map[string]interface{}{}
+	for _, key := range keys {
+		value := params[key]
+		parts := strings.Split(key, ".")
+		if len(parts) < 2 {
+			continue
+		}
+
+		current := nested
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := current[part]
+			if !ok {
+				next = map[string]interface{}{}
+				current[part] = next
+			}
+			if current, ok = next.(map[string]interface{}); !ok {
+				break
+			}
+		}
+		if current != nil {
+			if _, ok := current[parts[len(parts)-1]]; !ok {
+				current[parts[len(parts)-1]] = copyMaps(value)
+			}
+		}
+	}
+
+	res := make(map[string]interface{}, len(params)+len(nested))
+	for key, value := range nested {
+		res[key] = value
+	}
+	for key, value := range params {
+		res[key] = value
+	}
+	return res
+}
+
+// copyMaps returns a copy of the value in which all the maps, including those nested in lists, are copied
+func copyMaps(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			res[key] = copyMaps(elem)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, elem := range v {
+			res[i] = copyMaps(elem)
+		}
+		return res
+	}
+	return value
+}
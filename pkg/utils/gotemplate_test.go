@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Masterminds/sprig/v3"
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGoTemplateRenderTemplateParams(t *testing.T) {
+	var tmpl argoprojiov1alpha1.ApplicationSetTemplate
+	err := json.Unmarshal([]byte(`{
+		"metadata": {
+			"name": "{{ .name | lower | trunc 10 }}-{{ .metadata.labels.env | default \"dev\" }}",
+			"labels": {"{{ if .values.prune }}prune{{ else }}keep{{ end }}": "{{ index . \"path.basename\" }}"}
+		},
+		"spec": {
+			"project": "{{ range $i, $e := .values.list }}{{ if $i }},{{ end }}{{ $e }}{{ end }}",
+			"syncPolicy": {"automated": {"prune": "{{ .values.prune }}"}}
+		}
+	}`), &tmpl)
+	require.NoError(t, err)
+
+	render := GoTemplateRender{}
+	got, err := render.RenderTemplateParams(&tmpl, map[string]interface{}{
+		"name":          "Production-Cluster",
+		"path":          "apps/guestbook",
+		"path.basename": "guestbook",
+		"values": map[string]interface{}{
+			"prune": true,
+			"list":  []interface{}{"a", "b"},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &argov1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "production-dev",
+			Labels: map[string]string{"prune": "guestbook"},
+		},
+		Spec: argov1alpha1.ApplicationSpec{
+			Project: "a,b",
+			SyncPolicy: &argov1alpha1.SyncPolicy{
+				Automated: &argov1alpha1.SyncPolicyAutomated{Prune: true},
+			},
+		},
+	}, got)
+}
+
+func TestGoTemplateRenderErrors(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		tmplName string
+		options  []string
+	}{
+		{name: "missing key with missingkey=error", tmplName: "{{ .missing }}", options: []string{"missingkey=error"}},
+		{name: "invalid template", tmplName: "{{ .name "},
+		{name: "unsupported option", tmplName: "{{ .name }}", options: []string{"missingkey=ignore"}},
+		{name: "environment is not accessible", tmplName: "{{ env \"HOME\" }}"},
+		{name: "non-deterministic functions are not available", tmplName: "{{ now }}"},
+		{name: "random functions are not available", tmplName: "{{ randAlpha 5 }}"},
+		{name: "uuidv4 is not available", tmplName: "{{ uuidv4 }}"},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			tmpl := argoprojiov1alpha1.ApplicationSetTemplate{ObjectMeta: metav1.ObjectMeta{Name: cc.tmplName}}
+
+			render := GoTemplateRender{Options: cc.options}
+			_, err := render.RenderTemplateParams(&tmpl, map[string]interface{}{"name": "name"})
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestGoTemplateRenderMissingKeys(t *testing.T) {
+	tmpl := argoprojiov1alpha1.ApplicationSetTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "{{ .name }}-{{ .missing }}-{{ .values.tag }}",
+			Labels: map[string]string{"env": "{{ .metadata.labels.env }}", "team": "{{ $.team }}"},
+		},
+		Spec: argoprojiov1alpha1.ApplicationTemplateSpec{
+			ApplicationSpec: argov1alpha1.ApplicationSpec{Project: "{{ range .values.list }}{{ .name }}{{ end }}"},
+		},
+	}
+	params := map[string]interface{}{
+		"name":   "name",
+		"values": map[string]interface{}{"list": []interface{}{map[string]interface{}{"other": "value"}}},
+	}
+
+	render := GoTemplateRender{Options: []string{"missingkey=error"}}
+	_, err := render.RenderTemplateParams(&tmpl, params)
+
+	// All the missing keys are reported, sorted, including those relative to a range
+	if assert.IsType(t, &UnresolvedParamsError{}, err) {
+		assert.Equal(t, []string{"metadata.labels.env", "missing", "name", "team", "values.tag"}, err.(*UnresolvedParamsError).Keys)
+	}
+	// The params are not modified
+	assert.Equal(t, map[string]interface{}{"list": []interface{}{map[string]interface{}{"other": "value"}}}, params["values"])
+}
+
+func TestGoTemplateFuncs(t *testing.T) {
+	// The allowed functions all exist, so that none is silently missing
+	sprigFuncs := sprig.TxtFuncMap()
+	for _, name := range goTemplateFuncNames {
+		assert.Contains(t, sprigFuncs, name)
+	}
+	assert.Len(t, goTemplateFuncs, len(goTemplateFuncNames))
+
+	for _, name := range []string{"now", "ago", "randAlphaNum", "shuffle", "uuidv4", "genPrivateKey", "htpasswd", "encryptAES", "env", "expandenv", "getHostByName"} {
+		assert.NotContains(t, goTemplateFuncs, name)
+	}
+}
+
+func TestNestParams(t *testing.T) {
+	got := nestParams(map[string]interface{}{
+		"name":                "cluster",
+		"path":                "apps/guestbook",
+		"path.basename":       "guestbook",
+		"metadata.labels.env": "prod",
+	})
+
+	assert.Equal(t, map[string]interface{}{
+		"name":                "cluster",
+		"path":                "apps/guestbook",
+		"path.basename":       "guestbook",
+		"metadata.labels.env": "prod",
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{"env": "prod"},
+		},
+	}, got)
+}
+
+func TestNestParamsDoesNotModifyParams(t *testing.T) {
+	params := map[string]interface{}{
+		"values.labels":         map[string]interface{}{"team": map[string]interface{}{"name": "a"}},
+		"values.labels.env":     "prod",
+		"values.labels.team.id": "1",
+	}
+
+	got := nestParams(params)
+
+	assert.Equal(t, map[string]interface{}{
+		"values.labels":         map[string]interface{}{"team": map[string]interface{}{"name": "a"}},
+		"values.labels.env":     "prod",
+		"values.labels.team.id": "1",
+	}, params)
+	assert.Equal(t, map[string]interface{}{
+		"labels": map[string]interface{}{"env": "prod", "team": map[string]interface{}{"name": "a", "id": "1"}},
+	}, got["values"])
+}
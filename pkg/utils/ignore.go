@@ -0,0 +1,344 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/itchyny/gojq"
+	"github.com/pkg/errors"
+)
+
+// PreserveIgnoredFields returns the generated Application with the fields ignored by the rules matching its name
+// set to their value in the live Application, or removed when the live Application doesn't set them. Updating
+// the live Application with the result then leaves the ignored fields unchanged, and doesn't update it at all
+// when only ignored fields differ.
+func PreserveIgnoredFields(rules []argoprojiov1alpha1.ApplicationSetIgnoreDifferences, live *argov1alpha1.Application, generated *argov1alpha1.Application) (*argov1alpha1.Application, error) {
+	var pointers, jqExpressions []string
+	for _, rule := range rules {
+		if rule.Name == "" || rule.Name == generated.Name {
+			pointers = append(pointers, rule.JSONPointers...)
+			jqExpressions = append(jqExpressions, rule.JQPathExpressions...)
+		}
+	}
+	if len(pointers) == 0 && len(jqExpressions) == 0 {
+		return generated, nil
+	}
+
+	liveValue, err := toJSONValue(live)
+	if err != nil {
+		return nil, err
+	}
+	generatedValue, err := toJSONValue(generated)
+	if err != nil {
+		return nil, err
+	}
+
+	var pairs []pathPair
+	for _, pointer := range pointers {
+		path, err := parseJSONPointer(pointer)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pathPair{live: path, generated: path})
+	}
+	for _, expression := range jqExpressions {
+		query, err := gojq.Parse(fmt.Sprintf("path(%s)", expression))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error in parsing the JQ path expression %q", expression)
+		}
+		pairs = append(pairs, pairPaths(jqPaths(query, liveValue), jqPaths(query, generatedValue))...)
+	}
+
+	// The fields missing from the live Application are removed last, the elements of the lists from the last, so
+	// that removing an element doesn't shift the index of the others. The live elements missing from the generated
+	// lists are appended after that, for the same reason.
+	var removed, appended [][]interface{}
+	for _, pair := range pairs {
+		switch {
+		case pair.generated == nil:
+			appended = append(appended, pair.live)
+		case pair.live == nil:
+			removed = append(removed, pair.generated)
+		default:
+			if value, ok := getPath(liveValue, pair.live); ok {
+				generatedValue = setPath(generatedValue, pair.generated, value)
+			} else {
+				removed = append(removed, pair.generated)
+			}
+		}
+	}
+	sort.SliceStable(removed, func(i, j int) bool {
+		return comparePaths(removed[i], removed[j]) > 0
+	})
+	for _, path := range removed {
+		generatedValue = removePath(generatedValue, path)
+	}
+	for _, path := range appended {
+		generatedValue = appendPath(generatedValue, liveValue, path)
+	}
+
+	generatedJSON, err := json.Marshal(generatedValue)
+	if err != nil {
+		return nil, err
+	}
+	var res argov1alpha1.Application
+	if err := json.Unmarshal(generatedJSON, &res); err != nil {
+		return nil, errors.Wrap(err, "Error in decoding the Application with its ignored fields")
+	}
+
+	return &res, nil
+}
+
+func toJSONValue(obj interface{}) (interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var res interface{}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// pathPair is a path to the same field in the live and the generated Application. Either path is nil when the
+// field is only in the other Application.
+type pathPair struct {
+	live      []interface{}
+	generated []interface{}
+}
+
+// pairPaths pairs the paths output by a JQ expression on the live and the generated Application in the order they're
+// output, so that the elements selected from lists are paired by what the expression selects them on rather than by
+// their index, e.g. the 'replicas' parameter of both Applications for
+// '.spec.source.helm.parameters[] | select(.name == "replicas")', wherever it is in either list.
+func pairPaths(livePaths [][]interface{}, generatedPaths [][]interface{}) []pathPair {
+	var res []pathPair
+	for i := 0; i < len(livePaths) || i < len(generatedPaths); i++ {
+		var pair pathPair
+		if i < len(livePaths) {
+			pair.live = livePaths[i]
+		}
+		if i < len(generatedPaths) {
+			pair.generated = generatedPaths[i]
+		}
+		res = append(res, pair)
+	}
+	return res
+}
+
+// parseJSONPointer returns the keys of a RFC 6901 JSON pointer, e.g. ["spec", "syncPolicy"] for '/spec/syncPolicy'
+func parseJSONPointer(pointer string) ([]interface{}, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q: it must start with '/'", pointer)
+	}
+
+	var res []interface{}
+	for _, token := range strings.Split(pointer[1:], "/") {
+		res = append(res, strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1))
+	}
+	return res, nil
+}
+
+// jqPaths returns the paths output by a JQ 'path(...)' query. An expression which can't be evaluated on the
+// value, e.g. iterating over a missing list, has no paths.
+func jqPaths(query *gojq.Query, value interface{}) [][]interface{} {
+	var res [][]interface{}
+	iter := query.Run(value)
+	for {
+		path, ok := iter.Next()
+		if !ok {
+			return res
+		}
+		if _, isErr := path.(error); isErr {
+			return res
+		}
+		if keys, isPath := path.([]interface{}); isPath {
+			res = append(res, keys)
+		}
+	}
+}
+
+// comparePaths compares two paths key by key, list indices as numbers so that e.g. index 10 comes after index 9,
+// and returns -1, 0 or 1. A path comes after the paths it's prefixed with.
+func comparePaths(a []interface{}, b []interface{}) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if res := compareKeys(a[i], b[i]); res != 0 {
+			return res
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+// compareKeys compares two keys of paths. Keys which may be list indices, numbers or strings holding a number,
+// are compared as numbers, and come before the other keys, which are compared as strings.
+func compareKeys(a interface{}, b interface{}) int {
+	aIndex, aIsIndex := listIndex(a, math.MaxInt32)
+	bIndex, bIsIndex := listIndex(b, math.MaxInt32)
+	switch {
+	case aIsIndex && bIsIndex:
+		return compareInts(aIndex, bIndex)
+	case aIsIndex:
+		return -1
+	case bIsIndex:
+		return 1
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func compareInts(a int, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// listIndex returns the index of a list addressed by a key of a path, which is a number for JQ paths and a
+// string for JSON pointers
+func listIndex(key interface{}, length int) (int, bool) {
+	var index int
+	switch k := key.(type) {
+	case int:
+		index = k
+	case float64:
+		index = int(k)
+	case string:
+		var err error
+		if index, err = strconv.Atoi(k); err != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	return index, index >= 0 && index < length
+}
+
+func getPath(value interface{}, path []interface{}) (interface{}, bool) {
+	for _, key := range path {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			k, ok := key.(string)
+			if !ok {
+				return nil, false
+			}
+			if value, ok = v[k]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			index, ok := listIndex(key, len(v))
+			if !ok {
+				return nil, false
+			}
+			value = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// setPath sets the value at the path, creating the missing objects on the way. A path to a missing element of
+// a list is not set.
+func setPath(value interface{}, path []interface{}, newValue interface{}) interface{} {
+	if len(path) == 0 {
+		return newValue
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		if index, ok := listIndex(path[0], len(v)); ok {
+			v[index] = setPath(v[index], path[1:], newValue)
+		}
+		return v
+	case map[string]interface{}:
+		if k, ok := path[0].(string); ok {
+			v[k] = setPath(v[k], path[1:], newValue)
+		}
+		return v
+	case nil:
+		if k, ok := path[0].(string); ok {
+			return map[string]interface{}{k: setPath(nil, path[1:], newValue)}
+		}
+	}
+	return value
+}
+
+func removePath(value interface{}, path []interface{}) interface{} {
+	if len(path) == 0 {
+		return value
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		index, ok := listIndex(path[0], len(v))
+		if !ok {
+			return v
+		}
+		if len(path) == 1 {
+			return append(v[:index:index], v[index+1:]...)
+		}
+		v[index] = removePath(v[index], path[1:])
+		return v
+	case map[string]interface{}:
+		k, ok := path[0].(string)
+		if !ok {
+			return v
+		}
+		if len(path) == 1 {
+			delete(v, k)
+		} else if elem, exists := v[k]; exists {
+			v[k] = removePath(elem, path[1:])
+		}
+		return v
+	}
+	return value
+}
+
+// appendPath sets a field of the live value, which the generated value doesn't have, in the generated value. A field
+// within an element of a list, which is missing from the generated list, is set by appending the whole live element
+// to it, as its index in the live list doesn't address the same element of the generated list.
+func appendPath(generated interface{}, live interface{}, path []interface{}) interface{} {
+	last := -1
+	for i, key := range path {
+		if _, isKey := key.(string); !isKey {
+			last = i
+		}
+	}
+	if last < 0 {
+		if value, ok := getPath(live, path); ok {
+			return setPath(generated, path, value)
+		}
+		return generated
+	}
+
+	elem, ok := getPath(live, path[:last+1])
+	if !ok {
+		return generated
+	}
+	list, ok := getPath(generated, path[:last])
+	if !ok {
+		return generated
+	}
+	if l, isList := list.([]interface{}); isList {
+		return setPath(generated, path[:last], append(l, elem))
+	}
+	return generated
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+)
+
+func TestComparePaths(t *testing.T) {
+	for _, c := range []struct {
+		a        []interface{}
+		b        []interface{}
+		expected int
+	}{
+		{a: []interface{}{"spec", 9}, b: []interface{}{"spec", 10}, expected: -1},
+		{a: []interface{}{"spec", "10"}, b: []interface{}{"spec", "9"}, expected: 1},
+		{a: []interface{}{"spec", float64(2)}, b: []interface{}{"spec", "2"}, expected: 0},
+		{a: []interface{}{"spec", "b"}, b: []interface{}{"spec", "a"}, expected: 1},
+		{a: []interface{}{"spec", 0}, b: []interface{}{"spec", "a"}, expected: -1},
+		{a: []interface{}{"spec"}, b: []interface{}{"spec", "a"}, expected: -1},
+	} {
+		assert.Equal(t, c.expected, comparePaths(c.a, c.b), "%v %v", c.a, c.b)
+	}
+}
+
+func TestPreserveIgnoredFields(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		rules     []argoprojiov1alpha1.ApplicationSetIgnoreDifferences
+		live      string
+		generated string
+		expected  string
+		expectErr bool
+	}{
+		{
+			name:      "no rules",
+			live:      `{"metadata":{"name":"app"},"spec":{"project":"live"}}`,
+			generated: `{"metadata":{"name":"app"},"spec":{"project":"generated"}}`,
+			expected:  `{"metadata":{"name":"app"},"spec":{"project":"generated"}}`,
+		},
+		{
+			name: "JSON pointer keeps the live value",
+			rules: []argoprojiov1alpha1.ApplicationSetIgnoreDifferences{
+				{JSONPointers: []string{"/spec/syncPolicy"}},
+			},
+			live:      `{"metadata":{"name":"app"},"spec":{"project":"live","syncPolicy":{"automated":{"prune":true}}}}`,
+			generated: `{"metadata":{"name":"app"},"spec":{"project":"generated","syncPolicy":{"automated":{}}}}`,
+			expected:  `{"metadata":{"name":"app"},"spec":{"project":"generated","syncPolicy":{"automated":{"prune":true}}}}`,
+		},
+		{
+			name: "JSON pointer removes the fields missing from the live Application",
+			rules: []argoprojiov1alpha1.ApplicationSetIgnoreDifferences{
+				{JSONPointers: []string{"/spec/syncPolicy", "/spec/source/helm/parameters/1"}},
+			},
+			live:      `{"metadata":{"name":"app"},"spec":{"source":{"helm":{"parameters":[{"name":"a"}]}}}}`,
+			generated: `{"metadata":{"name":"app"},"spec":{"source":{"helm":{"parameters":[{"name":"a"},{"name":"b"}]}},"syncPolicy":{"automated":{}}}}`,
+			expected:  `{"metadata":{"name":"app"},"spec":{"source":{"helm":{"parameters":[{"name":"a"}]}}}}`,
+		},
+		{
+			name: "elements are removed from the last, by index",
+			rules: []argoprojiov1alpha1.ApplicationSetIgnoreDifferences{
+				{JSONPointers: []string{"/spec/source/helm/parameters/2", "/spec/source/helm/parameters/10"}},
+			},
+			live:      `{"metadata":{"name":"app"},"spec":{"source":{"helm":{"parameters":[{"name":"p0"},{"name":"p1"}]}}}}`,
+			generated: `{"metadata":{"name":"app"},"spec":{"source":{"helm":{"parameters":[{"name":"p0"},{"name":"p1"},{"name":"p2"},{"name":"p3"},{"name":"p4"},{"name":"p5"},{"name":"p6"},{"name":"p7"},{"name":"p8"},{"name":"p9"},{"name":"p10"},{"name":"p11"}]}}}}`,
+			expected:  `{"metadata":{"name":"app"},"spec":{"source":{"helm":{"parameters":[{"name":"p0"},{"name":"p1"},{"name":"p3"},{"name":"p4"},{"name":"p5"},{"name":"p6"},{"name":"p7"},{"name":"p8"},{"name":"p9"},{"name":"p11"}]}}}}`,
+		},
+		{
+			name: "JSON pointer with escaped keys",
+			rules: []argoprojiov1alpha1.ApplicationSetIgnoreDifferences{
+				{JSONPointers: []string{"/metadata/annotations/example.com~1a~0b"}},
+			},
+			live:      `{"metadata":{"name":"app","annotations":{"example.com/a~b":"live"}},"spec":{}}`,
+			generated: `{"metadata":{"name":"app","annotations":{"example.com/a~b":"generated"}},"spec":{}}`,
+			expected:  `{"metadata":{"name":"app","annotations":{"example.com/a~b":"live"}},"spec":{}}`,
+		},
+		{
+			name: "JQ path expression",
+			rules: []argoprojiov1alpha1.ApplicationSetIgnoreDifferences{
+				{JQPathExpressions: []string{`.spec.source.helm.parameters[] | select(.name == "replicas")`}},
+			},
+			live:      `{"metadata":{"name":"app"},"spec":{"source":{"helm":{"parameters":[{"name":"image","value":"v1"},{"name":"replicas","value":"5"}]}}}}`,
+			generated: `{"metadata":{"name":"app"},"spec":{"source":{"helm":{"parameters":[{"name":"image","value":"v2"},{"name":"replicas","value":"1"}]}}}}`,
+			expected:  `{"metadata":{"name":"app"},"spec":{"source":{"helm":{"parameters":[{"name":"image","value":"v2"},{"name":"replicas","value":"5"}]}}}}`,
+		},
+		{
+			name: "JQ path expression pairs the selected elements of reordered lists",
+			rules: []argoprojiov1alpha1.ApplicationSetIgnoreDifferences{
+				{JQPathExpressions: []string{`.spec.source.helm.parameters[] | select(.name == "replicas")`}},
+			},
+			live:      `{"metadata":{"name":"app"},"spec":{"source":{"helm":{"parameters":[{"name":"a"},{"name":"b"},{"name":"replicas","value":"5"}]}}}}`,
+			generated: `{"metadata":{"name":"app"},"spec":{"source":{"helm":{"parameters":[{"name":"a"},{"name":"replicas","value":"1"},{"name":"c"},{"name":"d"}]}}}}`,
+			expected:  `{"metadata":{"name":"app"},"spec":{"source":{"helm":{"parameters":[{"name":"a"},{"name":"replicas","value":"5"},{"name":"c"},{"name":"d"}]}}}}`,
+		},
+		{
+			name: "JQ path expression appends the selected live elements missing from the generated list",
+			rules: []argoprojiov1alpha1.ApplicationSetIgnoreDifferences{
+				{JQPathExpressions: []string{`.spec.source.helm.parameters[] | select(.name == "replicas") | .value`}},
+			},
+			live:      `{"metadata":{"name":"app"},"spec":{"source":{"helm":{"parameters":[{"name":"replicas","value":"5"},{"name":"a"}]}}}}`,
+			generated: `{"metadata":{"name":"app"},"spec":{"source":{"helm":{"parameters":[{"name":"a"},{"name":"b"}]}}}}`,
+			expected:  `{"metadata":{"name":"app"},"spec":{"source":{"helm":{"parameters":[{"name":"a"},{"name":"b"},{"name":"replicas","value":"5"}]}}}}`,
+		},
+		{
+			name: "JQ path expression not matching the live Application",
+			rules: []argoprojiov1alpha1.ApplicationSetIgnoreDifferences{
+				{JQPathExpressions: []string{`.spec.source.helm.parameters[] | select(.name == "replicas")`}},
+			},
+			live:      `{"metadata":{"name":"app"},"spec":{"source":{}}}`,
+			generated: `{"metadata":{"name":"app"},"spec":{"source":{"helm":{"parameters":[{"name":"replicas","value":"1"}]}}}}`,
+			expected:  `{"metadata":{"name":"app"},"spec":{"source":{"helm":{}}}}`,
+		},
+		{
+			name: "rules of other Applications are skipped",
+			rules: []argoprojiov1alpha1.ApplicationSetIgnoreDifferences{
+				{Name: "other", JSONPointers: []string{"/spec/project"}},
+				{Name: "app", JSONPointers: []string{"/spec/destination/namespace"}},
+			},
+			live:      `{"metadata":{"name":"app"},"spec":{"project":"live","destination":{"namespace":"live"}}}`,
+			generated: `{"metadata":{"name":"app"},"spec":{"project":"generated","destination":{"namespace":"generated"}}}`,
+			expected:  `{"metadata":{"name":"app"},"spec":{"project":"generated","destination":{"namespace":"live"}}}`,
+		},
+		{
+			name: "invalid JSON pointer",
+			rules: []argoprojiov1alpha1.ApplicationSetIgnoreDifferences{
+				{JSONPointers: []string{"spec"}},
+			},
+			live:      `{"metadata":{"name":"app"},"spec":{}}`,
+			generated: `{"metadata":{"name":"app"},"spec":{}}`,
+			expectErr: true,
+		},
+		{
+			name: "invalid JQ path expression",
+			rules: []argoprojiov1alpha1.ApplicationSetIgnoreDifferences{
+				{JQPathExpressions: []string{".spec["}},
+			},
+			live:      `{"metadata":{"name":"app"},"spec":{}}`,
+			generated: `{"metadata":{"name":"app"},"spec":{}}`,
+			expectErr: true,
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			var live, generated, expected argov1alpha1.Application
+			assert.NoError(t, json.Unmarshal([]byte(cc.live), &live))
+			assert.NoError(t, json.Unmarshal([]byte(cc.generated), &generated))
+
+			got, err := PreserveIgnoredFields(cc.rules, &live, &generated)
+			if cc.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			assert.NoError(t, json.Unmarshal([]byte(cc.expected), &expected))
+			expectedJSON, err := json.Marshal(expected)
+			assert.NoError(t, err)
+			gotJSON, err := json.Marshal(got)
+			assert.NoError(t, err)
+			assert.JSONEq(t, string(expectedJSON), string(gotJSON))
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/google/go-jsonnet"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultJsonnetTimeout is the time an evaluation of a Jsonnet snippet may take
+	defaultJsonnetTimeout = 10 * time.Second
+	// jsonnetMaxStack is the maximum depth of the calls of a Jsonnet snippet
+	jsonnetMaxStack = 500
+)
+
+// JsonnetRender renders Applications with a Jsonnet snippet, each param being available as an external
+// variable holding its typed value, e.g. 'std.extVar("values").replicas'.
+type JsonnetRender struct {
+	// Snippet is the Jsonnet code
+	Snippet string
+	// Filename is the path of the snippet in its git repository, empty for inline snippets
+	Filename string
+	// Patch evaluates the snippet to a JSON merge patch of the Application rendered from the template by
+	// Renderer, instead of a whole Application
+	Patch bool
+	// Libraries are the only directories imports are read from, with ReadFile
+	Libraries []string
+	// ReadFile returns the content of a file of the git repository of the snippet, or an error satisfying
+	// os.IsNotExist when the file doesn't exist
+	ReadFile func(path string) ([]byte, error)
+	// Renderer renders the template patched by the snippet, and the YAML documents, e.g. the templatePatch
+	Renderer Renderer
+	// Context cancels the evaluations, e.g. when the reconciliation is over
+	Context context.Context
+	// Timeout bounds each evaluation of the snippet, defaultJsonnetTimeout if it's not set
+	Timeout time.Duration
+
+	// importer is shared by the renderings, so that the imported files are only read once
+	importer *libraryImporter
+}
+
+func (j *JsonnetRender) RenderTemplateParams(tmpl *argoprojiov1alpha1.ApplicationSetTemplate, params map[string]interface{}) (*argov1alpha1.Application, error) {
+	if j.importer == nil {
+		j.importer = &libraryImporter{libraries: j.Libraries, readFile: j.ReadFile, cache: map[string]*libraryFile{}}
+	}
+
+	// The default importer reads the local filesystem, it's replaced so that only the libraries can be imported
+	vm := jsonnet.MakeVM()
+	vm.MaxStack = jsonnetMaxStack
+	vm.Importer(j.importer)
+	for key, value := range params {
+		valueJSON, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		vm.ExtCode(key, string(valueJSON))
+	}
+
+	filename := j.Filename
+	if filename == "" {
+		filename = "<snippet>"
+	}
+	res, err := j.evaluate(vm, filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in evaluating the Jsonnet snippet")
+	}
+	resJSON := []byte(res)
+
+	if j.Patch {
+		app, err := j.Renderer.RenderTemplateParams(tmpl, params)
+		if err != nil {
+			return nil, err
+		}
+		appJSON, err := json.Marshal(app)
+		if err != nil {
+			return nil, err
+		}
+		resJSON, err = jsonpatch.MergePatch(appJSON, resJSON)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error in applying the patch returned by the Jsonnet snippet")
+		}
+	}
+
+	var app argov1alpha1.Application
+	if err := json.Unmarshal(resJSON, &app); err != nil {
+		return nil, errors.Wrap(err, "Error in decoding the Application returned by the Jsonnet snippet")
+	}
+
+	return &app, nil
+}
+
+// evaluate evaluates the snippet until the timeout, or the cancellation of the context. go-jsonnet can't be
+// interrupted, so an evaluation which times out goes on in the background, its recursion being bounded by
+// jsonnetMaxStack.
+func (j *JsonnetRender) evaluate(vm *jsonnet.VM, filename string) (string, error) {
+	ctx := j.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout := j.Timeout
+	if timeout == 0 {
+		timeout = defaultJsonnetTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	type result struct {
+		res string
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		res, err := vm.EvaluateSnippet(filename, j.Snippet)
+		done <- result{res: res, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.res, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (j *JsonnetRender) RenderYAML(s string, params map[string]interface{}) (interface{}, error) {
+	return j.Renderer.RenderYAML(s, params)
+}
+
+// libraryImporter is a Jsonnet importer reading files from the library directories of a git repository only,
+// so that snippets can't read the files of the controller.
+type libraryImporter struct {
+	// lock protects the cache, as an evaluation which timed out may still import files
+	lock      sync.Mutex
+	libraries []string
+	readFile  func(path string) ([]byte, error)
+	// cache keeps the files read, or not found, by path, as the importer must return the same content for a path
+	cache map[string]*libraryFile
+}
+
+type libraryFile struct {
+	exists   bool
+	contents jsonnet.Contents
+}
+
+func (l *libraryImporter) Import(importedFrom, importedPath string) (jsonnet.Contents, string, error) {
+	var candidates []string
+	if path.IsAbs(importedPath) {
+		candidates = append(candidates, importedPath)
+	} else {
+		candidates = append(candidates, path.Join(path.Dir(importedFrom), importedPath))
+		for _, library := range l.libraries {
+			candidates = append(candidates, path.Join(library, importedPath))
+		}
+	}
+
+	for _, candidate := range candidates {
+		candidate = strings.TrimPrefix(path.Clean("/"+candidate), "/")
+		if !l.allowed(candidate) {
+			continue
+		}
+		file, err := l.read(candidate)
+		if err != nil {
+			return jsonnet.Contents{}, "", fmt.Errorf("couldn't import %q: %v", importedPath, err)
+		}
+		if file.exists {
+			return file.contents, candidate, nil
+		}
+	}
+
+	return jsonnet.Contents{}, "", fmt.Errorf("couldn't import %q: not found in the Jsonnet libraries", importedPath)
+}
+
+// allowed returns whether a file, with a clean path relative to the root of the repository, is in a library
+func (l *libraryImporter) allowed(filePath string) bool {
+	for _, library := range l.libraries {
+		library = strings.TrimPrefix(path.Clean("/"+library), "/")
+		if library == "" || strings.HasPrefix(filePath, library+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// read returns a file of the repository. Only a file which doesn't exist is reported as not found, other errors
+// are returned, and not cached so that the file is read again by the next evaluation.
+func (l *libraryImporter) read(filePath string) (*libraryFile, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if file, ok := l.cache[filePath]; ok {
+		return file, nil
+	}
+
+	file := &libraryFile{}
+	if l.readFile != nil {
+		content, err := l.readFile(filePath)
+		switch {
+		case err == nil:
+			file = &libraryFile{exists: true, contents: jsonnet.MakeContents(string(content))}
+		case !os.IsNotExist(errors.Cause(err)):
+			return nil, err
+		}
+	}
+	l.cache[filePath] = file
+	return file, nil
+}
@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestJsonnetRenderTemplateParams(t *testing.T) {
+	files := map[string]string{
+		"lib/app.libsonnet":        `{ app(name, replicas):: { metadata: { name: name }, spec: { project: "default", source: { helm: { parameters: [{ name: "replicas", value: std.toString(replicas) }] } } } } }`,
+		"lib/uses-sibling.jsonnet": `(import "app.libsonnet").app("sibling", 1)`,
+		"lib/escape.jsonnet":       `import "../secret.jsonnet"`,
+		"secret.jsonnet":           `{ metadata: { name: "secret" } }`,
+	}
+	readFile := func(path string) ([]byte, error) {
+		if path == "lib/unreadable.libsonnet" {
+			return nil, errors.New("connection reset")
+		}
+		content, ok := files[path]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return []byte(content), nil
+	}
+
+	template := &argoprojiov1alpha1.ApplicationSetTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "{{cluster}}-guestbook"},
+		Spec: argoprojiov1alpha1.ApplicationTemplateSpec{ApplicationSpec: argov1alpha1.ApplicationSpec{
+			Project:     "default",
+			Destination: argov1alpha1.ApplicationDestination{Server: "{{url}}", Namespace: "guestbook"},
+		}},
+	}
+	params := map[string]interface{}{
+		"cluster": "production",
+		"url":     "https://production",
+		"values":  map[string]interface{}{"replicas": 3},
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, c := range []struct {
+		name        string
+		render      JsonnetRender
+		expected    *argov1alpha1.Application
+		expectedErr string
+	}{
+		{
+			name: "application with typed params",
+			render: JsonnetRender{Snippet: `{
+  metadata: { name: std.extVar("cluster") + "-app" },
+  spec: { project: "default", destination: { server: std.extVar("url"), namespace: "ns-" + std.extVar("values").replicas } },
+}`},
+			expected: &argov1alpha1.Application{
+				ObjectMeta: metav1.ObjectMeta{Name: "production-app"},
+				Spec: argov1alpha1.ApplicationSpec{
+					Project:     "default",
+					Destination: argov1alpha1.ApplicationDestination{Server: "https://production", Namespace: "ns-3"},
+				},
+			},
+		},
+		{
+			name: "patch of the template",
+			render: JsonnetRender{
+				Snippet:  `if std.extVar("cluster") == "production" then { metadata: { labels: { env: "prod" } }, spec: { destination: { namespace: null } } } else {}`,
+				Patch:    true,
+				Renderer: &Render{},
+			},
+			expected: &argov1alpha1.Application{
+				ObjectMeta: metav1.ObjectMeta{Name: "production-guestbook", Labels: map[string]string{"env": "prod"}},
+				Spec: argov1alpha1.ApplicationSpec{
+					Project:     "default",
+					Destination: argov1alpha1.ApplicationDestination{Server: "https://production"},
+				},
+			},
+		},
+		{
+			name: "imports from the libraries",
+			render: JsonnetRender{
+				Snippet:   `(import "app.libsonnet").app(std.extVar("cluster"), std.extVar("values").replicas)`,
+				Filename:  "apps/main.jsonnet",
+				Libraries: []string{"lib"},
+				ReadFile:  readFile,
+			},
+			expected: &argov1alpha1.Application{
+				ObjectMeta: metav1.ObjectMeta{Name: "production"},
+				Spec: argov1alpha1.ApplicationSpec{
+					Project: "default",
+					Source: argov1alpha1.ApplicationSource{Helm: &argov1alpha1.ApplicationSourceHelm{
+						Parameters: []argov1alpha1.HelmParameter{{Name: "replicas", Value: "3"}},
+					}},
+				},
+			},
+		},
+		{
+			name: "relative imports within the libraries",
+			render: JsonnetRender{
+				Snippet:   `import "lib/uses-sibling.jsonnet"`,
+				Filename:  "main.jsonnet",
+				Libraries: []string{"/lib/"},
+				ReadFile:  readFile,
+			},
+			expected: &argov1alpha1.Application{
+				ObjectMeta: metav1.ObjectMeta{Name: "sibling"},
+				Spec: argov1alpha1.ApplicationSpec{
+					Project: "default",
+					Source: argov1alpha1.ApplicationSource{Helm: &argov1alpha1.ApplicationSourceHelm{
+						Parameters: []argov1alpha1.HelmParameter{{Name: "replicas", Value: "1"}},
+					}},
+				},
+			},
+		},
+		{
+			name: "imports outside of the libraries",
+			render: JsonnetRender{
+				Snippet:   `import "secret.jsonnet"`,
+				Filename:  "main.jsonnet",
+				Libraries: []string{"lib"},
+				ReadFile:  readFile,
+			},
+			expectedErr: `couldn't import "secret.jsonnet"`,
+		},
+		{
+			name: "imports escaping the libraries",
+			render: JsonnetRender{
+				Snippet:   `import "lib/escape.jsonnet"`,
+				Filename:  "main.jsonnet",
+				Libraries: []string{"lib"},
+				ReadFile:  readFile,
+			},
+			expectedErr: `couldn't import "../secret.jsonnet"`,
+		},
+		{
+			name: "imports which can't be read",
+			render: JsonnetRender{
+				Snippet:   `import "unreadable.libsonnet"`,
+				Filename:  "main.jsonnet",
+				Libraries: []string{"lib"},
+				ReadFile:  readFile,
+			},
+			expectedErr: `couldn't import "unreadable.libsonnet": connection reset`,
+		},
+		{
+			name:        "evaluation timeout",
+			render:      JsonnetRender{Snippet: `std.foldl(function(acc, i) acc + i, std.range(0, 100000000), 0)`, Timeout: 10 * time.Millisecond},
+			expectedErr: "context deadline exceeded",
+		},
+		{
+			name:        "canceled evaluation",
+			render:      JsonnetRender{Snippet: `{}`, Context: canceled},
+			expectedErr: "context canceled",
+		},
+		{
+			name:        "inline snippets can't import the filesystem",
+			render:      JsonnetRender{Snippet: `importstr "/etc/hostname"`},
+			expectedErr: `couldn't import "/etc/hostname"`,
+		},
+		{
+			name:        "invalid Application",
+			render:      JsonnetRender{Snippet: `{ spec: { project: 1 } }`},
+			expectedErr: "Error in decoding the Application returned by the Jsonnet snippet",
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			got, err := cc.render.RenderTemplateParams(template, params)
+
+			if cc.expectedErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), cc.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, cc.expected, got)
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"encoding/json"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// appliedMetadata is the metadata the controller set on a generated Application, recorded in its
+// LastAppliedMetadataAnnotation
+type appliedMetadata struct {
+	Labels      []string `json:"labels,omitempty"`
+	Annotations []string `json:"annotations,omitempty"`
+	Finalizers  []string `json:"finalizers,omitempty"`
+}
+
+// MergeMetadata sets the labels, annotations and finalizers of the generated Application on the live one. Those
+// the controller set before, according to the LastAppliedMetadataAnnotation, but which are not generated anymore
+// are removed, while those set by others, e.g. the refresh annotation of Argo CD, are kept.
+func MergeMetadata(live *metav1.ObjectMeta, generated metav1.ObjectMeta) {
+	var previous appliedMetadata
+	if value, ok := live.Annotations[LastAppliedMetadataAnnotation]; ok {
+		// An invalid annotation is overwritten, the keys it recorded are then kept
+		_ = json.Unmarshal([]byte(value), &previous)
+	}
+
+	var applied appliedMetadata
+	live.Labels, applied.Labels = mergeMap(live.Labels, generated.Labels, previous.Labels)
+	generatedAnnotations := map[string]string{}
+	for key, value := range generated.Annotations {
+		if key != LastAppliedMetadataAnnotation {
+			generatedAnnotations[key] = value
+		}
+	}
+	live.Annotations, applied.Annotations = mergeMap(live.Annotations, generatedAnnotations, previous.Annotations)
+	live.Finalizers, applied.Finalizers = mergeList(live.Finalizers, generated.Finalizers, previous.Finalizers)
+
+	delete(live.Annotations, LastAppliedMetadataAnnotation)
+	if len(applied.Labels) == 0 && len(applied.Annotations) == 0 && len(applied.Finalizers) == 0 {
+		if len(live.Annotations) == 0 {
+			live.Annotations = nil
+		}
+		return
+	}
+	appliedJSON, _ := json.Marshal(applied)
+	if live.Annotations == nil {
+		live.Annotations = map[string]string{}
+	}
+	live.Annotations[LastAppliedMetadataAnnotation] = string(appliedJSON)
+}
+
+// mergeMap sets the generated entries on the live map, removing the previously applied keys which are not
+// generated anymore. It returns the merged map and the sorted keys applied.
+func mergeMap(live map[string]string, generated map[string]string, previous []string) (map[string]string, []string) {
+	res := map[string]string{}
+	for key, value := range live {
+		res[key] = value
+	}
+	for _, key := range previous {
+		if _, ok := generated[key]; !ok {
+			delete(res, key)
+		}
+	}
+
+	var applied []string
+	for key, value := range generated {
+		res[key] = value
+		applied = append(applied, key)
+	}
+	sort.Strings(applied)
+
+	if len(res) == 0 {
+		return nil, applied
+	}
+	return res, applied
+}
+
+// mergeList adds the generated elements missing from the live list, and removes the previously applied ones
+// which are not generated anymore. It returns the merged list and the elements applied.
+func mergeList(live []string, generated []string, previous []string) ([]string, []string) {
+	isGenerated := map[string]bool{}
+	for _, elem := range generated {
+		isGenerated[elem] = true
+	}
+	wasApplied := map[string]bool{}
+	for _, elem := range previous {
+		wasApplied[elem] = true
+	}
+
+	var res []string
+	isLive := map[string]bool{}
+	for _, elem := range live {
+		if wasApplied[elem] && !isGenerated[elem] {
+			continue
+		}
+		res = append(res, elem)
+		isLive[elem] = true
+	}
+	for _, elem := range generated {
+		if !isLive[elem] {
+			res = append(res, elem)
+			isLive[elem] = true
+		}
+	}
+
+	return res, generated
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMergeMetadata(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		live      metav1.ObjectMeta
+		generated metav1.ObjectMeta
+		expected  metav1.ObjectMeta
+	}{
+		{
+			name:      "no metadata",
+			live:      metav1.ObjectMeta{},
+			generated: metav1.ObjectMeta{},
+			expected:  metav1.ObjectMeta{},
+		},
+		{
+			name: "generated metadata is set and recorded",
+			live: metav1.ObjectMeta{
+				Labels:      map[string]string{"team": "old"},
+				Annotations: map[string]string{"argocd.argoproj.io/refresh": "normal"},
+			},
+			generated: metav1.ObjectMeta{
+				Labels:      map[string]string{"team": "platform", "env": "dev"},
+				Annotations: map[string]string{"notes": "generated"},
+				Finalizers:  []string{ResourcesFinalizerName},
+			},
+			expected: metav1.ObjectMeta{
+				Labels: map[string]string{"team": "platform", "env": "dev"},
+				Annotations: map[string]string{
+					"argocd.argoproj.io/refresh":  "normal",
+					"notes":                       "generated",
+					LastAppliedMetadataAnnotation: `{"labels":["env","team"],"annotations":["notes"],"finalizers":["resources-finalizer.argocd.argoproj.io"]}`,
+				},
+				Finalizers: []string{ResourcesFinalizerName},
+			},
+		},
+		{
+			name: "metadata applied before but not generated anymore is removed",
+			live: metav1.ObjectMeta{
+				Labels: map[string]string{"team": "platform", "env": "dev", "owner": "someone"},
+				Annotations: map[string]string{
+					"argocd.argoproj.io/refresh":  "normal",
+					"notes":                       "generated",
+					LastAppliedMetadataAnnotation: `{"labels":["env","team"],"annotations":["notes"],"finalizers":["resources-finalizer.argocd.argoproj.io"]}`,
+				},
+				Finalizers: []string{"other", ResourcesFinalizerName},
+			},
+			generated: metav1.ObjectMeta{
+				Labels: map[string]string{"team": "platform"},
+			},
+			expected: metav1.ObjectMeta{
+				Labels: map[string]string{"team": "platform", "owner": "someone"},
+				Annotations: map[string]string{
+					"argocd.argoproj.io/refresh":  "normal",
+					LastAppliedMetadataAnnotation: `{"labels":["team"]}`,
+				},
+				Finalizers: []string{"other"},
+			},
+		},
+		{
+			name: "annotation is removed when nothing is applied anymore",
+			live: metav1.ObjectMeta{
+				Labels: map[string]string{"team": "platform"},
+				Annotations: map[string]string{
+					LastAppliedMetadataAnnotation: `{"labels":["team"]}`,
+				},
+			},
+			generated: metav1.ObjectMeta{},
+			expected:  metav1.ObjectMeta{},
+		},
+		{
+			name: "invalid annotation is overwritten",
+			live: metav1.ObjectMeta{
+				Labels: map[string]string{"team": "platform"},
+				Annotations: map[string]string{
+					LastAppliedMetadataAnnotation: `invalid`,
+				},
+			},
+			generated: metav1.ObjectMeta{
+				Labels: map[string]string{"env": "dev"},
+			},
+			expected: metav1.ObjectMeta{
+				Labels: map[string]string{"team": "platform", "env": "dev"},
+				Annotations: map[string]string{
+					LastAppliedMetadataAnnotation: `{"labels":["env"]}`,
+				},
+			},
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			MergeMetadata(&cc.live, cc.generated)
+			assert.Equal(t, cc.expected, cc.live)
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// maxNameLength is the maximum length of a DNS-1123 subdomain, and so of an Application name
+const maxNameLength = 253
+
+// nameHashLength is the length of the hash suffix of truncated names
+const nameHashLength = 8
+
+var invalidNameChars = regexp.MustCompile("[^a-z0-9.-]+")
+
+// NormalizeName converts a name to a valid DNS-1123 subdomain: it's lowercased, invalid characters are replaced
+// with '-', and each dot separated part is trimmed so that it starts and ends with an alphanumeric character.
+// Names longer than 253 characters are truncated, and suffixed with a hash of the original name so that names
+// sharing the same prefix remain distinct.
+func NormalizeName(name string) string {
+	normalized := invalidNameChars.ReplaceAllString(strings.ToLower(name), "-")
+
+	var parts []string
+	for _, part := range strings.Split(normalized, ".") {
+		if part = strings.Trim(part, "-"); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	normalized = strings.Join(parts, ".")
+
+	if normalized != "" && len(normalized) <= maxNameLength {
+		return normalized
+	}
+
+	hash := sha256.Sum256([]byte(name))
+	suffix := hex.EncodeToString(hash[:])[:nameHashLength]
+	if len(normalized) > maxNameLength-nameHashLength-1 {
+		normalized = strings.TrimRight(normalized[:maxNameLength-nameHashLength-1], "-.")
+	}
+	if normalized == "" {
+		return suffix
+	}
+	return normalized + "-" + suffix
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestNormalizeName(t *testing.T) {
+	long := strings.Repeat("a", 300)
+
+	for _, c := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"valid name is unchanged", "guestbook-prod.eu", "guestbook-prod.eu"},
+		{"uppercase", "Guestbook", "guestbook"},
+		{"invalid characters", "feature/JIRA_123", "feature-jira-123"},
+		{"consecutive invalid characters", "a//__b", "a-b"},
+		{"leading and trailing invalid characters", "_feature/foo_", "feature-foo"},
+		{"dot separated parts", "-a-.-b-..c", "a.b.c"},
+		{"exactly the maximum length", long[:253], long[:253]},
+		{"too long", long, long[:244] + "-9835fa6b"},
+		{"nothing valid", "___", "bda25155"},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			got := NormalizeName(cc.input)
+
+			assert.Equal(t, cc.expected, got)
+			assert.Empty(t, validation.IsDNS1123Subdomain(got))
+		})
+	}
+}
+
+func TestNormalizeNameTruncationKeepsNamesDistinct(t *testing.T) {
+	prefix := strings.Repeat("a", 300)
+
+	first := NormalizeName(prefix + "-first")
+	second := NormalizeName(prefix + "-second")
+
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, first[:244], second[:244])
+	assert.Len(t, first, 253)
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// ApplyTemplatePatch renders the patch with the params of the Application, and applies it to the Application.
+// A patch which renders to an empty document leaves the Application unchanged.
+//
+// A strategic merge patch replaces the lists of the Application, e.g. its Helm parameters, as
+// argov1alpha1.Application has no patchMergeKey tags: a JSON patch is needed to add an element to a list.
+func ApplyTemplatePatch(renderer Renderer, app *argov1alpha1.Application, templatePatch *argoprojiov1alpha1.ApplicationSetTemplatePatch, params map[string]interface{}) (*argov1alpha1.Application, error) {
+	rendered, err := renderer.RenderYAML(templatePatch.Patch, params)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in rendering the patch")
+	}
+	if rendered == nil {
+		return app, nil
+	}
+
+	patch, err := json.Marshal(rendered)
+	if err != nil {
+		return nil, err
+	}
+
+	appJSON, err := json.Marshal(app)
+	if err != nil {
+		return nil, err
+	}
+
+	var patchedJSON []byte
+	switch templatePatch.Type {
+	case argoprojiov1alpha1.TemplatePatchTypeJSON:
+		jsonPatch, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error in decoding the JSON patch")
+		}
+		patchedJSON, err = jsonPatch.Apply(appJSON)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error in applying the JSON patch")
+		}
+	case argoprojiov1alpha1.TemplatePatchTypeStrategic:
+		patchedJSON, err = strategicpatch.StrategicMergePatch(appJSON, patch, argov1alpha1.Application{})
+		if err != nil {
+			return nil, errors.Wrap(err, "Error in applying the strategic merge patch")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported templatePatch type %q", templatePatch.Type)
+	}
+
+	// The values inserted by the patch are strings, unless the renderer keeps their type: they are parsed in the
+	// boolean and number fields of the Application, as in the template
+	var patchedValue interface{}
+	if err := json.Unmarshal(patchedJSON, &patchedValue); err != nil {
+		return nil, err
+	}
+	patchedJSON, err = json.Marshal(coerceToType(patchedValue, reflect.TypeOf(argov1alpha1.Application{})))
+	if err != nil {
+		return nil, err
+	}
+
+	var patched argov1alpha1.Application
+	if err := json.Unmarshal(patchedJSON, &patched); err != nil {
+		return nil, errors.Wrap(err, "Error in decoding the patched Application")
+	}
+	return &patched, nil
+}
@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"testing"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestApplyTemplatePatch(t *testing.T) {
+	app := argov1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "guestbook"},
+		Spec: argov1alpha1.ApplicationSpec{
+			Source: argov1alpha1.ApplicationSource{
+				Helm: &argov1alpha1.ApplicationSourceHelm{
+					Parameters: []argov1alpha1.HelmParameter{{Name: "replicas", Value: "1"}},
+				},
+			},
+			SyncPolicy: &argov1alpha1.SyncPolicy{
+				Automated: &argov1alpha1.SyncPolicyAutomated{Prune: true},
+			},
+		},
+	}
+
+	for _, c := range []struct {
+		name          string
+		renderer      Renderer
+		patch         argoprojiov1alpha1.ApplicationSetTemplatePatch
+		params        map[string]interface{}
+		expected      func(app *argov1alpha1.Application)
+		expectedError bool
+	}{
+		{
+			name:     "json patch",
+			renderer: &Render{},
+			patch: argoprojiov1alpha1.ApplicationSetTemplatePatch{
+				Type: argoprojiov1alpha1.TemplatePatchTypeJSON,
+				Patch: `
+- op: add
+  path: /spec/source/helm/parameters/-
+  value: {name: tier, value: '{{tier}}'}`,
+			},
+			params: map[string]interface{}{"tier": "gold"},
+			expected: func(app *argov1alpha1.Application) {
+				app.Spec.Source.Helm.Parameters = append(app.Spec.Source.Helm.Parameters, argov1alpha1.HelmParameter{Name: "tier", Value: "gold"})
+			},
+		},
+		{
+			name:     "strategic merge patch",
+			renderer: &Render{},
+			patch: argoprojiov1alpha1.ApplicationSetTemplatePatch{
+				Type: argoprojiov1alpha1.TemplatePatchTypeStrategic,
+				Patch: `
+metadata:
+  labels:
+    env: '{{env}}'
+spec:
+  syncPolicy:
+    automated: null`,
+			},
+			params: map[string]interface{}{"env": "prod"},
+			expected: func(app *argov1alpha1.Application) {
+				app.Labels = map[string]string{"env": "prod"}
+				app.Spec.SyncPolicy.Automated = nil
+			},
+		},
+		{
+			name:     "conditional go template patch",
+			renderer: &GoTemplateRender{},
+			patch: argoprojiov1alpha1.ApplicationSetTemplatePatch{
+				Type: argoprojiov1alpha1.TemplatePatchTypeJSON,
+				Patch: `{{ if eq .env "prod" }}
+- op: remove
+  path: /spec/syncPolicy/automated
+{{ end }}`,
+			},
+			params: map[string]interface{}{"env": "prod"},
+			expected: func(app *argov1alpha1.Application) {
+				app.Spec.SyncPolicy.Automated = nil
+			},
+		},
+		{
+			name:     "patch rendered empty",
+			renderer: &GoTemplateRender{},
+			patch: argoprojiov1alpha1.ApplicationSetTemplatePatch{
+				Type:  argoprojiov1alpha1.TemplatePatchTypeJSON,
+				Patch: `{{ if eq .env "prod" }}- op: remove{{ end }}`,
+			},
+			params:   map[string]interface{}{"env": "dev"},
+			expected: func(app *argov1alpha1.Application) {},
+		},
+		{
+			name:     "failing json patch",
+			renderer: &Render{},
+			patch: argoprojiov1alpha1.ApplicationSetTemplatePatch{
+				Type:  argoprojiov1alpha1.TemplatePatchTypeJSON,
+				Patch: `[{op: remove, path: /spec/does/not/exist}]`,
+			},
+			expectedError: true,
+		},
+		{
+			name:     "invalid yaml",
+			renderer: &Render{},
+			patch: argoprojiov1alpha1.ApplicationSetTemplatePatch{
+				Type:  argoprojiov1alpha1.TemplatePatchTypeStrategic,
+				Patch: `spec: [`,
+			},
+			expectedError: true,
+		},
+		{
+			name:     "param values can't change the structure of the patch",
+			renderer: &Render{},
+			patch: argoprojiov1alpha1.ApplicationSetTemplatePatch{
+				Type: argoprojiov1alpha1.TemplatePatchTypeStrategic,
+				Patch: `
+metadata:
+  labels:
+    env: {{env}}
+    team: 'team-{{team}}'`,
+			},
+			params: map[string]interface{}{"env": "prod\nspec: {project: admin}", "team": "a'\nspec: {project: admin}"},
+			expected: func(app *argov1alpha1.Application) {
+				app.Labels = map[string]string{"env": "prod\nspec: {project: admin}", "team": "team-a'\nspec: {project: admin}"}
+			},
+		},
+		{
+			name:     "param values can't change the structure of a go template patch",
+			renderer: &GoTemplateRender{},
+			patch: argoprojiov1alpha1.ApplicationSetTemplatePatch{
+				Type: argoprojiov1alpha1.TemplatePatchTypeJSON,
+				Patch: `{{ range $name, $value := .params }}
+- op: add
+  path: /spec/source/helm/parameters/-
+  value: {name: {{ $name }}, value: "{{ $value }}"}
+{{ end }}`,
+			},
+			params: map[string]interface{}{"params": map[string]interface{}{"tier": "gold\"}\n- {op: remove, path: /spec/syncPolicy"}},
+			expected: func(app *argov1alpha1.Application) {
+				app.Spec.Source.Helm.Parameters = append(app.Spec.Source.Helm.Parameters, argov1alpha1.HelmParameter{Name: "tier", Value: "gold\"}\n- {op: remove, path: /spec/syncPolicy"})
+			},
+		},
+		{
+			name:     "typed param value",
+			renderer: &Render{},
+			patch: argoprojiov1alpha1.ApplicationSetTemplatePatch{
+				Type:  argoprojiov1alpha1.TemplatePatchTypeStrategic,
+				Patch: `{spec: {syncPolicy: {automated: {prune: '{{prune}}', selfHeal: '{{selfHeal}}'}}}}`,
+			},
+			params: map[string]interface{}{"prune": false, "selfHeal": "true"},
+			expected: func(app *argov1alpha1.Application) {
+				app.Spec.SyncPolicy.Automated = &argov1alpha1.SyncPolicyAutomated{SelfHeal: true}
+			},
+		},
+		{
+			name:     "strategic merge patch replaces lists",
+			renderer: &Render{},
+			patch: argoprojiov1alpha1.ApplicationSetTemplatePatch{
+				Type:  argoprojiov1alpha1.TemplatePatchTypeStrategic,
+				Patch: `{spec: {source: {helm: {parameters: [{name: tier, value: '{{tier}}'}]}}}}`,
+			},
+			params: map[string]interface{}{"tier": "gold"},
+			expected: func(app *argov1alpha1.Application) {
+				app.Spec.Source.Helm.Parameters = []argov1alpha1.HelmParameter{{Name: "tier", Value: "gold"}}
+			},
+		},
+		{
+			name:          "unsupported type",
+			renderer:      &Render{},
+			patch:         argoprojiov1alpha1.ApplicationSetTemplatePatch{Type: "merge", Patch: `{}`},
+			expectedError: true,
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			got, err := ApplyTemplatePatch(cc.renderer, app.DeepCopy(), &cc.patch, cc.params)
+
+			if cc.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				expected := app.DeepCopy()
+				cc.expected(expected)
+				assert.Equal(t, expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// pipeFunc transforms the value of a placeholder. found tells whether the value exists, as only
+// default and required apply to missing params.
+type pipeFunc struct {
+	args  int
+	apply func(key string, value interface{}, found bool, args []string) (interface{}, bool, error)
+}
+
+// transform returns a pipeFunc applying f to the value of the param formatted as a string
+func transform(args int, f func(s string, args []string) (string, error)) pipeFunc {
+	return pipeFunc{args: args, apply: func(key string, value interface{}, found bool, args []string) (interface{}, bool, error) {
+		if !found {
+			return value, false, nil
+		}
+		res, err := f(ParamToString(value), args)
+		return res, true, err
+	}}
+}
+
+var pipeFuncs = map[string]pipeFunc{
+	"default": {args: 1, apply: func(key string, value interface{}, found bool, args []string) (interface{}, bool, error) {
+		if !found || value == nil || value == "" {
+			return args[0], true, nil
+		}
+		return value, true, nil
+	}},
+	"required": {args: 0, apply: func(key string, value interface{}, found bool, args []string) (interface{}, bool, error) {
+		if !found || value == nil || value == "" {
+			return nil, false, fmt.Errorf("required param %s is missing", key)
+		}
+		return value, true, nil
+	}},
+	"lower": transform(0, func(s string, args []string) (string, error) {
+		return strings.ToLower(s), nil
+	}),
+	"upper": transform(0, func(s string, args []string) (string, error) {
+		return strings.ToUpper(s), nil
+	}),
+	"trunc": transform(1, func(s string, args []string) (string, error) {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("trunc expects a positive length, got %s", args[0])
+		}
+		if runes := []rune(s); len(runes) > n {
+			return string(runes[:n]), nil
+		}
+		return s, nil
+	}),
+	"replace": transform(2, func(s string, args []string) (string, error) {
+		return strings.Replace(s, args[0], args[1], -1), nil
+	}),
+	"sha1sum": transform(0, func(s string, args []string) (string, error) {
+		hash := sha1.Sum([]byte(s))
+		return hex.EncodeToString(hash[:]), nil
+	}),
+}
+
+// pipeCall is a function of a pipe, with its arguments
+type pipeCall struct {
+	name string
+	args []string
+}
+
+// evalPlaceholder returns the value of a placeholder, which is either the name of a param, or the name of a
+// param followed by a pipe of functions, e.g. 'metadata.labels.tier | default "standard" | upper'.
+// A placeholder whose pipe can't be parsed, e.g. a Helm template like '.Values.tier | default "standard"',
+// is only looked up as a param name, so that it's left as is.
+func evalPlaceholder(params map[string]interface{}, tag string) (interface{}, bool, error) {
+	value, found := lookupParam(params, tag)
+	if found || !strings.Contains(tag, "|") {
+		return value, found, nil
+	}
+
+	key, calls, ok := parsePipe(tag)
+	if !ok {
+		return nil, false, nil
+	}
+
+	value, found = lookupParam(params, key)
+	for _, call := range calls {
+		var err error
+		value, found, err = pipeFuncs[call.name].apply(key, value, found, call.args)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return value, found, nil
+}
+
+// parsePipe parses a placeholder of the form 'key | func arg... | func arg...'. Arguments are either double
+// quoted strings, with the escapes of Go string literals, or words without spaces.
+func parsePipe(tag string) (string, []pipeCall, bool) {
+	tokens, ok := tokenizePipe(tag)
+	if !ok || len(tokens) < 3 {
+		return "", nil, false
+	}
+
+	key := tokens[0]
+	if key == "|" || strings.HasPrefix(key, ".") || strings.HasPrefix(key, "$") || strings.HasPrefix(key, `"`) {
+		return "", nil, false
+	}
+
+	var calls []pipeCall
+	for i := 1; i < len(tokens); {
+		// Each function follows a pipe
+		if tokens[i] != "|" || i+1 >= len(tokens) {
+			return "", nil, false
+		}
+		call := pipeCall{name: tokens[i+1]}
+		f, ok := pipeFuncs[call.name]
+		if !ok {
+			return "", nil, false
+		}
+		i += 2
+		for ; i < len(tokens) && tokens[i] != "|"; i++ {
+			arg := tokens[i]
+			if strings.HasPrefix(arg, `"`) {
+				var err error
+				if arg, err = strconv.Unquote(arg); err != nil {
+					return "", nil, false
+				}
+			}
+			call.args = append(call.args, arg)
+		}
+		if len(call.args) != f.args {
+			return "", nil, false
+		}
+		calls = append(calls, call)
+	}
+
+	return key, calls, true
+}
+
+// tokenizePipe splits a placeholder into words, quoted strings and pipes
+func tokenizePipe(tag string) ([]string, bool) {
+	var tokens []string
+	runes := []rune(tag)
+	for i := 0; i < len(runes); {
+		switch r := runes[i]; {
+		case unicode.IsSpace(r):
+			i++
+		case r == '|':
+			tokens = append(tokens, "|")
+			i++
+		case r == '"':
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(runes) {
+				return nil, false
+			}
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		default:
+			j := i
+			for ; j < len(runes) && !unicode.IsSpace(runes[j]) && runes[j] != '|' && runes[j] != '"'; j++ {
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		}
+	}
+	return tokens, true
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalPlaceholder(t *testing.T) {
+	params := map[string]interface{}{
+		"name":                 "Cluster-Prod",
+		"empty":                "",
+		"metadata.labels.tier": "gold",
+		"values":               map[string]interface{}{"replicas": float64(3)},
+	}
+
+	for _, c := range []struct {
+		name          string
+		tag           string
+		expected      interface{}
+		expectedFound bool
+		expectedError string
+	}{
+		{name: "param", tag: "name", expected: "Cluster-Prod", expectedFound: true},
+		{name: "missing param", tag: "missing"},
+		{name: "default of present param", tag: `metadata.labels.tier | default "standard"`, expected: "gold", expectedFound: true},
+		{name: "default of missing param", tag: `metadata.labels.zone | default "standard"`, expected: "standard", expectedFound: true},
+		{name: "default of empty param", tag: `empty | default "standard"`, expected: "standard", expectedFound: true},
+		{name: "default without spaces", tag: `missing|default "a|b"`, expected: "a|b", expectedFound: true},
+		{name: "default with escapes", tag: `missing | default "\"quoted\""`, expected: `"quoted"`, expectedFound: true},
+		{name: "unquoted default", tag: "missing | default 3", expected: "3", expectedFound: true},
+		{name: "required param", tag: "name | required", expected: "Cluster-Prod", expectedFound: true},
+		{name: "required missing param", tag: "missing | required", expectedError: "required param missing is missing"},
+		{name: "required empty param", tag: "empty | required", expectedError: "required param empty is missing"},
+		{name: "lower", tag: "name | lower", expected: "cluster-prod", expectedFound: true},
+		{name: "upper", tag: "name | upper", expected: "CLUSTER-PROD", expectedFound: true},
+		{name: "trunc", tag: "name | trunc 7", expected: "Cluster", expectedFound: true},
+		{name: "trunc longer than the value", tag: "name | trunc 20", expected: "Cluster-Prod", expectedFound: true},
+		{name: "invalid trunc", tag: "name | trunc -1", expectedError: "trunc expects a positive length, got -1"},
+		{name: "replace", tag: `name | replace "-" "_"`, expected: "Cluster_Prod", expectedFound: true},
+		{name: "sha1sum", tag: "name | sha1sum", expected: "dc45cf78835a47a642ee6092db4587faf6373a9f", expectedFound: true},
+		{name: "nested value", tag: "values.replicas | default 1", expected: float64(3), expectedFound: true},
+		{name: "chain", tag: `metadata.labels.zone | default "EU-West" | lower | replace "-" ""`, expected: "euwest", expectedFound: true},
+		{name: "transform of missing param", tag: "missing | lower"},
+		{name: "unknown function", tag: "name | title"},
+		{name: "wrong number of arguments", tag: "name | default"},
+		{name: "unterminated string", tag: `missing | default "a`},
+		{name: "helm template", tag: ` .Values.tier | default "standard" `},
+		{name: "helm variable", tag: ` $tier | default "standard" `},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			got, found, err := evalPlaceholder(params, cc.tag)
+
+			if cc.expectedError != "" {
+				assert.EqualError(t, err, cc.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, cc.expectedFound, found)
+				assert.Equal(t, cc.expected, got)
+			}
+		})
+	}
+}
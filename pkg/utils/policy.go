@@ -43,3 +43,21 @@ func (p *CreateOnlyPolicy) Delete() bool {
 	return false
 }
 
+// CapPolicy returns a Policy allowing only the changes allowed by both policy and max, e.g. the policy selected
+// by an ApplicationSet, capped by the policy of the controller.
+func CapPolicy(policy Policy, max Policy) Policy {
+	return &cappedPolicy{policy: policy, max: max}
+}
+
+type cappedPolicy struct {
+	policy Policy
+	max    Policy
+}
+
+func (p *cappedPolicy) Update() bool {
+	return p.policy.Update() && p.max.Update()
+}
+
+func (p *cappedPolicy) Delete() bool {
+	return p.policy.Delete() && p.max.Delete()
+}
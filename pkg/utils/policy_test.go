@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapPolicy(t *testing.T) {
+	for _, c := range []struct {
+		policy         string
+		max            string
+		expectedUpdate bool
+		expectedDelete bool
+	}{
+		{policy: "sync", max: "sync", expectedUpdate: true, expectedDelete: true},
+		{policy: "sync", max: "create-update", expectedUpdate: true, expectedDelete: false},
+		{policy: "sync", max: "create-only", expectedUpdate: false, expectedDelete: false},
+		{policy: "create-update", max: "sync", expectedUpdate: true, expectedDelete: false},
+		{policy: "create-only", max: "sync", expectedUpdate: false, expectedDelete: false},
+		{policy: "create-only", max: "create-update", expectedUpdate: false, expectedDelete: false},
+	} {
+		cc := c
+		t.Run(cc.policy+"/"+cc.max, func(t *testing.T) {
+			got := CapPolicy(Policies[cc.policy], Policies[cc.max])
+			assert.Equal(t, cc.expectedUpdate, got.Update())
+			assert.Equal(t, cc.expectedDelete, got.Delete())
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"encoding/json"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// DecodeTemplate decodes an Application template, with metadata and spec, from YAML or JSON
+func DecodeTemplate(data []byte) (*argoprojiov1alpha1.ApplicationSetTemplate, error) {
+	templateJSON, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in decoding the template")
+	}
+
+	var res argoprojiov1alpha1.ApplicationSetTemplate
+	if err := json.Unmarshal(templateJSON, &res); err != nil {
+		return nil, errors.Wrap(err, "Error in decoding the template")
+	}
+
+	return &res, nil
+}
+
+// MergeTemplates returns the base template with the fields set in override replacing its own, as a
+// RFC 7386 JSON merge patch: objects are merged recursively, while lists and other values are replaced.
+// Empty values of override (empty strings, objects and lists) are ignored.
+func MergeTemplates(base *argoprojiov1alpha1.ApplicationSetTemplate, override *argoprojiov1alpha1.ApplicationSetTemplate) (*argoprojiov1alpha1.ApplicationSetTemplate, error) {
+	baseJSON, err := json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+
+	overrideJSON, err := json.Marshal(override)
+	if err != nil {
+		return nil, err
+	}
+	var overrideValue interface{}
+	if err := json.Unmarshal(overrideJSON, &overrideValue); err != nil {
+		return nil, err
+	}
+	pruned := pruneEmpty(overrideValue)
+	if pruned == nil {
+		pruned = map[string]interface{}{}
+	}
+	overrideJSON, err = json.Marshal(pruned)
+	if err != nil {
+		return nil, err
+	}
+
+	mergedJSON, err := jsonpatch.MergePatch(baseJSON, overrideJSON)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in merging the templates")
+	}
+
+	var res argoprojiov1alpha1.ApplicationSetTemplate
+	if err := json.Unmarshal(mergedJSON, &res); err != nil {
+		return nil, errors.Wrap(err, "Error in decoding the merged template")
+	}
+
+	return &res, nil
+}
+
+// pruneEmpty removes the nulls, empty strings, empty objects and empty lists of a decoded JSON value,
+// so that the unset fields of a template don't erase those of the template it's merged into.
+func pruneEmpty(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		res := map[string]interface{}{}
+		for key, elem := range v {
+			if pruned := pruneEmpty(elem); pruned != nil {
+				res[key] = pruned
+			}
+		}
+		if len(res) == 0 {
+			return nil
+		}
+		return res
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		return v
+	case string:
+		if v == "" {
+			return nil
+		}
+		return v
+	default:
+		return value
+	}
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeTemplates(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		base     string
+		override string
+		expected string
+	}{
+		{
+			name:     "empty override",
+			base:     `{"metadata":{"name":"app"},"spec":{"project":"default"}}`,
+			override: `{"metadata":{},"spec":{}}`,
+			expected: `{"metadata":{"name":"app","creationTimestamp":null},"spec":{"project":"default"}}`,
+		},
+		{
+			name:     "objects are merged",
+			base:     `{"metadata":{"name":"app","labels":{"a":"1","b":"2"}},"spec":{"source":{"path":"p","repoURL":"r"}}}`,
+			override: `{"metadata":{"labels":{"b":"3"}},"spec":{"source":{"path":"{{path}}"}}}`,
+			expected: `{"metadata":{"name":"app","creationTimestamp":null,"labels":{"a":"1","b":"3"}},"spec":{"source":{"path":"{{path}}","repoURL":"r"}}}`,
+		},
+		{
+			name:     "lists are replaced",
+			base:     `{"metadata":{"finalizers":["a","b"]},"spec":{"source":{"helm":{"valueFiles":["values.yaml"]}}}}`,
+			override: `{"metadata":{"finalizers":["c"]},"spec":{"source":{"helm":{"valueFiles":[]}}}}`,
+			expected: `{"metadata":{"creationTimestamp":null,"finalizers":["c"]},"spec":{"source":{"helm":{"valueFiles":["values.yaml"]}}}}`,
+		},
+		{
+			name:     "typed placeholders are kept",
+			base:     `{"metadata":{},"spec":{"syncPolicy":{"automated":{"prune":"{{prune}}"}}}}`,
+			override: `{"metadata":{},"spec":{"syncPolicy":{"automated":{"selfHeal":true}}}}`,
+			expected: `{"metadata":{"creationTimestamp":null},"spec":{"syncPolicy":{"automated":{"prune":"{{prune}}","selfHeal":true}}}}`,
+		},
+	} {
+		cc := c
+		t.Run(cc.name, func(t *testing.T) {
+			base, err := DecodeTemplate([]byte(cc.base))
+			assert.NoError(t, err)
+			override, err := DecodeTemplate([]byte(cc.override))
+			assert.NoError(t, err)
+
+			got, err := MergeTemplates(base, override)
+			assert.NoError(t, err)
+
+			gotJSON, err := json.Marshal(got)
+			assert.NoError(t, err)
+			assert.JSONEq(t, cc.expected, string(gotJSON))
+		})
+	}
+}
+
+func TestDecodeTemplate(t *testing.T) {
+	got, err := DecodeTemplate([]byte(`
+metadata:
+  name: '{{cluster}}-guestbook'
+spec:
+  project: default
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, "{{cluster}}-guestbook", got.Name)
+	assert.Equal(t, "default", got.Spec.Project)
+
+	_, err = DecodeTemplate([]byte("metadata: ["))
+	assert.Error(t, err)
+}
@@ -3,28 +3,105 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
 	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
 	"github.com/pkg/errors"
 	"github.com/valyala/fasttemplate"
 	"io"
+	"reflect"
+	"regexp"
+	"sigs.k8s.io/yaml"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 type Renderer interface {
-	RenderTemplateParams(tmpl *argov1alpha1.Application, params map[string]string) (*argov1alpha1.Application, error)
+	RenderTemplateParams(tmpl *argoprojiov1alpha1.ApplicationSetTemplate, params map[string]interface{}) (*argov1alpha1.Application, error)
+	// RenderYAML renders a YAML document as a whole, e.g. the templatePatch of an ApplicationSet, with the params,
+	// and returns it decoded. The values of the placeholders are inserted in the strings of the decoded document,
+	// so that they can't change its structure whatever they contain.
+	RenderYAML(s string, params map[string]interface{}) (interface{}, error)
 }
 
 type Render struct {
+	// Strict fails the rendering when any placeholder can't be resolved, instead of leaving it as is
+	Strict bool
+}
 
+// UnresolvedParamsError is returned by a strict Render when placeholders can't be resolved
+type UnresolvedParamsError struct {
+	// Keys are the unresolved params, sorted so that the error is the same on each rendering
+	Keys []string
 }
 
-func (r *Render) RenderTemplateParams(tmpl *argov1alpha1.Application, params map[string]string) (*argov1alpha1.Application, error) {
-	if tmpl == nil {
-		return nil, fmt.Errorf("Application template is empty ")
+func (e *UnresolvedParamsError) Error() string {
+	return fmt.Sprintf("unresolved params: %s", strings.Join(e.Keys, ", "))
+}
+
+// wholeFieldRegex matches a field which consists of a single placeholder, e.g. '{{prune}}'
+var wholeFieldRegex = regexp.MustCompile(`^{{([^{}]+)}}$`)
+
+// RenderTemplateParams replaces the '{{param}}' placeholders of the template with the value of the params.
+// A field which consists of a single placeholder takes the value of the param as is, keeping its type
+// (e.g. a boolean or an object), unless the field is a string. Otherwise, and for placeholders within a
+// longer string, the value of the param is formatted as a string, objects and lists as JSON.
+// Placeholders may pipe the param through functions, e.g. '{{metadata.labels.tier | default "standard"}}'.
+func (r *Render) RenderTemplateParams(tmpl *argoprojiov1alpha1.ApplicationSetTemplate, params map[string]interface{}) (*argov1alpha1.Application, error) {
+	// unresolved collects the unresolved params of all the strings, so that they are all reported at once
+	unresolved := &UnresolvedParamsError{}
+	res, err := renderTemplate(tmpl, func(s string) (interface{}, error) {
+		if match := wholeFieldRegex.FindStringSubmatch(s); match != nil {
+			replacement, ok, err := evalPlaceholder(params, match[1])
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				return replacement, nil
+			}
+		}
+		replaced, err := r.replace(s, params, !r.Strict)
+		if unresolvedErr, ok := err.(*UnresolvedParamsError); ok {
+			for _, key := range unresolvedErr.Keys {
+				unresolved.add(key)
+			}
+			return s, nil
+		}
+		return replaced, err
+	})
+	if len(unresolved.Keys) > 0 {
+		return nil, unresolved
+	}
+	return res, err
+}
+
+// RenderYAML replaces the '{{param}}' placeholders of the YAML document with the value of the params. As with
+// RenderTemplateParams, a string which consists of a single placeholder takes the value of the param as is.
+func (r *Render) RenderYAML(s string, params map[string]interface{}) (interface{}, error) {
+	return renderYAML(func(format func(value interface{}) string) (string, error) {
+		return r.replaceWith(s, params, !r.Strict, format)
+	})
+}
+
+// add inserts the key in the sorted Keys, if it's not there yet
+func (e *UnresolvedParamsError) add(key string) {
+	i := sort.SearchStrings(e.Keys, key)
+	if i < len(e.Keys) && e.Keys[i] == key {
+		return
 	}
+	e.Keys = append(e.Keys, "")
+	copy(e.Keys[i+1:], e.Keys[i:])
+	e.Keys[i] = key
+}
+
+// replaceFunc returns the rendered value of a string of the template
+type replaceFunc func(s string) (interface{}, error)
 
-	if len(params) == 0 {
-		return tmpl, nil
+// renderTemplate renders all the strings of the template, including map keys, and decodes the result
+// to an Application.
+func renderTemplate(tmpl *argoprojiov1alpha1.ApplicationSetTemplate, replace replaceFunc) (*argov1alpha1.Application, error) {
+	if tmpl == nil {
+		return nil, fmt.Errorf("Application template is empty ")
 	}
 
 	tmplBytes, err := json.Marshal(tmpl)
@@ -32,51 +109,267 @@ func (r *Render) RenderTemplateParams(tmpl *argov1alpha1.Application, params map
 		return nil, err
 	}
 
-	fstTmpl := fasttemplate.New(string(tmplBytes), "{{", "}}")
-	replacedTmplStr, err := r.replace(fstTmpl, params, true)
+	var tmplValue interface{}
+	if err := json.Unmarshal(tmplBytes, &tmplValue); err != nil {
+		return nil, err
+	}
+
+	replacedValue, err := replaceValue(tmplValue, replace)
 	if err != nil {
 		return nil, err
 	}
 
-	var replacedTmpl argov1alpha1.Application
-	err = json.Unmarshal([]byte(replacedTmplStr), &replacedTmpl)
+	replacedBytes, err := json.Marshal(coerceToType(replacedValue, reflect.TypeOf(argov1alpha1.Application{})))
 	if err != nil {
 		return nil, err
 	}
 
-	if replacedTmpl.ObjectMeta.Finalizers == nil {
-		replacedTmpl.ObjectMeta.Finalizers = []string{}
+	var replacedTmpl argov1alpha1.Application
+	err = json.Unmarshal(replacedBytes, &replacedTmpl)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error in decoding the rendered Application, a param may have the wrong type")
 	}
-	replacedTmpl.ObjectMeta.Finalizers = append(replacedTmpl.ObjectMeta.Finalizers, "resources-finalizer.argocd.argoproj.io")
 
 	return &replacedTmpl, nil
 }
 
+// replaceValue renders all the strings, including map keys, of a decoded JSON value. Maps are rendered in the
+// order of their keys, so that the same error is returned on each rendering.
+func replaceValue(value interface{}, replace replaceFunc) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return replace(v)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		res := make(map[string]interface{}, len(v))
+		for _, key := range keys {
+			elem := v[key]
+			replacedKey, err := replace(key)
+			if err != nil {
+				return nil, err
+			}
+			res[ParamToString(replacedKey)], err = replaceValue(elem, replace)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, elem := range v {
+			var err error
+			res[i], err = replaceValue(elem, replace)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	default:
+		return value, nil
+	}
+}
+
+// coerceToType formats the values of a decoded JSON value as strings wherever the type t expects a string,
+// so that a string field (e.g. a label) can be set to a param of another type. Conversely, a string rendered
+// into a boolean or number field is parsed, e.g. prune: 'true'.
+func coerceToType(value interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		if _, ok := value.(string); !ok && value != nil {
+			return ParamToString(value)
+		}
+		return value
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		if s, ok := value.(string); ok {
+			var parsed interface{}
+			if err := json.Unmarshal([]byte(strings.TrimSpace(s)), &parsed); err == nil {
+				return parsed
+			}
+		}
+		return value
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Map:
+			for key, elem := range v {
+				v[key] = coerceToType(elem, t.Elem())
+			}
+		case reflect.Struct:
+			fields := jsonFields(t)
+			for key, elem := range v {
+				if fieldType, ok := fields[key]; ok {
+					v[key] = coerceToType(elem, fieldType)
+				}
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, elem := range v {
+				v[i] = coerceToType(elem, t.Elem())
+			}
+		}
+	}
+
+	return value
+}
+
+// jsonFields returns the types of the fields of a struct, by JSON name, including those of embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	res := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			fieldType := field.Type
+			for fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				for key, value := range jsonFields(fieldType) {
+					res[key] = value
+				}
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		res[name] = field.Type
+	}
+	return res
+}
+
 // Replace executes basic string substitution of a template with replacement values.
 // allowUnresolved indicates whether or not it is acceptable to have unresolved variables
-// remaining in the substituted template. prefixFilter will apply the replacements only
-// to variables with the specified prefix
-func (r *Render) replace(fstTmpl *fasttemplate.Template, replaceMap map[string]string, allowUnresolved bool) (string, error) {
-	var unresolvedErr error
+// remaining in the substituted template, otherwise an UnresolvedParamsError lists them.
+func (r *Render) replace(tmpl string, replaceMap map[string]interface{}, allowUnresolved bool) (string, error) {
+	return r.replaceWith(tmpl, replaceMap, allowUnresolved, ParamToString)
+}
+
+// replaceWith is replace, formatting the replacement values, and unresolved placeholders, with format
+func (r *Render) replaceWith(tmpl string, replaceMap map[string]interface{}, allowUnresolved bool, format func(value interface{}) string) (string, error) {
+	fstTmpl, err := fasttemplate.NewTemplate(tmpl, "{{", "}}")
+	if err != nil {
+		return "", err
+	}
+
+	unresolvedErr := &UnresolvedParamsError{}
+	var evalErr error
 	replacedTmpl := fstTmpl.ExecuteFuncString(func(w io.Writer, tag string) (int, error) {
-		replacement, ok := replaceMap[tag]
+		replacement, ok, err := evalPlaceholder(replaceMap, tag)
+		if err != nil {
+			if evalErr == nil {
+				evalErr = err
+			}
+			return 0, nil
+		}
 		if !ok {
 			if allowUnresolved {
 				// just write the same string back
-				return w.Write([]byte(fmt.Sprintf("{{%s}}", tag)))
+				return w.Write([]byte(format(fmt.Sprintf("{{%s}}", tag))))
 			}
-			unresolvedErr = errors.Errorf("failed to resolve {{%s}}", tag)
+			unresolvedErr.add(tag)
 			return 0, nil
 		}
-		// The following escapes any special characters (e.g. newlines, tabs, etc...)
-		// in preparation for substitution
-		replacement = strconv.Quote(replacement)
-		replacement = replacement[1 : len(replacement)-1]
-		return w.Write([]byte(replacement))
+		return w.Write([]byte(format(replacement)))
 	})
-	if unresolvedErr != nil {
+	if evalErr != nil {
+		return "", evalErr
+	}
+	if len(unresolvedErr.Keys) > 0 {
 		return "", unresolvedErr
 	}
 
 	return replacedTmpl, nil
 }
+
+// yamlValueRegex matches the markers which stand for the values inserted by the placeholders of a YAML document
+var yamlValueRegex = regexp.MustCompile(`__applicationset_value_(\d+)__`)
+
+// renderYAML renders a YAML document with execute, which formats the values of the placeholders with the given
+// function. The values are replaced by markers until the document is parsed, then inserted in its strings,
+// including map keys: a string which consists of a single marker takes the value as is, otherwise the value is
+// formatted as a string.
+func renderYAML(execute func(format func(value interface{}) string) (string, error)) (interface{}, error) {
+	var values []interface{}
+	rendered, err := execute(func(value interface{}) string {
+		values = append(values, value)
+		return fmt.Sprintf("__applicationset_value_%d__", len(values)-1)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	renderedJSON, err := yaml.YAMLToJSON([]byte(rendered))
+	if err != nil {
+		return nil, err
+	}
+	var res interface{}
+	if err := json.Unmarshal(renderedJSON, &res); err != nil {
+		return nil, err
+	}
+
+	return replaceValue(res, func(s string) (interface{}, error) {
+		if match := yamlValueRegex.FindStringSubmatch(s); match != nil && match[0] == s {
+			return yamlValue(values, match[1]), nil
+		}
+		return yamlValueRegex.ReplaceAllStringFunc(s, func(marker string) string {
+			return ParamToString(yamlValue(values, yamlValueRegex.FindStringSubmatch(marker)[1]))
+		}), nil
+	})
+}
+
+// yamlValue returns the value of the marker with the given index, or the marker itself if there's no such value,
+// e.g. when the marker is part of the document
+func yamlValue(values []interface{}, index string) interface{} {
+	i, err := strconv.Atoi(index)
+	if err != nil || i >= len(values) {
+		return fmt.Sprintf("__applicationset_value_%s__", index)
+	}
+	return values[i]
+}
+
+// lookupParam returns the value of a param. Nested values are addressed with dots, e.g. 'values.image.tag',
+// a param whose name itself contains dots (e.g. 'path.basename') taking precedence.
+func lookupParam(params map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := params[key]; ok {
+		return value, true
+	}
+
+	for i := strings.LastIndex(key, "."); i > 0; i = strings.LastIndex(key[:i], ".") {
+		if nested, ok := params[key[:i]].(map[string]interface{}); ok {
+			if value, ok := lookupParam(nested, key[i+1:]); ok {
+				return value, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// ParamToString formats the value of a param as a string, objects and lists being formatted as JSON.
+func ParamToString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	res, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(res)
+}
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+
+	argoprojiov1alpha1 "github.com/argoproj-labs/applicationset/api/v1alpha1"
+	argov1alpha1 "github.com/argoproj/argo-cd/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRenderTemplateParams(t *testing.T) {
+	// The template as read from the cluster, with placeholders for non-string fields
+	var tmpl argoprojiov1alpha1.ApplicationSetTemplate
+	err := json.Unmarshal([]byte(`{
+		"metadata": {
+			"name": "{{cluster}}-{{values.image.tag}}",
+			"labels": {"{{labelKey}}": "{{values.enabled}}", "unresolved": "{{missing}}"}
+		},
+		"spec": {
+			"project": "{{path.basename}}",
+			"source": {"repoURL": "https://github.com/argoproj/repo", "path": "{{values.image}}"},
+			"syncPolicy": {"automated": {"prune": "{{values.enabled}}", "selfHeal": "{{values.selfHeal}}"}}
+		}
+	}`), &tmpl)
+	require.NoError(t, err)
+
+	render := Render{}
+	got, err := render.RenderTemplateParams(&tmpl, map[string]interface{}{
+		"cluster":       "production",
+		"labelKey":      "enabled",
+		"path.basename": "project",
+		"values": map[string]interface{}{
+			"enabled":  true,
+			"selfHeal": false,
+			"image":    map[string]interface{}{"tag": "v1"},
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &argov1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "production-v1",
+			Labels: map[string]string{"enabled": "true", "unresolved": "{{missing}}"},
+		},
+		Spec: argov1alpha1.ApplicationSpec{
+			Project: "project",
+			Source:  argov1alpha1.ApplicationSource{RepoURL: "https://github.com/argoproj/repo", Path: `{"tag":"v1"}`},
+			SyncPolicy: &argov1alpha1.SyncPolicy{
+				Automated: &argov1alpha1.SyncPolicyAutomated{Prune: true, SelfHeal: false},
+			},
+		},
+	}, got)
+}
+
+func TestRenderTemplateParamsWrongType(t *testing.T) {
+	var tmpl argoprojiov1alpha1.ApplicationSetTemplate
+	err := json.Unmarshal([]byte(`{"metadata": {}, "spec": {"syncPolicy": {"automated": {"prune": "{{prune}}"}}}}`), &tmpl)
+	require.NoError(t, err)
+
+	render := Render{}
+	_, err = render.RenderTemplateParams(&tmpl, map[string]interface{}{"prune": "yes"})
+
+	assert.Error(t, err)
+}
+
+func TestLookupParam(t *testing.T) {
+	params := map[string]interface{}{
+		"path.basename": "app",
+		"values": map[string]interface{}{
+			"image": map[string]interface{}{"tag": "v1"},
+		},
+	}
+
+	for _, c := range []struct {
+		key      string
+		expected interface{}
+		found    bool
+	}{
+		{"path.basename", "app", true},
+		{"values.image.tag", "v1", true},
+		{"values.image", map[string]interface{}{"tag": "v1"}, true},
+		{"values.missing", nil, false},
+		{"path", nil, false},
+	} {
+		cc := c
+		t.Run(cc.key, func(t *testing.T) {
+			got, found := lookupParam(params, cc.key)
+
+			assert.Equal(t, cc.found, found)
+			assert.Equal(t, cc.expected, got)
+		})
+	}
+}
+
+func TestRenderTemplateParamsStrict(t *testing.T) {
+	tmpl := argoprojiov1alpha1.ApplicationSetTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "{{cluster}}-{{metadata.label.env}}",
+			Labels: map[string]string{"env": "{{metadata.label.env}}", "{{team}}": "{{url}}"},
+		},
+		Spec: argoprojiov1alpha1.ApplicationTemplateSpec{
+			ApplicationSpec: argov1alpha1.ApplicationSpec{Project: "{{project}}"},
+		},
+	}
+	params := map[string]interface{}{"cluster": "cluster", "url": "url"}
+
+	render := Render{Strict: true}
+	_, err := render.RenderTemplateParams(&tmpl, params)
+
+	if assert.IsType(t, &UnresolvedParamsError{}, err) {
+		assert.Equal(t, []string{"metadata.label.env", "project", "team"}, err.(*UnresolvedParamsError).Keys)
+		assert.EqualError(t, err, "unresolved params: metadata.label.env, project, team")
+	}
+
+	render = Render{}
+	got, err := render.RenderTemplateParams(&tmpl, params)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "cluster-{{metadata.label.env}}", got.Name)
+}
+
+func TestRenderTemplateParamsPipes(t *testing.T) {
+	tmpl := argoprojiov1alpha1.ApplicationSetTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   `{{name | lower}}-{{metadata.labels.tier | default "standard"}}`,
+			Labels: map[string]string{"tier": `{{metadata.labels.tier | default "standard"}}`},
+		},
+		Spec: argoprojiov1alpha1.ApplicationTemplateSpec{
+			ApplicationSpec: argov1alpha1.ApplicationSpec{
+				Source: argov1alpha1.ApplicationSource{
+					Helm: &argov1alpha1.ApplicationSourceHelm{Values: `tier: {{ .Values.tier | default "standard" }}`},
+				},
+			},
+		},
+	}
+
+	render := Render{}
+	got, err := render.RenderTemplateParams(&tmpl, map[string]interface{}{"name": "Cluster"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "cluster-standard", got.Name)
+	assert.Equal(t, map[string]string{"tier": "standard"}, got.Labels)
+	assert.Equal(t, `tier: {{ .Values.tier | default "standard" }}`, got.Spec.Source.Helm.Values)
+
+	tmpl.Name = "{{metadata.labels.tier | required}}"
+	_, err = render.RenderTemplateParams(&tmpl, map[string]interface{}{"name": "Cluster"})
+
+	assert.EqualError(t, err, "required param metadata.labels.tier is missing")
+}